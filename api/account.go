@@ -0,0 +1,209 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/mail"
+	"pastebin/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// readUserWithPassword loads the principal's user and checks the password it sent, changes to the
+// account need it even with a valid session
+func (h *Handlers) readUserWithPassword(w http.ResponseWriter, r *http.Request, password string) (models.User, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	user, err := h.Users.ReadUserById(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: user doesn't exist", http.StatusNotFound)
+		return models.User{}, false
+	}
+
+	// wrong passwords count as failed logins, a stolen session can't be used to guess the password
+	userKey, ipKey := loginThrottleKeys(user.Name, clientIP(r))
+	if !h.checkLoginBlocked(w, r, userKey, ipKey) {
+		return models.User{}, false
+	}
+	if password == "" || !passwordMatches(user.Password, password) {
+		log.Println("Error: wrong password for an account change from " + clientIP(r))
+		if err := h.recordLoginFailure(ctx, userKey, userBackoffAfter, userLockoutAfter); err != nil {
+			log.Println("Error: Cannot record failed login: " + err.Error())
+		}
+		http.Error(w, "Wrong password", http.StatusForbidden)
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// ChangeEmail sets a new email and sends a verification link to it, the old address is told about the change
+func (h *Handlers) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.EmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !isValidEmail(requestData.Email) {
+		http.Error(w, "Bad Request: invalid email", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := h.readUserWithPassword(w, r, requestData.Password)
+	if !ok {
+		return
+	}
+	if strings.EqualFold(user.Email, requestData.Email) {
+		http.Error(w, "Bad Request: email is unchanged", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Accounts.ChangeUserEmail(ctx, user.UserID, requestData.Email); err != nil {
+		if userConflictField(err) == "email" {
+			http.Error(w, "Conflict: email is already taken", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot change email", http.StatusInternalServerError)
+		log.Println("Error: Cannot change email: " + err.Error())
+		return
+	}
+
+	oldEmail := user.Email
+	user.Email, user.EmailVerified = requestData.Email, false
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		log.Println("Error: Cannot send verification email: " + err.Error())
+	}
+	if isValidEmail(oldEmail) {
+		err := Mailer.Send(ctx, mail.Message{
+			To:      oldEmail,
+			Subject: "Your email was changed",
+			Body:    "Hi " + user.Name + ",\n\nthe email of your account was changed to " + user.Email + ". If you didn't do this, reset your password.\n",
+		})
+		if err != nil {
+			log.Println("Error: Cannot send email change notice: " + err.Error())
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"Email": user.Email, "EmailVerified": user.EmailVerified})
+	w.Write(data)
+}
+
+// ChangePassword sets a new password after checking the current one. The refresh tokens of all
+// other sessions and the API tokens are revoked, access tokens of other sessions work until they
+// expire. The client gets a new session in the response, the same as from /api/login.
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := h.readUserWithPassword(w, r, requestData.CurrentPassword)
+	if !ok {
+		return
+	}
+	if problem := passwordProblem(requestData.NewPassword, user.Name, user.Email); problem != "" {
+		http.Error(w, "Bad Request: "+problem, http.StatusBadRequest)
+		return
+	}
+
+	hash, err := hashPassword(requestData.NewPassword)
+	if err != nil {
+		http.Error(w, "Error: Cannot change password", http.StatusInternalServerError)
+		log.Println("Error: Cannot hash password: " + err.Error())
+		return
+	}
+	if err := h.Accounts.UpdateUserPassword(ctx, user.UserID, hash); err != nil {
+		http.Error(w, "Error: Cannot change password", http.StatusInternalServerError)
+		log.Println("Error: Cannot change password: " + err.Error())
+		return
+	}
+	user.Password = hash
+
+	if err := h.Logins.RevokeUserRefreshTokens(ctx, user.UserID); err != nil {
+		log.Println("Error: Cannot revoke sessions after password change: " + err.Error())
+	}
+	if err := h.Accounts.RevokeUserApiTokens(ctx, user.UserID); err != nil {
+		log.Println("Error: Cannot revoke API tokens after password change: " + err.Error())
+	}
+
+	h.completeLogin(w, r, user, "")
+}
+
+// DeleteAccount removes the user with its pastes, folders, stars, tokens and 2FA settings and
+// gives the devkey back to the key pool. Public pastes can be kept without owner.
+func (h *Handlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.AccountDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := h.readUserWithPassword(w, r, requestData.Password)
+	if !ok {
+		return
+	}
+
+	// organisations would be left without owner
+	soleOwned, err := h.Orgs.CountSoleOwnedOrganisations(ctx, user.UserID)
+	if err != nil {
+		http.Error(w, "Error: Cannot delete account", http.StatusInternalServerError)
+		log.Println("Error: Cannot read organisations of account: " + err.Error())
+		return
+	}
+	if soleOwned > 0 {
+		http.Error(w, "Conflict: add another owner to your organisations or delete them first", http.StatusConflict)
+		return
+	}
+
+	entries, err := h.Accounts.DeleteAccount(ctx, user.UserID, user.DevKey, requestData.KeepPublicPastes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// devkey was changed by another request meanwhile
+			http.Error(w, "Account was changed meanwhile, try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot delete account", http.StatusInternalServerError)
+		log.Println("Error: Cannot delete account: " + err.Error())
+		return
+	}
+
+	// the account is gone at this point, failures below only leave unreachable data behind.
+	// The pastes are deleted like deletePaste does, their keys are not released so that links
+	// to a deleted paste never show another paste
+	for _, entry := range entries {
+		deleteMessageOf(ctx, h.Objects, h.Messages, entry)
+	}
+
+	if err := h.DevKeys.Release(ctx, user.DevKey); err != nil {
+		log.Println("Error: Cannot release devkey of deleted account: " + err.Error())
+	}
+
+	// the other access tokens stop working because the user in their sub is gone
+	if principal.TokenID != uuid.Nil {
+		if err := h.Logins.RevokeAccessToken(ctx, principal.TokenID, principal.ExpiresAt); err != nil {
+			log.Println("Error: Cannot revoke access token: " + err.Error())
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
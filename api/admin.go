@@ -0,0 +1,489 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/kgs"
+	"pastebin/models"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// roleRank orders the roles, every role may do what the lower ones may
+var roleRank = map[string]int{
+	models.RoleUser:      0,
+	models.RoleModerator: 1,
+	models.RoleAdmin:     2,
+}
+
+func isValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// hasRole reports if a user with the role may do what the required role allows
+func hasRole(role, required string) bool {
+	rank, ok := roleRank[role]
+	return ok && rank >= roleRank[required]
+}
+
+// RequireRole rejects principals below the role, it has to be wrapped by RequireAuth. Only login
+// sessions are accepted, the devkey and API tokens can't be used for the admin API
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFrom(r)
+		if principal == nil || principal.TokenID == uuid.Nil {
+			http.Error(w, "Forbidden: requires a login session", http.StatusForbidden)
+			log.Println("Forbidden access: Try to access " + r.URL.String() + " without a login session")
+			return
+		}
+		if !hasRole(principal.Role, role) {
+			http.Error(w, "Forbidden: requires role "+role, http.StatusForbidden)
+			log.Println("Forbidden access: Try to access " + r.URL.String() + " without role " + role)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// rejectSuspended answers 403 for suspended users, it returns true then
+func rejectSuspended(w http.ResponseWriter, user models.User) bool {
+	if user.SuspendedAt == nil {
+		return false
+	}
+	http.Error(w, "Account is suspended", http.StatusForbidden)
+	return true
+}
+
+// audit records an action of the admin API before it is done, the request fails with 500 when the
+// entry can't be written, so no action goes unrecorded. It returns false then.
+func (h *Handlers) audit(ctx context.Context, w http.ResponseWriter, principal *Principal, action, targetType, targetID, details string) bool {
+	entry := models.AuditEntry{
+		ActorID:    principal.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	}
+	if err := h.Admin.CreateAuditEntry(ctx, &entry); err != nil {
+		http.Error(w, "Error: Cannot record audit entry", http.StatusInternalServerError)
+		log.Println("Error: Cannot record audit entry " + action + ": " + err.Error())
+		return false
+	}
+	return true
+}
+
+func adminUserOf(user models.User) models.AdminUser {
+	return models.AdminUser{
+		UserID:        user.UserID,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		PasteNum:      user.PasteNum,
+		Role:          user.Role,
+		SuspendedAt:   user.SuspendedAt,
+	}
+}
+
+// pasteOwner names the user or organisation owning the devkey, admins see it instead of the devkey
+func (h *Handlers) pasteOwner(ctx context.Context, devKey string) (models.PasteOwner, error) {
+	user, err := h.Users.ReadUserByDevKey(ctx, devKey)
+	if err == nil {
+		return models.PasteOwner{Type: "user", ID: user.UserID, Name: user.Name}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.PasteOwner{}, err
+	}
+	org, err := h.Users.ReadOrganisationByDevKey(ctx, devKey)
+	if err != nil {
+		return models.PasteOwner{}, err
+	}
+	return models.PasteOwner{Type: "organisation", ID: org.OrgID, Name: org.Name}, nil
+}
+
+// parseUserQuery reads the q, role, suspended, limit and offset query parameters
+func parseUserQuery(r *http.Request) (models.UserQuery, string) {
+	params := r.URL.Query()
+	query := models.UserQuery{Search: params.Get("q"), Role: params.Get("role"), Limit: defaultPageSize}
+
+	if query.Role != "" && !isValidRole(query.Role) {
+		return query, "invalid role: " + query.Role
+	}
+	if suspended := params.Get("suspended"); suspended != "" {
+		value, err := strconv.ParseBool(suspended)
+		if err != nil {
+			return query, "invalid suspended: " + suspended
+		}
+		query.Suspended = &value
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return query, "invalid limit: " + limit
+		}
+		query.Limit = min(n, maxPageSize)
+	}
+	if offset := params.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return query, "invalid offset: " + offset
+		}
+		query.Offset = n
+	}
+	return query, ""
+}
+
+// AdminListUsers searches users by parts of username or email, filtered by role and suspension
+func (h *Handlers) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	query, problem := parseUserQuery(r)
+	if problem != "" {
+		http.Error(w, "Bad Request: "+problem, http.StatusBadRequest)
+		return
+	}
+
+	if !h.audit(ctx, w, principal, models.AuditListUsers, "user", "", r.URL.RawQuery) {
+		return
+	}
+	users, err := h.Admin.SearchUsers(ctx, query)
+	if err != nil {
+		http.Error(w, "Error: Cannot read users", http.StatusInternalServerError)
+		log.Println("Error: Cannot search users: " + err.Error())
+		return
+	}
+
+	result := make([]models.AdminUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, adminUserOf(user))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"users": result, "offset": query.Offset, "limit": query.Limit})
+	w.Write(data)
+}
+
+// readTargetUser loads the user of the userId route variable, staff can only act on users
+// ranked below them, admins on everyone but themselves
+func (h *Handlers) readTargetUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid user id", http.StatusBadRequest)
+		return models.User{}, false
+	}
+	if userID == principal.UserID {
+		http.Error(w, "Forbidden: cannot change your own account", http.StatusForbidden)
+		return models.User{}, false
+	}
+
+	user, err := h.Users.ReadUserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return models.User{}, false
+		}
+		http.Error(w, "Error: Cannot read user", http.StatusInternalServerError)
+		log.Println("Error: Cannot read user: " + err.Error())
+		return models.User{}, false
+	}
+	if principal.Role != models.RoleAdmin && roleRank[user.Role] >= roleRank[principal.Role] {
+		http.Error(w, "Forbidden: user has the same or a higher role", http.StatusForbidden)
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// AdminSetRole changes the role of a user, the user's tokens carry it from the next refresh
+func (h *Handlers) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || !isValidRole(requestData.Role) {
+		http.Error(w, "Bad Request: role must be user, moderator or admin", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := h.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.audit(ctx, w, principal, models.AuditSetRole, "user", user.UserID.String(), user.Role+" -> "+requestData.Role) {
+		return
+	}
+	if err := h.Admin.SetUserRole(ctx, user.UserID, requestData.Role); err != nil {
+		http.Error(w, "Error: Cannot change role", http.StatusInternalServerError)
+		log.Println("Error: Cannot change role: " + err.Error())
+		return
+	}
+
+	user.Role = requestData.Role
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(adminUserOf(user))
+	w.Write(data)
+}
+
+// AdminSuspendUser blocks login, refresh and all requests of the user and ends their sessions
+func (h *Handlers) AdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.SuspendRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, ok := h.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.SuspendedAt != nil {
+		http.Error(w, "Conflict: user is already suspended", http.StatusConflict)
+		return
+	}
+
+	if !h.audit(ctx, w, principal, models.AuditSuspendUser, "user", user.UserID.String(), requestData.Reason) {
+		return
+	}
+	now := time.Now()
+	if err := h.Admin.SetUserSuspended(ctx, user.UserID, &now); err != nil {
+		http.Error(w, "Error: Cannot suspend user", http.StatusInternalServerError)
+		log.Println("Error: Cannot suspend user: " + err.Error())
+		return
+	}
+	// access tokens stop working because requests check the suspension, refresh tokens are revoked
+	if err := h.Logins.RevokeUserRefreshTokens(ctx, user.UserID); err != nil {
+		log.Println("Error: Cannot revoke refresh tokens of suspended user: " + err.Error())
+	}
+
+	user.SuspendedAt = &now
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(adminUserOf(user))
+	w.Write(data)
+}
+
+// AdminUnsuspendUser lets a suspended user log in again
+func (h *Handlers) AdminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	user, ok := h.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if user.SuspendedAt == nil {
+		http.Error(w, "Conflict: user is not suspended", http.StatusConflict)
+		return
+	}
+
+	if !h.audit(ctx, w, principal, models.AuditUnsuspendUser, "user", user.UserID.String(), "") {
+		return
+	}
+	if err := h.Admin.SetUserSuspended(ctx, user.UserID, nil); err != nil {
+		http.Error(w, "Error: Cannot unsuspend user", http.StatusInternalServerError)
+		log.Println("Error: Cannot unsuspend user: " + err.Error())
+		return
+	}
+
+	user.SuspendedAt = nil
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(adminUserOf(user))
+	w.Write(data)
+}
+
+// readAdminPaste loads the paste of the pasteKey route variable whatever its visibility and owner
+func (h *Handlers) readAdminPaste(w http.ResponseWriter, r *http.Request) (*models.Object, primitive.ObjectID, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	object, err := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return nil, primitive.NilObjectID, false
+	}
+
+	messageId, err := primitive.ObjectIDFromHex(object.MessageID)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		log.Println("Error: Cannot convert from string to primitive.ObjectId")
+		return nil, primitive.NilObjectID, false
+	}
+	return object, messageId, true
+}
+
+// AdminReadPaste shows any paste with its owner for abuse investigation, views are not counted
+func (h *Handlers) AdminReadPaste(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	object, messageId, ok := h.readAdminPaste(w, r)
+	if !ok {
+		return
+	}
+	if !h.audit(ctx, w, principal, models.AuditReadPaste, "paste", object.PasteKey, "") {
+		return
+	}
+
+	message, err := h.Messages.ReadMessage(ctx, messageId)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve paste: " + object.PasteKey + "!")
+		return
+	}
+	owner, err := h.pasteOwner(ctx, object.DevKey)
+	if err != nil {
+		http.Error(w, "Error: Cannot read owner of paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot read owner of paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"PasteKey":   object.PasteKey,
+		"Owner":      owner,
+		"Message":    message.MessageBody,
+		"Language":   object.Language,
+		"Visibility": object.Visibility,
+		"Stars":      object.Stars,
+		"Views":      object.Views,
+		"CreatedAt":  object.CreatedAt,
+	})
+	w.Write(data)
+}
+
+// AdminDeletePaste deletes any paste with its message
+func (h *Handlers) AdminDeletePaste(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	object, _, ok := h.readAdminPaste(w, r)
+	if !ok {
+		return
+	}
+	owner, err := h.pasteOwner(ctx, object.DevKey)
+	if err != nil {
+		http.Error(w, "Error: Cannot read owner of paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot read owner of paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+	if !h.audit(ctx, w, principal, models.AuditDeletePaste, "paste", object.PasteKey, "owner "+owner.Type+" "+owner.ID.String()) {
+		return
+	}
+
+	if err := deletePaste(ctx, h.Objects, h.Messages, object); err != nil {
+		http.Error(w, "Error: Cannot delete paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot delete paste: " + object.PasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminKgsStats shows how many paste keys and devkeys are left in the pools
+func (h *Handlers) AdminKgsStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	if !h.audit(ctx, w, principal, models.AuditReadKgs, "kgs", "", "") {
+		return
+	}
+	pools := map[string]kgs.KGS{"PasteKeys": h.PasteKeys, "DevKeys": h.DevKeys}
+	stats := make(map[string]kgs.Stats, len(pools))
+	for name, pool := range pools {
+		poolStats, err := pool.Stats(ctx)
+		if err != nil {
+			http.Error(w, "Error: Cannot read key pools", http.StatusInternalServerError)
+			log.Println("Error: Cannot count keys of " + name + ": " + err.Error())
+			return
+		}
+		stats[name] = poolStats
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(stats)
+	w.Write(data)
+}
+
+// AdminGetAudit returns the audit trail newest first, filtered by actor, targetType and targetId,
+// older pages are read with before set to the createdAt of the last entry
+func (h *Handlers) AdminGetAudit(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	params := r.URL.Query()
+
+	query := models.AuditQuery{TargetType: params.Get("targetType"), TargetID: params.Get("targetId"), Limit: defaultPageSize}
+	if actor := params.Get("actor"); actor != "" {
+		actorID, err := uuid.Parse(actor)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid actor: "+actor, http.StatusBadRequest)
+			return
+		}
+		query.ActorID = actorID
+	}
+	if before := params.Get("before"); before != "" {
+		t, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid before: "+before, http.StatusBadRequest)
+			return
+		}
+		query.Before = &t
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad Request: invalid limit: "+limit, http.StatusBadRequest)
+			return
+		}
+		query.Limit = min(n, maxPageSize)
+	}
+
+	if !h.audit(ctx, w, principal, models.AuditReadAudit, "audit", "", r.URL.RawQuery) {
+		return
+	}
+	entries, err := h.Admin.ReadAuditEntries(ctx, query)
+	if err != nil {
+		http.Error(w, "Error: Cannot read audit trail", http.StatusInternalServerError)
+		log.Println("Error: Cannot read audit trail: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"entries": entries})
+	w.Write(data)
+}
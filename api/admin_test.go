@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pastebin/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasRole(t *testing.T) {
+	assert.True(t, hasRole(models.RoleAdmin, models.RoleModerator))
+	assert.True(t, hasRole(models.RoleModerator, models.RoleModerator))
+	assert.False(t, hasRole(models.RoleUser, models.RoleModerator))
+	assert.False(t, hasRole(models.RoleModerator, models.RoleAdmin))
+	assert.False(t, hasRole("", models.RoleUser))
+	assert.False(t, hasRole("root", models.RoleUser))
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := RequireRole(models.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(principal *Principal) int {
+		r := httptest.NewRequest("GET", "/api/admin/users", nil)
+		if principal != nil {
+			r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	session := uuid.New()
+	assert.Equal(t, http.StatusForbidden, serve(nil))
+	assert.Equal(t, http.StatusForbidden, serve(&Principal{Role: models.RoleUser, TokenID: session}))
+	assert.Equal(t, http.StatusOK, serve(&Principal{Role: models.RoleModerator, TokenID: session}))
+	assert.Equal(t, http.StatusOK, serve(&Principal{Role: models.RoleAdmin, TokenID: session}))
+	// the devkey and API tokens don't carry a session
+	assert.Equal(t, http.StatusForbidden, serve(&Principal{Role: models.RoleAdmin}))
+}
+
+func TestParseUserQuery(t *testing.T) {
+	query, problem := parseUserQuery(httptest.NewRequest("GET", "/api/admin/users?q=jane&role=moderator&suspended=true&limit=500&offset=40", nil))
+	assert.Equal(t, "", problem)
+	assert.Equal(t, "jane", query.Search)
+	assert.Equal(t, models.RoleModerator, query.Role)
+	assert.True(t, *query.Suspended)
+	assert.Equal(t, maxPageSize, query.Limit)
+	assert.Equal(t, 40, query.Offset)
+
+	query, problem = parseUserQuery(httptest.NewRequest("GET", "/api/admin/users", nil))
+	assert.Equal(t, "", problem)
+	assert.Nil(t, query.Suspended)
+	assert.Equal(t, defaultPageSize, query.Limit)
+
+	for _, params := range []string{"role=root", "suspended=maybe", "limit=0", "offset=-1"} {
+		_, problem = parseUserQuery(httptest.NewRequest("GET", "/api/admin/users?"+params, nil))
+		assert.NotEqual(t, "", problem, params)
+	}
+}
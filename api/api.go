@@ -1,89 +1,27 @@
 package api
 
 import (
-	"log"
 	"net/http"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
 	//"database/sql"
-	"context"
-	"pastebin/db"
-	"pastebin/kgs"
+	"pastebin/config"
 	//"go.mongodb.org/mongo-driver/mongo"
 	//"os"
 )
 
-var ConnectorPostgresDB *db.PostgresDB
-var ConnectorMongoDB *db.MongoDB
-var KgsPasteKeys kgs.KGS
-var KgsDevKeys kgs.KGS
-
-func StartApiServer() {
+// newRouter registers the endpoints of h and lets the frontends call them from the browser
+func newRouter(cfg config.Server, h *Handlers) http.Handler {
 	r := mux.NewRouter()
+	h.Routes(r)
 
 	//corsOpts := handlers.AllowedOrigins([]string{"http://localhost:3000"}) // Set your frontend origin here
 
-	r.HandleFunc("/api/register", RegisterHandler).Methods("POST")
-	r.HandleFunc("/api/login", LoginHandler).Methods("POST")
-	r.HandleFunc("/api/check", ValidateJWTToken(ChekerHandler)).Methods("GET")
-	r.HandleFunc("/api/checkandparse", ChekerHandlerParseToken).Methods("GET")
-	r.HandleFunc("/api/createPaste", CreatePaste).Methods("POST")
-	r.HandleFunc("/api/getPaste/{pasteKey}", GetPaste).Methods("GET")
-	r.HandleFunc("/api/deletePaste", DeletePaste).Methods("POST")
-	r.HandleFunc("/api/getUserInfo", GetUserInfo).Methods("GET")
-	r.HandleFunc("/api/getUserPastes", GetUserPastes).Methods("GET")
-
-	log.Println("Server started on :8080")
-	http.Handle("/", r)
-	http.ListenAndServe(":8080", handlers.CORS(
-		handlers.AllowedOrigins([]string{"http://localhost:3000"}),
+	return handlers.CORS(
+		handlers.AllowedOrigins(cfg.CORSOrigins),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
-	)(r))
-}
-
-func StartApiServerAndPrepareDbConnection() {
-	postgresClient, err := db.ConnectToPostgresDb("mydb2", "postgres", "pass1234")
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	// ovde treba videti gde pozvati ovo za diskonektovanje sa baze
-	defer db.DisconnectFromPostgresDb(postgresClient)
-	ConnectorPostgresDB = db.NewPostgresDB(postgresClient)
-
-	mongoClient, errM := db.ConnectToMongoDb(context.Background())
-	if errM != nil {
-		log.Println(err)
-		return
-	}
-	defer db.DisconnectFromMongoDb(context.Background(), mongoClient)
-
-	ConnectorMongoDB = db.NewMongoDB(mongoClient, context.Background(), "pastes", "messages")
-
-	// add KGS for pastekeys
-	postgresClientKgsPasteKey, errP := db.ConnectToPostgresDb("pastekeys", "postgres", "pass1234")
-	if errP != nil {
-		log.Println(errP)
-		return
-	}
-	// ovde treba videti gde pozvati ovo za diskonektovanje sa baze
-	defer db.DisconnectFromPostgresDb(postgresClientKgsPasteKey)
-	KgsPasteKeys = kgs.GetInstance(postgresClientKgsPasteKey)
-
-	// add KGS for devkeys
-	postgresClientKgsDevKey, errD := db.ConnectToPostgresDb("devkeys", "postgres", "pass1234")
-	if errD != nil {
-		log.Println(errD)
-		return
-	}
-	// ovde treba videti gde pozvati ovo za diskonektovanje sa baze
-	defer db.DisconnectFromPostgresDb(postgresClientKgsDevKey)
-	KgsDevKeys = kgs.GetInstance(postgresClientKgsDevKey)
-
-	log.Println("Uspesna konekcija ostvarena na svim bazama!")
-
-	StartApiServer()
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", apiKeyHeader}),
+	)(r)
 }
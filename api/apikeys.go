@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	apiKeyHeader      = "X-Api-Key"
+	apiTokenPrefix    = "pbt_"
+	maxApiTokenName   = 64
+	maxApiTokensCount = 50
+)
+
+// scopes a named API token can be given, sessions from login have all scopes
+var apiTokenScopes = map[string]bool{
+	models.ScopePasteRead:  true,
+	models.ScopePasteWrite: true,
+}
+
+var allScopes = []string{models.ScopePasteRead, models.ScopePasteWrite, models.ScopeAccount}
+
+// devKeyScopes are the scopes of the devkey, it can't manage the account it belongs to
+var devKeyScopes = []string{models.ScopePasteRead, models.ScopePasteWrite}
+
+// resolveApiKey finds the user of a devkey or an API token, API tokens are limited to their scopes
+func (h *Handlers) resolveApiKey(ctx context.Context, key string) (*Principal, error) {
+	if strings.HasPrefix(key, apiTokenPrefix) {
+		token, err := h.Users.ReadActiveApiToken(ctx, hashToken(key))
+		if err != nil {
+			return nil, err
+		}
+		user, err := h.Users.ReadUserById(ctx, token.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.SuspendedAt != nil {
+			return nil, errAccountSuspended
+		}
+		if err := h.Users.TouchApiToken(ctx, token.TokenID); err != nil {
+			log.Println("Error: Cannot update API token usage: " + err.Error())
+		}
+		return &Principal{UserID: user.UserID, Username: user.Name, DevKey: user.DevKey, Role: user.Role, Scopes: token.Scopes}, nil
+	}
+
+	user, err := h.Users.ReadUserByDevKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, errAccountSuspended
+	}
+	return &Principal{UserID: user.UserID, Username: user.Name, DevKey: user.DevKey, Role: user.Role, Scopes: devKeyScopes}, nil
+}
+
+// validateApiTokenRequest trims the name and removes duplicate scopes
+func validateApiTokenRequest(request *models.ApiTokenRequest) string {
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxApiTokenName {
+		return "Token name must have between 1 and 64 characters"
+	}
+	if len(request.Scopes) == 0 {
+		return "Token needs at least one scope"
+	}
+
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !apiTokenScopes[scope] {
+			return "Unknown scope: " + scope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	request.Scopes = scopes
+	return ""
+}
+
+// CreateApiToken issues a named token with the requested scopes, its value is only shown in this response
+func (h *Handlers) CreateApiToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.ApiTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if msg := validateApiTokenRequest(&requestData); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.Accounts.ReadApiTokensByUser(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: Cannot create API token", http.StatusInternalServerError)
+		log.Println("Error: Cannot read API tokens: " + err.Error())
+		return
+	}
+	active := 0
+	for _, token := range tokens {
+		if token.RevokedAt == nil {
+			active++
+		}
+	}
+	if active >= maxApiTokensCount {
+		http.Error(w, "Too many API tokens, revoke some first", http.StatusConflict)
+		return
+	}
+
+	secret, err := newRandomToken()
+	if err != nil {
+		http.Error(w, "Error: Cannot create API token", http.StatusInternalServerError)
+		return
+	}
+	value := apiTokenPrefix + secret
+
+	token := models.ApiToken{
+		UserID:    principal.UserID,
+		Name:      requestData.Name,
+		TokenHash: hashToken(value),
+		Scopes:    requestData.Scopes,
+	}
+	if err := h.Accounts.CreateApiToken(ctx, &token); err != nil {
+		http.Error(w, "Error: Cannot create API token", http.StatusInternalServerError)
+		log.Println("Error: Cannot create API token: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(map[string]interface{}{"ApiToken": token, "Token": value})
+	w.Write(data)
+}
+
+// GetApiTokens lists the tokens of the user, without their values
+func (h *Handlers) GetApiTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	tokens, err := h.Accounts.ReadApiTokensByUser(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: Cannot read API tokens", http.StatusInternalServerError)
+		log.Println("Error: Cannot read API tokens: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"ApiTokens": tokens})
+	w.Write(data)
+}
+
+// RevokeApiToken stops a token of the user from working
+func (h *Handlers) RevokeApiToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	tokenID, err := uuid.Parse(mux.Vars(r)["tokenId"])
+	if err != nil {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Accounts.RevokeApiToken(ctx, tokenID, principal.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "API token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot revoke API token", http.StatusInternalServerError)
+		log.Println("Error: Cannot revoke API token: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateDevKey gives the user a new devkey, pastes and folders move over to it and the old one
+// stops working as API key. A new access token is returned for clients reading the devkey claim.
+func (h *Handlers) RegenerateDevKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	devKey, err := h.DevKeys.Check(ctx, "")
+	if err != nil {
+		http.Error(w, "Error: Cannot regenerate devkey", http.StatusInternalServerError)
+		log.Println("Error: Cannot create key for user: " + err.Error())
+		return
+	}
+
+	if err := h.Accounts.ChangeDevKey(ctx, principal.UserID, principal.DevKey, devKey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// devkey was changed by another request meanwhile
+			http.Error(w, "Devkey was already changed, try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot regenerate devkey", http.StatusInternalServerError)
+		log.Println("Error: Cannot change devkey: " + err.Error())
+		return
+	}
+
+	newToken, err := CreateNewToken(principal.UserID, principal.Username, devKey, principal.Role)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"DevKey": devKey, "Token": newToken})
+	w.Write(data)
+}
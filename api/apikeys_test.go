@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(models.ScopePasteWrite, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(principal *Principal) int {
+		r := httptest.NewRequest("POST", "/api/createPaste", nil)
+		if principal != nil {
+			r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	// anonymous requests are left to RequireAuth
+	assert.Equal(t, http.StatusOK, serve(nil))
+	assert.Equal(t, http.StatusOK, serve(&Principal{Scopes: allScopes}))
+	assert.Equal(t, http.StatusForbidden, serve(&Principal{Scopes: []string{models.ScopePasteRead}}))
+}
+
+func TestValidateApiTokenRequest(t *testing.T) {
+	request := models.ApiTokenRequest{Name: " deploy ", Scopes: []string{"paste:read", "paste:read", "paste:write"}}
+	assert.Equal(t, "", validateApiTokenRequest(&request))
+	assert.Equal(t, "deploy", request.Name)
+	assert.Equal(t, []string{"paste:read", "paste:write"}, request.Scopes)
+
+	// account scope is reserved for the devkey and sessions
+	request = models.ApiTokenRequest{Name: "deploy", Scopes: []string{models.ScopeAccount}}
+	assert.NotEqual(t, "", validateApiTokenRequest(&request))
+
+	request = models.ApiTokenRequest{Name: "", Scopes: []string{"paste:read"}}
+	assert.NotEqual(t, "", validateApiTokenRequest(&request))
+}
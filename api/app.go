@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"pastebin/blob"
+	"pastebin/config"
+	"pastebin/db"
+	"pastebin/kgs"
+	"pastebin/mail"
+	"sync"
+	"time"
+)
+
+// App runs the server: Start connects to the databases, loads the keys, starts the background
+// workers and listens, Stop undoes it in reverse order
+type App struct {
+	cfg    *config.Config
+	server *http.Server
+	// closers close the connections in the order they were opened
+	closers []func() error
+	// the stores opened by Start, the handlers and the workers use them
+	store       *db.PostgresDB
+	messages    db.MessageStore
+	pasteKeys   kgs.KGS
+	devKeys     kgs.KGS
+	workers     sync.WaitGroup
+	workerCtx   context.Context
+	stopWorkers context.CancelFunc
+	serveErr    chan error
+	// jobs started by requests, like the password reset emails, that run after the response
+	jobs     sync.WaitGroup
+	jobsMu   sync.Mutex
+	stopping bool
+}
+
+func NewApp(cfg *config.Config) *App {
+	return &App{cfg: cfg, serveErr: make(chan error, 1)}
+}
+
+// Run starts the app and stops it when ctx is cancelled, or when the server fails
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down")
+	case err = <-a.serveErr:
+		log.Println("Error: server failed: " + err.Error())
+	}
+	return errors.Join(err, a.Stop())
+}
+
+// Start returns once the server accepts requests, what was opened is closed again when a step fails
+func (a *App) Start(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			a.closeConnections()
+		}
+	}()
+
+	if err := a.openStores(ctx); err != nil {
+		return err
+	}
+	log.Println("Uspesna konekcija ostvarena na svim bazama!")
+
+	keys, err := LoadKeyRing(a.cfg.Auth)
+	if err != nil {
+		return err
+	}
+	SigningKeys = keys
+
+	if err := LoadShareLinkSecret(a.cfg.Auth.ShareLinkSecretFile); err != nil {
+		return err
+	}
+
+	mailer, err := mail.FromConfig(a.cfg.Mail)
+	if err != nil {
+		return err
+	}
+	Mailer = mailer
+	AppURL = a.cfg.Server.AppURL
+	dbTimeout = a.cfg.Server.DBTimeout
+
+	providers, err := LoadSSOProviders(ctx, a.cfg.SSO)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", a.cfg.Server.Addr)
+	if err != nil {
+		return err
+	}
+
+	h := NewStoreHandlers(a.store, a.messages, a.pasteKeys, a.devKeys)
+	h.SSOProviders = providers
+	h.Background = a.runJob
+	a.workerCtx, a.stopWorkers = context.WithCancel(context.Background())
+	a.startWorker(time.Hour, h.pruneTrending)
+	a.startWorker(time.Hour, h.deleteExpiredTokens)
+	a.startWorker(time.Hour, a.reconcilePastes)
+
+	a.server = &http.Server{Handler: newRouter(a.cfg.Server, h)}
+	go func() {
+		if err := a.server.Serve(listener); err != http.ErrServerClosed {
+			a.serveErr <- err
+		}
+	}()
+	log.Println("Server started on " + listener.Addr().String())
+	return nil
+}
+
+// Stop lets the requests in flight and the jobs they started finish within the shutdown timeout,
+// stops the workers and closes the connections
+func (a *App) Stop() error {
+	var errs []error
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Println("Error: requests did not finish in time: " + err.Error())
+		errs = append(errs, err, a.server.Close())
+	}
+
+	a.jobsMu.Lock()
+	a.stopping = true
+	a.jobsMu.Unlock()
+	jobsDone := make(chan struct{})
+	go func() {
+		a.jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		log.Println("Error: background jobs did not finish in time, they are cancelled")
+	}
+
+	// the workers and the jobs that are still running get a cancelled context
+	a.stopWorkers()
+	a.workers.Wait()
+	<-jobsDone
+
+	errs = append(errs, a.closeConnections())
+	return errors.Join(errs...)
+}
+
+// startWorker runs job every interval until Stop, a job that is running then gets a cancelled
+// context and Stop waits for it to return
+func (a *App) startWorker(interval time.Duration, job func(ctx context.Context)) {
+	ctx := a.workerCtx
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				job(ctx)
+			}
+		}
+	}()
+}
+
+// runJob runs a job started by a request in the background, Stop waits for it. Requests that are
+// still running when Stop gave up waiting for them can't start jobs anymore.
+func (a *App) runJob(job func(ctx context.Context)) {
+	a.jobsMu.Lock()
+	defer a.jobsMu.Unlock()
+	if a.stopping {
+		log.Println("Error: server is stopping, background job is not run")
+		return
+	}
+
+	ctx := a.workerCtx
+	a.jobs.Add(1)
+	go func() {
+		defer a.jobs.Done()
+		job(ctx)
+	}()
+}
+
+// openStores connects to the databases and keeps the stores, in embedded mode everything is
+// in one SQLite file
+func (a *App) openStores(ctx context.Context) error {
+	cfg := a.cfg
+	if cfg.Embedded() {
+		sqliteClient, err := db.ConnectToSQLiteDb(cfg.SQLite.Path)
+		if err != nil {
+			return err
+		}
+		a.onClose(func() error { return db.DisconnectFromSQLiteDb(sqliteClient) })
+		a.store = db.NewSQLiteDB(sqliteClient)
+		a.messages = db.NewSQLiteMessageDB(sqliteClient)
+		a.pasteKeys = kgs.GetSQLiteInstance(ctx, sqliteClient)
+		a.devKeys = a.pasteKeys
+	} else {
+		postgresClient, err := db.ConnectToPostgresDb(cfg.Postgres, cfg.Postgres.Database)
+		if err != nil {
+			return err
+		}
+		a.onClose(func() error { return db.DisconnectFromPostgresDb(postgresClient) })
+		a.store = db.NewPostgresDB(postgresClient)
+
+		if cfg.Content.Backend == blob.BackendMongo {
+			mongoClient, err := db.ConnectToMongoDb(ctx, cfg.Mongo.URI)
+			if err != nil {
+				return err
+			}
+			a.onClose(func() error { return db.DisconnectFromMongoDb(context.Background(), mongoClient) })
+			a.messages = db.NewMongoDB(mongoClient, cfg.Mongo.Database, cfg.Mongo.Collection)
+		}
+
+		// add KGS for pastekeys
+		postgresClientKgsPasteKey, err := db.ConnectToPostgresDb(cfg.Postgres, cfg.Postgres.PasteKeysDatabase)
+		if err != nil {
+			return err
+		}
+		a.onClose(func() error { return db.DisconnectFromPostgresDb(postgresClientKgsPasteKey) })
+		a.pasteKeys = kgs.GetInstance(ctx, postgresClientKgsPasteKey)
+
+		// add KGS for devkeys
+		postgresClientKgsDevKey, err := db.ConnectToPostgresDb(cfg.Postgres, cfg.Postgres.DevKeysDatabase)
+		if err != nil {
+			return err
+		}
+		a.onClose(func() error { return db.DisconnectFromPostgresDb(postgresClientKgsDevKey) })
+		a.devKeys = kgs.GetInstance(ctx, postgresClientKgsDevKey)
+	}
+
+	// paste content can be moved out of the database
+	if cfg.Content.Backend != blob.BackendMongo {
+		store, err := blob.FromConfig(cfg.Content)
+		if err != nil {
+			return err
+		}
+		a.messages = blob.NewMessageDB(store)
+	}
+	return nil
+}
+
+func (a *App) onClose(closer func() error) {
+	a.closers = append(a.closers, closer)
+}
+
+// closeConnections closes the connections in reverse order
+func (a *App) closeConnections() error {
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		errs = append(errs, a.closers[i]())
+	}
+	a.closers = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"pastebin/config"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// embeddedConfig runs the app on a SQLite file on a free port
+func embeddedConfig(t *testing.T) *config.Config {
+	cfg := config.Default()
+	cfg.SQLite.Path = filepath.Join(t.TempDir(), "app.db")
+	cfg.Mail.OutboxDir = filepath.Join(t.TempDir(), "outbox")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	cfg.Server.Addr = listener.Addr().String()
+	listener.Close()
+	return cfg
+}
+
+func TestAppLifecycle(t *testing.T) {
+	cfg := embeddedConfig(t)
+	app := NewApp(cfg)
+	assert.NoError(t, app.Start(context.Background()))
+
+	resp, err := http.Get("http://" + cfg.Server.Addr + "/api/archive")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// a worker that is running when the app stops gets the cancelled context and is waited for
+	var running, finished atomic.Bool
+	started := make(chan struct{})
+	app.startWorker(time.Millisecond, func(ctx context.Context) {
+		if running.CompareAndSwap(false, true) {
+			close(started)
+		}
+		<-ctx.Done()
+		finished.Store(true)
+	})
+	<-started
+
+	assert.NoError(t, app.Stop())
+	assert.True(t, finished.Load())
+
+	_, err = http.Get("http://" + cfg.Server.Addr + "/api/archive")
+	assert.Error(t, err)
+	// the connections are closed
+	_, err = app.store.ReadUserByUsername(context.Background(), "nobody")
+	assert.ErrorContains(t, err, "database is closed")
+}
+
+func TestAppStopWaitsForJobs(t *testing.T) {
+	cfg := embeddedConfig(t)
+	cfg.Server.ShutdownTimeout = 200 * time.Millisecond
+	app := NewApp(cfg)
+	assert.NoError(t, app.Start(context.Background()))
+
+	// a job that finishes within the shutdown timeout is waited for, one that doesn't is cancelled
+	var finished, cancelled atomic.Bool
+	app.runJob(func(ctx context.Context) {
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+	app.runJob(func(ctx context.Context) {
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+
+	assert.NoError(t, app.Stop())
+	assert.True(t, finished.Load())
+	assert.True(t, cancelled.Load())
+
+	// jobs are not started anymore once the app stops
+	var ran atomic.Bool
+	app.runJob(func(ctx context.Context) { ran.Store(true) })
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, ran.Load())
+}
+
+func TestAppRun(t *testing.T) {
+	cfg := embeddedConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewApp(cfg).Run(ctx) }()
+
+	// Run returns once ctx is cancelled, like on SIGTERM
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + cfg.Server.Addr + "/api/archive")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
+
+func TestAppStartFailure(t *testing.T) {
+	cfg := embeddedConfig(t)
+	// the address is taken, the database opened before is closed again
+	listener, err := net.Listen("tcp", cfg.Server.Addr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	app := NewApp(cfg)
+	assert.Error(t, app.Start(context.Background()))
+	assert.Empty(t, app.closers)
+	_, err = app.store.ReadUserByUsername(context.Background(), "nobody")
+	assert.ErrorContains(t, err, "database is closed")
+}
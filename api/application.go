@@ -4,10 +4,13 @@ import (
 	"log"
 	"net/http"
 	"encoding/json"
+	"pastebin/db"
 	"pastebin/models"
 	"context"
+	"time"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"github.com/gorilla/mux"
+	"github.com/google/uuid"
 )
 
 
@@ -19,38 +22,24 @@ func ChekerHandler(w http.ResponseWriter, r *http.Request){
 
 // tester function
 func ChekerHandlerParseToken(w http.ResponseWriter, r *http.Request){
-	mapClaims, error := ParseAccesToken(r)
-	if error != nil {
-		http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-		log.Println("Unauthorized access: Try to access " + r.URL.String())
-		return
-	}
-	
-	username := mapClaims["username"].(string)
-	devkey := mapClaims["devkey"].(string)
-
+	principal := principalFrom(r)
 
 	log.Println("Authorization passed")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"TokenInfo" : map[string]interface{}{
-			"username": username,
-			"devkey":	devkey,
+			"username": principal.Username,
+			"devkey":	principal.DevKey,
 		},
 	})
 }
 
 
-func CreatePaste(w http.ResponseWriter, r *http.Request){
-	mapClaims, error := ParseAccesToken(r)
-	if error != nil {
-		http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-		log.Println("Unauthorized access: Try to access " + r.URL.String())
-		return
-	}
-	//usernameToken := mapClaims["username"].(string)
-	devKeyToken := mapClaims["devkey"].(string)
-	
+func (h *Handlers) CreatePaste(w http.ResponseWriter, r *http.Request){
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
 
 	var requestData models.Paste
 
@@ -61,53 +50,86 @@ func CreatePaste(w http.ResponseWriter, r *http.Request){
 	}
 
 	// pasteKey is not mandatory
-	if requestData.Message == "" || requestData.DevKey == "" {
-		log.Println("Bad request for deleting paste: insufficient number of fields")
+	if requestData.Message == "" {
+		log.Println("Bad request for creating paste: insufficient number of fields")
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	if devKeyToken != requestData.DevKey {
-		log.Println(devKeyToken)
-			log.Println(requestData.DevKey)
-		http.Error(w,"Not valid data!", http.StatusUnauthorized)
-		log.Println("Unauthorized function: Try to access " + r.URL.String() + " with different devkey")
+	if requestData.Language == "" {
+		requestData.Language = "text"
+	}
+	if requestData.Visibility == "" {
+		requestData.Visibility = models.VisibilityPublic
+	}
+	if len(requestData.Language) > 32 || !isValidVisibility(requestData.Visibility) {
+		log.Println("Bad request for creating paste: invalid language or visibility")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	pastekey, errKey := KgsPasteKeys.Check(requestData.PasteKey)
-	if errKey != nil {
-		http.Error(w,"Error: Cannot create paste", http.StatusInternalServerError)
-		log.Println("Error: Cannot create key for paste: "+ requestData.PasteKey + ": " + errKey.Error())
-		return 
+	tags, tagsOk := normalizeTags(requestData.Tags)
+	if !tagsOk {
+		log.Println("Bad request for creating paste: invalid tags")
+		http.Error(w, "Bad Request: invalid tags", http.StatusBadRequest)
+		return
+	}
+
+	// pastes of an organisation are owned by its devkey, members need the editor role
+	devkey := principal.DevKey
+	if requestData.OrgID != "" {
+		orgID, errOrg := uuid.Parse(requestData.OrgID)
+		if errOrg != nil {
+			http.Error(w, "Bad Request: invalid orgId", http.StatusBadRequest)
+			return
+		}
+		role, errRole := h.Users.ReadOrgMemberRole(ctx, orgID, principal.UserID)
+		if errRole != nil || !hasOrgRole(role, models.OrgRoleEditor) {
+			http.Error(w, "Forbidden: organisation editors create its pastes", http.StatusForbidden)
+			return
+		}
+		org, errOrg := h.Users.ReadOrganisation(ctx, orgID)
+		if errOrg != nil {
+			http.Error(w,"Error: Cannot create paste", http.StatusInternalServerError)
+			log.Println("Error: Cannot read organisation: " + errOrg.Error())
+			return
+		}
+		devkey = org.DevKey
 	}
 
-	// first create message
-	messageId, errMsg := ConnectorMongoDB.CreateMessage(requestData.Message)
-	if errMsg != nil {
+	pastekey, errKey := h.PasteKeys.Check(ctx, requestData.PasteKey)
+	if errKey != nil {
 		http.Error(w,"Error: Cannot create paste", http.StatusInternalServerError)
-		log.Println("Error: Cannot create message for paste: "+ requestData.PasteKey + "!")
+		log.Println("Error: Cannot create key for paste: "+ requestData.PasteKey + ": " + errKey.Error())
 		return 
 	}
 
-	
-
 	newObject := models.Object{
 		PasteKey: 	 pastekey,
-		DevKey: 	requestData.DevKey,
-		MessageID: 	messageId,
+		DevKey: 	devkey,
+		Language:	requestData.Language,
+		Visibility:	requestData.Visibility,
 	}
-	
 
-	errObj := ConnectorPostgresDB.CreateObject(context.Background(), &newObject)
-	if errObj != nil {
-		idM , _ := primitive.ObjectIDFromHex(messageId)
-		ConnectorMongoDB.DeleteMessage(idM)
+	// message and object are written through the outbox, see createPaste
+	if errCreate := createPaste(ctx, h.Objects, h.Messages, &newObject, requestData.Message); errCreate != nil {
 		http.Error(w,"Error: Cannot create paste", http.StatusInternalServerError)
-		log.Println("Error: Cannot create object for paste: "+ requestData.PasteKey + "!")
+		log.Println("Error: Cannot create paste: "+ pastekey + ": " + errCreate.Error())
 		return 
 	}
 
+	// a paste without the tags it was created with is taken back, the client can send it again
+	if len(tags) > 0 {
+		if errTags := h.Objects.SetPasteTags(ctx, newObject.PasteKey, tags); errTags != nil {
+			http.Error(w,"Error: Cannot create paste", http.StatusInternalServerError)
+			log.Println("Error: Cannot tag paste: "+ newObject.PasteKey + ": " + errTags.Error())
+			if errDelete := deletePaste(ctx, h.Objects, h.Messages, &newObject); errDelete != nil {
+				log.Println("Error: Cannot delete untagged paste: "+ newObject.PasteKey + ": " + errDelete.Error())
+			}
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	data,_ := json.Marshal(map[string]interface{}{"PasteKey": newObject.PasteKey})
 	w.Write(data)
@@ -115,17 +137,37 @@ func CreatePaste(w http.ResponseWriter, r *http.Request){
 }
 
 
-func GetPaste(w http.ResponseWriter, r *http.Request){
+// private pastes are visible only to their owner and the members of the organisation owning them
+func (h *Handlers) canReadPaste(r *http.Request, object *models.Object) bool {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if object.Visibility != models.VisibilityPrivate {
+		return true
+	}
+	return h.pasteAccess(ctx, principalFrom(r), object) >= accessRead
+}
+
+func (h *Handlers) GetPaste(w http.ResponseWriter, r *http.Request){
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
 	vars := mux.Vars(r)
 	pasteKey := vars["pasteKey"]
 
-	object, errObj := ConnectorPostgresDB.ReadObjectWithoutDevKey(context.Background(), pasteKey)
+	object, errObj := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
 	if errObj != nil {
 		http.Error(w,"Paste not found", http.StatusNotFound)
 		log.Println("Error: paste "+ pasteKey + " not found!")
 		return 
 	}
 
+	if !h.canReadPaste(r, object) {
+		http.Error(w,"Paste not found", http.StatusNotFound)
+		log.Println("Error: unauthorized access to private paste "+ pasteKey)
+		return
+	}
+
 	messageId, errMes := primitive.ObjectIDFromHex(object.MessageID)
 	if errMes != nil {
 		http.Error(w,"Error", http.StatusInternalServerError)
@@ -133,29 +175,38 @@ func GetPaste(w http.ResponseWriter, r *http.Request){
 		return 
 	}
 
-	message, errMsg := ConnectorMongoDB.ReadMessage(messageId);
+	message, errMsg := h.Messages.ReadMessage(ctx, messageId);
 	if errMsg!= nil {
 		http.Error(w,"Error: Cannot retrieve paste", http.StatusInternalServerError)
 		log.Println("Error: Cannot retrieve paste: "+ pasteKey + "!")
 		return 
 	}
 	
+	if errViews := h.Objects.IncrementObjectViews(ctx, pasteKey); errViews != nil {
+		log.Println("Error: Cannot increment views of paste: "+ pasteKey + ": " + errViews.Error())
+	}
+	if object.Visibility == models.VisibilityPublic {
+		if errTrend := h.Objects.RecordTrendingView(ctx, pasteKey, time.Now()); errTrend != nil {
+			log.Println("Error: Cannot record trending view of paste: "+ pasteKey + ": " + errTrend.Error())
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
-	data,_ := json.Marshal(map[string]interface{}{"Message": message.MessageBody})
+	data,_ := json.Marshal(map[string]interface{}{
+		"Message": message.MessageBody,
+		"Language": object.Language,
+		"Visibility": object.Visibility,
+		"Stars": object.Stars,
+	})
 	w.Write(data)
 }
 
 
-func DeletePaste(w http.ResponseWriter, r *http.Request){
-	mapClaims, error := ParseAccesToken(r)
-	if error != nil {
-		http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-		log.Println("Unauthorized access: Try to access " + r.URL.String())
-		return
-	}
+func (h *Handlers) DeletePaste(w http.ResponseWriter, r *http.Request){
+	ctx, cancel := dbContext(r)
+	defer cancel()
 
-	//usernameToken := mapClaims["username"].(string)
-	devKeyToken := mapClaims["devkey"].(string)
+	principal := principalFrom(r)
 
 	var requestData models.DeleteRequest
 
@@ -165,69 +216,39 @@ func DeletePaste(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
-	if requestData.PasteKey == "" || requestData.DevKey == "" {
+	if requestData.PasteKey == "" {
 		log.Println("Bad request for deleting paste: insufficient number of fields")
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	if devKeyToken != requestData.DevKey {
-		log.Println(devKeyToken)
-		log.Println(requestData.DevKey)
-
-		http.Error(w,"Not valid data!", http.StatusUnauthorized)
-		log.Println("Unauthorized function: Try to access " + r.URL.String() + " with different devkey")
-		return
-	}
-
 
-	// now call function to get Object 
-	object, errObj := ConnectorPostgresDB.ReadObject(context.Background(), requestData.PasteKey, requestData.DevKey)
+	// now call function to get Object, editors of an organisation can delete its pastes
+	object, errObj := h.readPasteWithAccess(ctx, principal, requestData.PasteKey, accessManage)
 	if errObj != nil {
 		http.Error(w,"Not valid data!", http.StatusBadRequest)
-		log.Println("Error: User devkey: " + requestData.DevKey + " tried to delete paste: " + requestData.PasteKey + " but paste doesnt exist or he is not authorized!")
-		return 
-	}
-
-	// delete message from MongoDb
-	messageId, errMes := primitive.ObjectIDFromHex(object.MessageID)
-	if errMes != nil {
-		http.Error(w,"Error", http.StatusInternalServerError)
-		log.Println("Error: Cannot convert from string to primitive.ObjectId")
+		log.Println("Error: User devkey: " + principal.DevKey + " tried to delete paste: " + requestData.PasteKey + " but paste doesnt exist or he is not authorized!")
 		return 
 	}
 
-	if deletedError := ConnectorMongoDB.DeleteMessage(messageId); deletedError != nil{
-		http.Error(w,"Error: Cannot delete paste", http.StatusBadRequest)
-		log.Println("Error: Cannot delete message: "+ object.MessageID + "!")
-		return 
-	}
-
-	// delete object from PostgresDb
-	errObj = ConnectorPostgresDB.DeleteObject(context.Background(), requestData.PasteKey, requestData.DevKey)
-	if errObj != nil {
+	// object is deleted before its message, see deletePaste
+	if errDelete := deletePaste(ctx, h.Objects, h.Messages, object); errDelete != nil {
 		http.Error(w,"Error: Cannot delete paste", http.StatusInternalServerError)
-		log.Println("Error: Cannot delete paste: "+ requestData.PasteKey + "!")
+		log.Println("Error: Cannot delete paste: "+ requestData.PasteKey + ": " + errDelete.Error())
 		return 
 	}
 
-	
 	w.WriteHeader(http.StatusAccepted)
 }
 
-func GetUserInfo(w http.ResponseWriter, r *http.Request){
-	log.Println("Dosao je zahtev")
-	mapClaims, error := ParseAccesToken(r)
-	if error != nil {
-		http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-		log.Println("Unauthorized access: Try to access " + r.URL.String())
-		return
-	}
+func (h *Handlers) GetUserInfo(w http.ResponseWriter, r *http.Request){
+	ctx, cancel := dbContext(r)
+	defer cancel()
 
-	username := mapClaims["username"].(string)
-	//devkey := mapClaims["devkey"].(string)
+	log.Println("Dosao je zahtev")
+	principal := principalFrom(r)
 
-	user, err := ConnectorPostgresDB.ReadUserByUsername(context.Background(), username);
+	user, err := h.Users.ReadUserById(ctx, principal.UserID);
 	if err!=nil{
 		log.Println(err)
 		http.Error(w,"Error: user doesn't exist", http.StatusNotFound)
@@ -238,76 +259,159 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request){
 	data,_ := json.Marshal(map[string]interface{}{
 		"username": user.Name,
 		"email": user.Email,
+		"emailVerified": user.EmailVerified,
 		"pastenum": user.PasteNum,
 		"devkey": user.DevKey,
+		"role": user.Role,
 	})
 	w.Write(data)
 }
 
-func GetUserPastes(w http.ResponseWriter, r *http.Request){
-	mapClaims, error := ParseAccesToken(r)
-	if error != nil {
-		http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-		log.Println("Unauthorized access: Try to access " + r.URL.String())
+// GetUserPastes returns one page of the user's pastes, see parseObjectQuery for the supported query parameters.
+// With content=preview only the first characters of each paste are returned instead of the whole message.
+// With include=orgs the pastes of the user's organisations are listed too, their devkey is the one of the organisation.
+func (h *Handlers) GetUserPastes(w http.ResponseWriter, r *http.Request){
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	devKeys := []string{principal.DevKey}
+	switch include := r.URL.Query().Get("include"); include {
+	case "":
+	case "orgs":
+		orgs, errOrgs := h.Users.ReadOrganisationsByUser(ctx, principal.UserID)
+		if errOrgs != nil {
+			http.Error(w,"Error: Cannot retrieve pastes", http.StatusInternalServerError)
+			log.Println("Error: Cannot read organisations: " + errOrgs.Error())
+			return
+		}
+		for _, org := range orgs {
+			devKeys = append(devKeys, org.DevKey)
+		}
+	default:
+		http.Error(w, "Bad Request: invalid include: " + include, http.StatusBadRequest)
+		return
+	}
+
+	pastes_arr, nextCursor, ok := h.readPastesPage(w, r, devKeys)
+	if !ok {
 		return
 	}
 
-	username := mapClaims["username"].(string)
-	devkey := mapClaims["devkey"].(string)
+	w.WriteHeader(http.StatusOK)
+	data,_ := json.Marshal(map[string]interface{}{
+		"username": principal.Username,
+		"devkey": principal.DevKey,
+		"pastes": pastes_arr,
+		"nextCursor": nextCursor,
+	})
+	w.Write(data)
+}
+
+// readPastesPage reads the page of pastes owned by the devkeys that the request asks for,
+// it answers the request itself when that fails
+func (h *Handlers) readPastesPage(w http.ResponseWriter, r *http.Request, devKeys []string) ([]models.PasteSummary, string, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	query, errQuery := parseObjectQuery(r)
+	if errQuery != nil {
+		log.Println("Bad request for pastes: " + errQuery.Error())
+		http.Error(w, "Bad Request: " + errQuery.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	content := r.URL.Query().Get("content")
+	if content != "" && content != "full" && content != "preview" {
+		http.Error(w, "Bad Request: invalid content: " + content, http.StatusBadRequest)
+		return nil, "", false
+	}
 
-	objects, err := ConnectorPostgresDB.ReadObjectsByDevKey(context.Background(), devkey);
+	objects, hasMore, err := h.Objects.ReadObjectsPageOfDevKeys(ctx, devKeys, query);
 	if err!=nil{
 		log.Println(err)
-		http.Error(w,"Error: User doesnt't exist", http.StatusNotFound)
-		return
+		http.Error(w,"Error: Cannot retrieve pastes", http.StatusInternalServerError)
+		return nil, "", false
 	} 
-	
-	// there is no pastes for that user
-	if len(objects) == 0 {
-		w.WriteHeader(http.StatusOK)
-		data,_:= json.Marshal(map[string]interface{}{
-			"username": username,
-			"devkey": devkey,
-			"pastes": make([]models.Paste, 0),
+
+	pastes_arr, errSummaries := h.buildPasteSummaries(ctx, objects, content == "preview")
+	if errSummaries != nil {
+		http.Error(w,"Error: Cannot retrieve pastes", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve pastes: " + errSummaries.Error())
+		return nil, "", false
+	}
+
+	nextCursor := ""
+	if hasMore {
+		last := &objects[len(objects)-1]
+		nextCursor = encodeCursor(models.ObjectCursor{
+			SortValue:	db.SortValue(last, query.SortBy),
+			PasteKey:	last.PasteKey,
 		})
-		w.Write(data)
-		return
+	}
+	return pastes_arr, nextCursor, true
+}
+
+// buildPasteSummaries loads tags and messages (or only their previews) of a page of objects
+func (h *Handlers) buildPasteSummaries(ctx context.Context, objects []models.Object, preview bool) ([]models.PasteSummary, error) {
+	pastes_arr := make([]models.PasteSummary, len(objects))
+	if len(objects) == 0 {
+		return pastes_arr, nil
 	}
 
 	primitive_ids := make([]primitive.ObjectID, len(objects))
-	mapIDs := make(map[primitive.ObjectID]string)
+	pasteKeys := make([]string, len(objects))
+	mapIndexes := make(map[primitive.ObjectID]int)
 
 	for i, object := range objects {
-		messageId, errMes := primitive.ObjectIDFromHex(object.MessageID)
-		if errMes != nil {
-			http.Error(w,"Error", http.StatusInternalServerError)
-			log.Println("Error: Cannot convert from string to primitive.ObjectId")
-			return 
+		messageId, err := primitive.ObjectIDFromHex(object.MessageID)
+		if err != nil {
+			return nil, err
 		}
 		primitive_ids[i] = messageId
-		mapIDs[messageId] = object.PasteKey
+		pasteKeys[i] = object.PasteKey
+		mapIndexes[messageId] = i
+
+		pastes_arr[i] = models.PasteSummary{
+			DevKey:		object.DevKey,
+			PasteKey:	object.PasteKey,
+			Language:	object.Language,
+			Visibility:	object.Visibility,
+			Views:		object.Views,
+			Stars:		object.Stars,
+			CreatedAt:	object.CreatedAt,
+			UpdatedAt:	object.UpdatedAt,
+		}
 	}
 
-	messages, errMsg := ConnectorMongoDB.ReadMessages(primitive_ids);
-	if errMsg!= nil {
-		http.Error(w,"Error: Cannot retrieve pastes", http.StatusInternalServerError)
-		log.Println("Error: Cannot retrieve pastes: !")
-		return 
+	tagsByPaste, err := h.Objects.ReadTagsForPastes(ctx, pasteKeys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pastes_arr {
+		pastes_arr[i].Tags = tagsByPaste[pastes_arr[i].PasteKey]
 	}
 
-	pastes_arr := make([]models.Paste, len(messages))
+	messages, err := h.readPasteMessages(ctx, primitive_ids, preview)
+	if err != nil {
+		return nil, err
+	}
 
-	for i, msg := range messages {
-		pastes_arr[i].PasteKey = mapIDs[msg.ID]
-		pastes_arr[i].Message = msg.MessageBody
-		pastes_arr[i].DevKey = devkey
+	for _, msg := range messages {
+		if preview {
+			pastes_arr[mapIndexes[msg.ID]].Preview = msg.MessageBody
+		} else {
+			pastes_arr[mapIndexes[msg.ID]].Message = msg.MessageBody
+		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	data,_ := json.Marshal(map[string]interface{}{
-		"username": username,
-		"devkey": devkey,
-		"pastes": pastes_arr,
-	})
-	w.Write(data)
-}
\ No newline at end of file
+	return pastes_arr, nil
+}
+
+func (h *Handlers) readPasteMessages(ctx context.Context, ids []primitive.ObjectID, preview bool) ([]models.Message, error) {
+	if preview {
+		return h.Messages.ReadMessagePreviews(ctx, ids, previewLength)
+	}
+	return h.Messages.ReadMessages(ctx, ids)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated user of a request, loaded by RequireAuth or OptionalAuth
+type Principal struct {
+	UserID   uuid.UUID
+	Username string
+	DevKey   string
+	Role     string
+	Scopes   []string
+	// TokenID and ExpiresAt describe the access token, requests made with an API key have none
+	TokenID   uuid.UUID
+	ExpiresAt time.Time
+}
+
+// HasScope reports if the principal may do what the scope allows
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+var (
+	errNoCredentials    = errors.New("Error: request has no credentials")
+	errAccountSuspended = errors.New("Error: account is suspended")
+)
+
+// PrincipalFromContext returns the principal stored by the authentication middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+// principalFrom returns the principal of the request, nil for anonymous requests
+func principalFrom(r *http.Request) *Principal {
+	principal, _ := PrincipalFromContext(r.Context())
+	return principal
+}
+
+// authenticate resolves the X-Api-Key header or the bearer access token to a principal.
+// The user is read from the database, so a changed devkey is used right away.
+func (h *Handlers) authenticate(r *http.Request) (*Principal, error) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return h.resolveApiKey(ctx, key)
+	}
+	if r.Header.Get("Authorization") == "" {
+		return nil, errNoCredentials
+	}
+
+	claims, err := h.parseAccessToken(r)
+	if err != nil {
+		return nil, err
+	}
+	// the user is read by id, a token doesn't carry over to a new account that took the username
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("Error: token has no user id!")
+	}
+	jti, err := tokenID(claims)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, fmt.Errorf("Error: token has no expiration!")
+	}
+
+	user, err := h.Users.ReadUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, errAccountSuspended
+	}
+
+	return &Principal{
+		UserID:    user.UserID,
+		Username:  user.Name,
+		DevKey:    user.DevKey,
+		Role:      user.Role,
+		Scopes:    allScopes,
+		TokenID:   jti,
+		ExpiresAt: expiresAt.Time,
+	}, nil
+}
+
+// withPrincipal authenticates the request and passes it on with the principal in its context.
+// Invalid credentials are always rejected, missing ones only when required is set.
+func withPrincipal(authenticate func(*http.Request) (*Principal, error), required bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticate(r)
+		if err != nil {
+			if errors.Is(err, errNoCredentials) && !required {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if errors.Is(err, errAccountSuspended) {
+				http.Error(w, "Account is suspended", http.StatusForbidden)
+				return
+			}
+			if !errors.Is(err, errNoCredentials) && !errors.Is(err, sql.ErrNoRows) {
+				log.Println("Error: Cannot authenticate request: " + err.Error())
+			}
+			http.Error(w, "You're Unauthorized due to invalid token", http.StatusUnauthorized)
+			log.Println("Unauthorized access: Try to access " + r.URL.String())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+	}
+}
+
+// RequireAuth lets only authenticated requests through to the handler
+func (h *Handlers) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return withPrincipal(h.authenticate, true, next)
+}
+
+// OptionalAuth loads the principal when the request has credentials, anonymous requests pass through
+func (h *Handlers) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return withPrincipal(h.authenticate, false, next)
+}
+
+// RequireScope rejects principals without the scope, it has to be wrapped by RequireAuth or OptionalAuth.
+// Sessions from login and the devkey have all scopes, API tokens only the ones they were created with.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal := principalFrom(r); principal != nil && !principal.HasScope(scope) {
+			http.Error(w, "Forbidden: API key is missing scope "+scope, http.StatusForbidden)
+			log.Println("Forbidden access: API key without scope " + scope + " used for " + r.URL.String())
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	// the requests are refused before a store is needed
+	h := &Handlers{}
+	var seen *Principal
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen = principalFrom(r)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	serve := func(middleware func(http.HandlerFunc) http.HandlerFunc, authorization string) int {
+		seen = nil
+		r := httptest.NewRequest("GET", "/api/getPaste/abc", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		middleware(handler)(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(h.RequireAuth, ""))
+	assert.Equal(t, http.StatusOK, serve(h.OptionalAuth, ""))
+	assert.Nil(t, seen, "Expected anonymous request to have no principal")
+
+	// invalid credentials are rejected even where they are optional
+	assert.Equal(t, http.StatusUnauthorized, serve(h.RequireAuth, "Bearer not-a-token"))
+	assert.Equal(t, http.StatusUnauthorized, serve(h.OptionalAuth, "Bearer not-a-token"))
+	assert.Equal(t, http.StatusUnauthorized, serve(h.OptionalAuth, "Basic abc"))
+}
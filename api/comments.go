@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxCommentLength = 10000
+
+// readCommentBody decodes a comment request and checks its body
+func readCommentBody(w http.ResponseWriter, r *http.Request) (models.CommentRequest, bool) {
+	var requestData models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return requestData, false
+	}
+
+	requestData.Body = strings.TrimSpace(requestData.Body)
+	if requestData.Body == "" || len(requestData.Body) > maxCommentLength {
+		http.Error(w, "Bad Request: invalid comment body", http.StatusBadRequest)
+		return requestData, false
+	}
+	return requestData, true
+}
+
+// readPasteLineCount returns the number of lines of the paste message
+func (h *Handlers) readPasteLineCount(ctx context.Context, object *models.Object) (int, error) {
+	messageId, err := primitive.ObjectIDFromHex(object.MessageID)
+	if err != nil {
+		return 0, err
+	}
+	message, err := h.Messages.ReadMessage(ctx, messageId)
+	if err != nil {
+		return 0, err
+	}
+	return strings.Count(message.MessageBody, "\n") + 1, nil
+}
+
+// buildCommentThreads nests replies under their parents, hidden comments keep their place
+// in the thread but their body is shown only to the paste owner and the comment author
+func buildCommentThreads(comments []models.Comment, viewerID uuid.UUID, isOwner bool) []*models.Comment {
+	byID := make(map[uuid.UUID]*models.Comment, len(comments))
+	for i := range comments {
+		comment := &comments[i]
+		comment.Replies = make([]*models.Comment, 0)
+		if comment.Hidden && !isOwner && comment.AuthorID != viewerID {
+			comment.Body = ""
+		}
+		byID[comment.CommentID] = comment
+	}
+
+	threads := make([]*models.Comment, 0)
+	for i := range comments {
+		comment := &comments[i]
+		if parent, ok := byID[derefUUID(comment.ParentID)]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			threads = append(threads, comment)
+		}
+	}
+	return threads
+}
+
+func derefUUID(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// GetPasteComments returns comment threads of a paste to everyone who can read the paste
+func (h *Handlers) GetPasteComments(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	object, errObj := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if errObj != nil || !h.canReadPaste(r, object) {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+
+	viewerID := uuid.Nil
+	isOwner := false
+	if principal := principalFrom(r); principal != nil {
+		viewerID = principal.UserID
+		isOwner = h.pasteAccess(ctx, principal, object) >= accessManage
+	}
+
+	comments, err := h.Comments.ReadCommentsByPaste(ctx, pasteKey)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve comments", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve comments of paste " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"pastekey":        pasteKey,
+		"commentsEnabled": object.CommentsEnabled,
+		"comments":        buildCommentThreads(comments, viewerID, isOwner),
+	})
+	w.Write(data)
+}
+
+// CreateComment adds a comment on the whole paste, on a line range of it, or a reply to another comment
+func (h *Handlers) CreateComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	requestData, ok := readCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	object, errObj := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if errObj != nil || !h.canReadPaste(r, object) {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+	if !object.CommentsEnabled {
+		http.Error(w, "Comments are disabled for this paste", http.StatusForbidden)
+		return
+	}
+
+	comment := models.Comment{
+		PasteKey:   pasteKey,
+		AuthorID:   principal.UserID,
+		AuthorName: principal.Username,
+		Body:       requestData.Body,
+		Replies:    make([]*models.Comment, 0),
+	}
+
+	if requestData.ParentID != "" {
+		// replies belong to the thread of their parent and don't have their own line range
+		parentID, err := uuid.Parse(requestData.ParentID)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid parent comment", http.StatusBadRequest)
+			return
+		}
+		parent, err := h.Comments.ReadComment(ctx, parentID)
+		if err != nil || parent.PasteKey != pasteKey {
+			http.Error(w, "Bad Request: invalid parent comment", http.StatusBadRequest)
+			return
+		}
+		comment.ParentID = &parentID
+	} else if requestData.LineStart != nil || requestData.LineEnd != nil {
+		if requestData.LineStart == nil {
+			requestData.LineStart = requestData.LineEnd
+		}
+		if requestData.LineEnd == nil {
+			requestData.LineEnd = requestData.LineStart
+		}
+
+		lineCount, err := h.readPasteLineCount(ctx, object)
+		if err != nil {
+			http.Error(w, "Error: Cannot create comment", http.StatusInternalServerError)
+			log.Println("Error: Cannot read paste " + pasteKey + " for comment: " + err.Error())
+			return
+		}
+		if *requestData.LineStart < 1 || *requestData.LineStart > *requestData.LineEnd || *requestData.LineEnd > lineCount {
+			http.Error(w, "Bad Request: invalid line range", http.StatusBadRequest)
+			return
+		}
+		comment.LineStart = requestData.LineStart
+		comment.LineEnd = requestData.LineEnd
+	}
+
+	if err := h.Comments.CreateComment(ctx, &comment); err != nil {
+		http.Error(w, "Error: Cannot create comment", http.StatusInternalServerError)
+		log.Println("Error: Cannot create comment on paste " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(comment)
+	w.Write(data)
+}
+
+// readCommentForChange loads the comment from the route
+func (h *Handlers) readCommentForChange(w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	commentID, err := uuid.Parse(mux.Vars(r)["commentId"])
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	comment, err := h.Comments.ReadComment(ctx, commentID)
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil, false
+	}
+	return comment, true
+}
+
+// isPasteOwner reports if the principal owns the paste the comment was made on, editors of
+// the organisation owning the paste count as owners
+func (h *Handlers) isPasteOwner(ctx context.Context, principal *Principal, pasteKey string) bool {
+	_, err := h.readPasteWithAccess(ctx, principal, pasteKey, accessManage)
+	return err == nil
+}
+
+// UpdateComment changes the body of a comment, only its author can do it
+func (h *Handlers) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	comment, ok := h.readCommentForChange(w, r)
+	if !ok {
+		return
+	}
+
+	requestData, ok := readCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.AuthorID != principal.UserID {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	if err := h.Comments.UpdateCommentBody(ctx, comment.CommentID, principal.UserID, requestData.Body); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot update comment", http.StatusInternalServerError)
+		log.Println("Error: Cannot update comment " + comment.CommentID.String() + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteComment removes a comment, its author and the paste owner can do it
+func (h *Handlers) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	comment, ok := h.readCommentForChange(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.AuthorID != principal.UserID && !h.isPasteOwner(ctx, principal, comment.PasteKey) {
+		http.Error(w, "Only the author or the paste owner can delete a comment", http.StatusForbidden)
+		return
+	}
+
+	if err := h.Comments.DeleteComment(ctx, comment.CommentID); err != nil {
+		http.Error(w, "Error: Cannot delete comment", http.StatusInternalServerError)
+		log.Println("Error: Cannot delete comment " + comment.CommentID.String() + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ModerateComment hides or shows a comment, only the paste owner can do it
+func (h *Handlers) ModerateComment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	comment, ok := h.readCommentForChange(w, r)
+	if !ok {
+		return
+	}
+
+	var requestData models.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if !h.isPasteOwner(ctx, principal, comment.PasteKey) {
+		http.Error(w, "Only the paste owner can moderate comments", http.StatusForbidden)
+		return
+	}
+
+	if err := h.Comments.SetCommentHidden(ctx, comment.CommentID, requestData.Hidden); err != nil {
+		http.Error(w, "Error: Cannot moderate comment", http.StatusInternalServerError)
+		log.Println("Error: Cannot moderate comment " + comment.CommentID.String() + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetCommentSettings turns comments on a paste on or off, only the paste owner can do it
+func (h *Handlers) SetCommentSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	var requestData models.CommentSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	object, err := h.readPasteWithAccess(ctx, principal, pasteKey, accessManage)
+	if err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Comments.SetCommentsEnabled(ctx, pasteKey, object.DevKey, requestData.Enabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Paste not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot change comment settings", http.StatusInternalServerError)
+		log.Println("Error: Cannot change comment settings of paste " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"pastebin/mail"
+	"pastebin/models"
+	"time"
+)
+
+const (
+	verifyEmailLifetime   = 24 * time.Hour
+	resetPasswordLifetime = time.Hour
+	maxEmailLength        = 254
+	// bounds reading the users and sending the emails after the response
+	backgroundMailTimeout = time.Minute
+	// bcrypt only uses the first 72 bytes of a password
+	maxPasswordLength = 72
+)
+
+// Mailer sends verification and password reset emails
+var Mailer mail.Mailer
+
+// AppURL is the address of the frontend, links in emails point to it. It is configured
+// and not taken from the request, so a forged Host header can't redirect reset links.
+var AppURL = "http://localhost:3000"
+
+// isValidEmail accepts a bare address like user@example.com, without display name
+func isValidEmail(email string) bool {
+	if email == "" || len(email) > maxEmailLength {
+		return false
+	}
+	address, err := netmail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// sendUserToken stores a new single use token for the user and emails a link with it
+func (h *Handlers) sendUserToken(ctx context.Context, user models.User, purpose string, lifetime time.Duration, subject, path, text string) error {
+	token, err := newRandomToken()
+	if err != nil {
+		return err
+	}
+
+	userToken := models.UserToken{
+		TokenHash: hashToken(token),
+		UserID:    user.UserID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := h.Accounts.CreateUserToken(ctx, &userToken); err != nil {
+		return err
+	}
+
+	link := AppURL + path + "?token=" + url.QueryEscape(token)
+	return Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s\n\n%s\n\nThe link expires in %s. If you didn't ask for this email, you can ignore it.\n", user.Name, text, link, lifetime),
+	})
+}
+
+func (h *Handlers) sendVerificationEmail(ctx context.Context, user models.User) error {
+	return h.sendUserToken(ctx, user, models.TokenPurposeVerifyEmail, verifyEmailLifetime,
+		"Verify your email", "/verify-email", "confirm your email address by opening this link:")
+}
+
+func (h *Handlers) sendPasswordResetEmail(ctx context.Context, user models.User) error {
+	return h.sendUserToken(ctx, user, models.TokenPurposeResetPassword, resetPasswordLifetime,
+		"Reset your password", "/reset-password", "you can choose a new password for your account by opening this link:")
+}
+
+// RequestEmailVerification sends a new verification email to the address of the user
+func (h *Handlers) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	user, err := h.Users.ReadUserById(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: user doesn't exist", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		http.Error(w, "Error: Cannot send verification email", http.StatusInternalServerError)
+		log.Println("Error: Cannot send verification email: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail confirms the email with the token from the verification email
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Token == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Accounts.UseUserToken(ctx, hashToken(requestData.Token), models.TokenPurposeVerifyEmail, time.Now())
+	if err == nil {
+		// the user may have changed the email after the link was sent
+		err = h.Accounts.VerifyUserEmail(ctx, token.UserID, token.Email)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error: Cannot verify email", http.StatusInternalServerError)
+		log.Println("Error: Cannot verify email: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RequestPasswordReset emails a reset link to every account with the email. The response is
+// the same whether an account exists or not and emails are sent in the background, so the
+// endpoint doesn't tell which emails are registered.
+func (h *Handlers) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var requestData models.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || !isValidEmail(requestData.Email) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// the emails are sent after the response, so they get a context that outlives the request
+	email := requestData.Email
+	h.runBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, backgroundMailTimeout)
+		defer cancel()
+		users, err := h.Accounts.ReadUsersByEmail(ctx, email)
+		if err != nil {
+			log.Println("Error: Cannot read users for password reset: " + err.Error())
+			return
+		}
+		for _, user := range users {
+			if err := h.sendPasswordResetEmail(ctx, user); err != nil {
+				log.Println("Error: Cannot send password reset email: " + err.Error())
+			}
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmPasswordReset sets a new password with the token from the reset email and revokes the
+// refresh tokens and API tokens of the user, access tokens work until they expire. Opening the link
+// proves the email belongs to the user, so it is verified too.
+func (h *Handlers) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.PasswordResetConfirm
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Token == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if problem := passwordProblem(requestData.Password, "", ""); problem != "" {
+		http.Error(w, "Bad Request: "+problem, http.StatusBadRequest)
+		return
+	}
+
+	hash, err := hashPassword(requestData.Password)
+	if err != nil {
+		http.Error(w, "Error: Cannot reset password", http.StatusInternalServerError)
+		log.Println("Error: Cannot hash password: " + err.Error())
+		return
+	}
+
+	token, err := h.Accounts.UseUserToken(ctx, hashToken(requestData.Token), models.TokenPurposeResetPassword, time.Now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error: Cannot reset password", http.StatusInternalServerError)
+		log.Println("Error: Cannot reset password: " + err.Error())
+		return
+	}
+
+	if err := h.Accounts.UpdateUserPassword(ctx, token.UserID, hash); err != nil {
+		http.Error(w, "Error: Cannot reset password", http.StatusInternalServerError)
+		log.Println("Error: Cannot reset password: " + err.Error())
+		return
+	}
+
+	if err := h.Logins.RevokeUserRefreshTokens(ctx, token.UserID); err != nil {
+		log.Println("Error: Cannot revoke sessions after password reset: " + err.Error())
+	}
+	if err := h.Accounts.RevokeUserApiTokens(ctx, token.UserID); err != nil {
+		log.Println("Error: Cannot revoke API tokens after password reset: " + err.Error())
+	}
+	// the user proved to own the account, a lockout caused by someone guessing the password ends
+	if user, err := h.Users.ReadUserById(ctx, token.UserID); err == nil {
+		h.clearUserLoginFailures(ctx, user.Name)
+	}
+	if err := h.Accounts.VerifyUserEmail(ctx, token.UserID, token.Email); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("Error: Cannot verify email after password reset: " + err.Error())
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
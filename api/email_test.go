@@ -0,0 +1,19 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidEmail(t *testing.T) {
+	assert.True(t, isValidEmail("user@example.com"))
+	assert.True(t, isValidEmail("first.last+tag@sub.example.org"))
+
+	assert.False(t, isValidEmail(""))
+	assert.False(t, isValidEmail("user"))
+	assert.False(t, isValidEmail("User <user@example.com>"), "Expected display names to be rejected")
+	assert.False(t, isValidEmail("user@example.com\r\nBcc: other@example.com"))
+	assert.False(t, isValidEmail(strings.Repeat("a", 250)+"@example.com"))
+}
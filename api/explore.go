@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"pastebin/db"
+	"pastebin/models"
+	"strconv"
+	"time"
+)
+
+// pastes whose trending score decayed below this many views drop out of the trending feed
+const minTrendingScore = 0.05
+
+// readFeedFormat returns "json", "rss" or "atom" from the format query parameter
+func readFeedFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		return "json", true
+	case "rss", "atom":
+		return format, true
+	default:
+		http.Error(w, "Bad Request: invalid format: "+format, http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// hideOwners removes devkeys from pastes shown to everyone, devkey is a secret of its owner
+func hideOwners(pastes []models.PasteSummary) {
+	for i := range pastes {
+		pastes[i].DevKey = ""
+	}
+}
+
+// GetArchive lists the most recent public pastes with previews, paginated like GetUserPastes
+func (h *Handlers) GetArchive(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	format, ok := readFeedFormat(w, r)
+	if !ok {
+		return
+	}
+
+	query, errQuery := parseObjectQuery(r)
+	if errQuery != nil {
+		http.Error(w, "Bad Request: "+errQuery.Error(), http.StatusBadRequest)
+		return
+	}
+	// tags and folders belong to their owners, they would leak which public pastes are whose
+	if query.Tag != "" || query.FolderID != "" {
+		http.Error(w, "Bad Request: the archive can't be filtered by tag or folder", http.StatusBadRequest)
+		return
+	}
+	query.SortBy = models.SortByCreated
+	query.Desc = true
+
+	objects, hasMore, err := h.Explore.ReadPublicObjectsPage(ctx, query)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve archive", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve archive: " + err.Error())
+		return
+	}
+
+	pastes, err := h.buildPasteSummaries(ctx, objects, true)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve archive", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve archive: " + err.Error())
+		return
+	}
+	hideOwners(pastes)
+
+	if format != "json" {
+		writeFeed(w, r, format, "Pastebin archive", pastes)
+		return
+	}
+
+	nextCursor := ""
+	if hasMore {
+		last := &objects[len(objects)-1]
+		nextCursor = encodeCursor(models.ObjectCursor{SortValue: db.SortValue(last, query.SortBy), PasteKey: last.PasteKey})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"pastes":     pastes,
+		"nextCursor": nextCursor,
+	})
+	w.Write(data)
+}
+
+// GetTrending lists public pastes ranked by views, each view counting less as it gets older
+func (h *Handlers) GetTrending(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	format, ok := readFeedFormat(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	objects, scores, err := h.Explore.ReadTrendingObjects(ctx, time.Now(), minTrendingScore, limit)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve trending pastes", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve trending pastes: " + err.Error())
+		return
+	}
+
+	pastes, err := h.buildPasteSummaries(ctx, objects, true)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve trending pastes", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve trending pastes: " + err.Error())
+		return
+	}
+	hideOwners(pastes)
+	for i := range pastes {
+		pastes[i].Score = scores[i]
+	}
+
+	if format != "json" {
+		writeFeed(w, r, format, "Pastebin trending", pastes)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"pastes": pastes})
+	w.Write(data)
+}
+
+// pruneTrending removes pastes that can no longer make it into the trending feed, the App runs it every hour
+func (h *Handlers) pruneTrending(ctx context.Context) {
+	pruned, err := h.Explore.PruneTrending(ctx, time.Now(), minTrendingScore)
+	if err != nil {
+		log.Println("Error: Cannot prune trending pastes: " + err.Error())
+		return
+	}
+	log.Printf("Pruned %d trending pastes\n", pruned)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"pastebin/models"
+	"time"
+)
+
+// RSS 2.0 and Atom documents for the public archive and trending feeds
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+// baseURL is the address the request came to, used for absolute links in feeds
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func pasteTitle(paste models.PasteSummary) string {
+	return fmt.Sprintf("%s (%s)", paste.PasteKey, paste.Language)
+}
+
+// writeFeed writes pastes as an RSS or Atom document, format is "rss" or "atom"
+func writeFeed(w http.ResponseWriter, r *http.Request, format, title string, pastes []models.PasteSummary) {
+	base := baseURL(r)
+	selfLink := base + r.URL.RequestURI()
+
+	var document interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+
+	if format == "atom" {
+		updated := time.Now().UTC()
+		if len(pastes) > 0 {
+			updated = pastes[0].CreatedAt
+		}
+		feed := atomFeed{
+			ID:      selfLink,
+			Title:   title,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: selfLink, Rel: "self"},
+		}
+		for _, paste := range pastes {
+			link := base + "/api/getPaste/" + paste.PasteKey
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:      link,
+				Title:   pasteTitle(paste),
+				Updated: paste.UpdatedAt.UTC().Format(time.RFC3339),
+				Link:    atomLink{Href: link},
+				Summary: paste.Preview,
+			})
+		}
+		document = feed
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		feed := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{Title: title, Link: selfLink, Description: title},
+		}
+		for _, paste := range pastes {
+			link := base + "/api/getPaste/" + paste.PasteKey
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       pasteTitle(paste),
+				Link:        link,
+				GUID:        link,
+				PubDate:     paste.CreatedAt.UTC().Format(time.RFC1123Z),
+				Description: paste.Preview,
+			})
+		}
+		document = feed
+	}
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		http.Error(w, "Error: Cannot create feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/db"
+	"pastebin/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const maxFolderNameLength = 64
+
+// isUniqueViolation reports if the database refused the write because of a unique constraint
+func isUniqueViolation(err error) bool {
+	_, ok := db.UniqueViolation(err)
+	return ok
+}
+
+// readFolderRequest decodes and validates the body of folder create and rename requests
+func readFolderRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var requestData models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return "", false
+	}
+
+	name := strings.TrimSpace(requestData.Name)
+	if name == "" || len(name) > maxFolderNameLength {
+		log.Println("Bad request for folder: invalid name")
+		http.Error(w, "Bad Request: invalid folder name", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+func (h *Handlers) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+
+	name, ok := readFolderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	folder := models.Folder{DevKey: devkey, Name: name}
+	if err := h.Library.CreateFolder(ctx, &folder); err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "Folder already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot create folder", http.StatusInternalServerError)
+		log.Println("Error: Cannot create folder: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(folder)
+	w.Write(data)
+}
+
+func (h *Handlers) GetFolders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+
+	folders, err := h.Library.ReadFoldersByDevKey(ctx, devkey)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve folders", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve folders: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"folders": folders})
+	w.Write(data)
+}
+
+func (h *Handlers) RenameFolder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+
+	folderID, err := uuid.Parse(mux.Vars(r)["folderId"])
+	if err != nil {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	name, ok := readFolderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Library.RenameFolder(ctx, folderID, devkey, name); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Folder not found", http.StatusNotFound)
+		case isUniqueViolation(err):
+			http.Error(w, "Folder already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Error: Cannot rename folder", http.StatusInternalServerError)
+			log.Println("Error: Cannot rename folder: " + err.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+
+	folderID, err := uuid.Parse(mux.Vars(r)["folderId"])
+	if err != nil {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Library.DeleteFolder(ctx, folderID, devkey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Folder not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot delete folder", http.StatusInternalServerError)
+		log.Println("Error: Cannot delete folder: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// MovePaste puts one of the user's pastes into one of their folders, an empty folderId takes it out of its folder
+func (h *Handlers) MovePaste(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	var requestData models.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if object, err := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey); err != nil || object.DevKey != devkey {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		log.Println("Error: User devkey: " + devkey + " tried to move paste: " + pasteKey + " but paste doesnt exist or he is not authorized!")
+		return
+	}
+
+	if requestData.FolderID == "" {
+		if err := h.Library.RemovePasteFromFolder(ctx, pasteKey); err != nil {
+			http.Error(w, "Error: Cannot move paste", http.StatusInternalServerError)
+			log.Println("Error: Cannot remove paste " + pasteKey + " from folder: " + err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	folderID, err := uuid.Parse(requestData.FolderID)
+	if err != nil {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	// the folder has to belong to the same user
+	if _, err := h.Library.ReadFolder(ctx, folderID, devkey); err != nil {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Library.MovePasteToFolder(ctx, pasteKey, folderID); err != nil {
+		http.Error(w, "Error: Cannot move paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot move paste " + pasteKey + " to folder: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"pastebin/db"
+	"pastebin/kgs"
+	"pastebin/models"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// dbTimeout bounds the database work of one request
+var dbTimeout = 10 * time.Second
+
+// dbContext returns the context for the database calls of a request, they are cancelled when the
+// client goes away or when they take longer than dbTimeout
+func dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), dbTimeout)
+}
+
+// Handlers serves the endpoints and authenticates requests with the stores it was constructed
+// with. The paste endpoints only need the first four, the in-memory stores of package db let
+// them run without databases.
+type Handlers struct {
+	Users     db.UserStore
+	Objects   db.ObjectStore
+	Messages  db.MessageStore
+	PasteKeys kgs.KGS
+	DevKeys   kgs.KGS
+	Accounts  db.AccountStore
+	Logins    db.LoginStore
+	Orgs      db.OrgStore
+	Admin     db.AdminStore
+	Library   db.LibraryStore
+	Comments  db.CommentStore
+	Shares    db.ShareStore
+	Explore   db.ExploreStore
+
+	// SSOProviders are the identity providers users can log in with by name, LoadSSOProviders
+	// prepares them from the config
+	SSOProviders map[string]*OIDCProvider
+
+	// Background runs work that continues after the response, the App waits for it when it stops.
+	// Without it the work runs in a goroutine of its own.
+	Background func(job func(ctx context.Context))
+}
+
+// NewHandlers serves the paste endpoints, Routes leaves out the endpoints of the other stores
+func NewHandlers(users db.UserStore, objects db.ObjectStore, messages db.MessageStore, pasteKeys kgs.KGS) *Handlers {
+	return &Handlers{Users: users, Objects: objects, Messages: messages, PasteKeys: pasteKeys}
+}
+
+// NewStoreHandlers serves every endpoint from one Postgres or SQLite store
+func NewStoreHandlers(store *db.PostgresDB, messages db.MessageStore, pasteKeys, devKeys kgs.KGS) *Handlers {
+	return &Handlers{
+		Users:     store,
+		Objects:   store,
+		Messages:  messages,
+		PasteKeys: pasteKeys,
+		DevKeys:   devKeys,
+		Accounts:  store,
+		Logins:    store,
+		Orgs:      store,
+		Admin:     store,
+		Library:   store,
+		Comments:  store,
+		Shares:    store,
+		Explore:   store,
+	}
+}
+
+// runBackground runs job after the response is sent, with Background when it is set
+func (h *Handlers) runBackground(job func(ctx context.Context)) {
+	if h.Background != nil {
+		h.Background(job)
+		return
+	}
+	go job(context.Background())
+}
+
+// Routes registers the endpoints of the stores that are set. The paste endpoints only need Users,
+// Objects, Messages and PasteKeys, the others are left out when their stores are nil, as with
+// NewHandlers.
+func (h *Handlers) Routes(r *mux.Router) {
+	r.HandleFunc("/api/createPaste", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.CreatePaste))).Methods("POST")
+	r.HandleFunc("/api/getPaste/{pasteKey}", h.OptionalAuth(RequireScope(models.ScopePasteRead, h.GetPaste))).Methods("GET")
+	r.HandleFunc("/api/deletePaste", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.DeletePaste))).Methods("POST")
+	r.HandleFunc("/api/getUserInfo", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetUserInfo))).Methods("GET")
+	r.HandleFunc("/api/getUserPastes", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetUserPastes))).Methods("GET")
+	r.HandleFunc("/api/pastes/{pasteKey}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.UpdatePaste))).Methods("PUT")
+	r.HandleFunc("/api/tags/{tag}/pastes", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetUserPastes))).Methods("GET")
+	r.HandleFunc("/api/folders/{folderId}/pastes", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetUserPastes))).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", JWKSHandler).Methods("GET")
+	r.HandleFunc("/api/sso/providers", h.GetSSOProviders).Methods("GET")
+	r.HandleFunc("/api/check", h.RequireAuth(ChekerHandler)).Methods("GET")
+	r.HandleFunc("/api/checkandparse", h.RequireAuth(ChekerHandlerParseToken)).Methods("GET")
+	r.HandleFunc("/api/pastes/{pasteKey}/tags", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.SetPasteTags))).Methods("PUT")
+	r.HandleFunc("/api/orgs", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetOrganisations))).Methods("GET")
+	r.HandleFunc("/api/orgs/{orgId}/pastes", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetOrgPastes))).Methods("GET")
+
+	if h.Accounts != nil && h.Logins != nil && h.Orgs != nil && h.DevKeys != nil {
+		// accounts, sessions and 2FA
+		r.HandleFunc("/api/register", h.RegisterHandler).Methods("POST")
+		r.HandleFunc("/api/login", h.LoginHandler).Methods("POST")
+		r.HandleFunc("/api/login/2fa", h.TwoFactorLoginHandler).Methods("POST")
+		r.HandleFunc("/api/sso/{provider}/login", h.StartSSOLogin).Methods("GET")
+		r.HandleFunc("/api/sso/{provider}/callback", h.FinishSSOLogin).Methods("POST")
+		r.HandleFunc("/api/token/refresh", h.RefreshTokenHandler).Methods("POST")
+		r.HandleFunc("/api/2fa", h.RequireAuth(RequireScope(models.ScopeAccount, h.GetTwoFactorStatus))).Methods("GET")
+		r.HandleFunc("/api/2fa/enroll", h.RequireAuth(RequireScope(models.ScopeAccount, h.EnrollTotp))).Methods("POST")
+		r.HandleFunc("/api/2fa/enable", h.RequireAuth(RequireScope(models.ScopeAccount, h.EnableTotp))).Methods("POST")
+		r.HandleFunc("/api/2fa/disable", h.RequireAuth(RequireScope(models.ScopeAccount, h.DisableTotp))).Methods("POST")
+		r.HandleFunc("/api/2fa/recovery-codes", h.RequireAuth(RequireScope(models.ScopeAccount, h.RegenerateRecoveryCodes))).Methods("POST")
+		r.HandleFunc("/api/email/verification", h.RequireAuth(RequireScope(models.ScopeAccount, h.RequestEmailVerification))).Methods("POST")
+		r.HandleFunc("/api/email/verify", h.VerifyEmail).Methods("POST")
+		r.HandleFunc("/api/password/reset", h.RequestPasswordReset).Methods("POST")
+		r.HandleFunc("/api/password/reset/confirm", h.ConfirmPasswordReset).Methods("POST")
+		r.HandleFunc("/api/logout", h.RequireAuth(RequireScope(models.ScopeAccount, h.LogoutHandler))).Methods("POST")
+		r.HandleFunc("/api/me/tokens", h.RequireAuth(RequireScope(models.ScopeAccount, h.CreateApiToken))).Methods("POST")
+		r.HandleFunc("/api/me/tokens", h.RequireAuth(RequireScope(models.ScopeAccount, h.GetApiTokens))).Methods("GET")
+		r.HandleFunc("/api/me/tokens/{tokenId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.RevokeApiToken))).Methods("DELETE")
+		r.HandleFunc("/api/me", h.RequireAuth(RequireScope(models.ScopeAccount, h.DeleteAccount))).Methods("DELETE")
+		r.HandleFunc("/api/me/email", h.RequireAuth(RequireScope(models.ScopeAccount, h.ChangeEmail))).Methods("PUT")
+		r.HandleFunc("/api/me/password", h.RequireAuth(RequireScope(models.ScopeAccount, h.ChangePassword))).Methods("PUT")
+		r.HandleFunc("/api/me/devkey", h.RequireAuth(RequireScope(models.ScopeAccount, h.RegenerateDevKey))).Methods("POST")
+	}
+
+	if h.Shares != nil {
+		// sharing with users, organisations and links
+		r.HandleFunc("/api/pastes/{pasteKey}/grants", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.GetPasteGrants))).Methods("GET")
+		r.HandleFunc("/api/pastes/{pasteKey}/grants", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.SetPasteGrant))).Methods("PUT")
+		r.HandleFunc("/api/pastes/{pasteKey}/grants/{granteeType}/{granteeId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.DeletePasteGrant))).Methods("DELETE")
+		r.HandleFunc("/api/pastes/{pasteKey}/links", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.GetShareLinks))).Methods("GET")
+		r.HandleFunc("/api/pastes/{pasteKey}/links", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.CreateShareLink))).Methods("POST")
+		r.HandleFunc("/api/pastes/{pasteKey}/links/{linkId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.RevokeShareLink))).Methods("DELETE")
+		r.HandleFunc("/api/shared/{token}", h.GetSharedPaste).Methods("GET")
+	}
+
+	if h.Library != nil {
+		// folders, tags and stars
+		r.HandleFunc("/api/pastes/{pasteKey}/folder", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.MovePaste))).Methods("PUT")
+		r.HandleFunc("/api/tags", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetTags))).Methods("GET")
+		r.HandleFunc("/api/folders", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.CreateFolder))).Methods("POST")
+		r.HandleFunc("/api/folders", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetFolders))).Methods("GET")
+		r.HandleFunc("/api/folders/{folderId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.RenameFolder))).Methods("PUT")
+		r.HandleFunc("/api/folders/{folderId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.DeleteFolder))).Methods("DELETE")
+		r.HandleFunc("/api/pastes/{pasteKey}/star", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.StarPaste))).Methods("POST")
+		r.HandleFunc("/api/pastes/{pasteKey}/star", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.UnstarPaste))).Methods("DELETE")
+		r.HandleFunc("/api/me/stars", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetStarredPastes))).Methods("GET")
+	}
+
+	if h.Comments != nil {
+		// comments of pastes
+		r.HandleFunc("/api/pastes/{pasteKey}/comments", h.OptionalAuth(RequireScope(models.ScopePasteRead, h.GetPasteComments))).Methods("GET")
+		r.HandleFunc("/api/pastes/{pasteKey}/comments", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.CreateComment))).Methods("POST")
+		r.HandleFunc("/api/pastes/{pasteKey}/comments/settings", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.SetCommentSettings))).Methods("PUT")
+		r.HandleFunc("/api/comments/{commentId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.UpdateComment))).Methods("PUT")
+		r.HandleFunc("/api/comments/{commentId}", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.DeleteComment))).Methods("DELETE")
+		r.HandleFunc("/api/comments/{commentId}/moderation", h.RequireAuth(RequireScope(models.ScopePasteWrite, h.ModerateComment))).Methods("PUT")
+	}
+
+	if h.Orgs != nil && h.DevKeys != nil {
+		// organisations and invitations
+		r.HandleFunc("/api/orgs", h.RequireAuth(RequireScope(models.ScopeAccount, h.CreateOrganisation))).Methods("POST")
+		r.HandleFunc("/api/orgs/{orgId}", h.RequireAuth(RequireScope(models.ScopePasteRead, h.GetOrganisation))).Methods("GET")
+		r.HandleFunc("/api/orgs/{orgId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.DeleteOrganisation))).Methods("DELETE")
+		r.HandleFunc("/api/orgs/{orgId}/invitations", h.RequireAuth(RequireScope(models.ScopeAccount, h.InviteToOrganisation))).Methods("POST")
+		r.HandleFunc("/api/orgs/{orgId}/invitations", h.RequireAuth(RequireScope(models.ScopeAccount, h.GetOrgInvitations))).Methods("GET")
+		r.HandleFunc("/api/orgs/{orgId}/invitations/{invitationId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.RevokeOrgInvitation))).Methods("DELETE")
+		r.HandleFunc("/api/orgs/{orgId}/members/{userId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.SetOrgMemberRole))).Methods("PUT")
+		r.HandleFunc("/api/orgs/{orgId}/members/{userId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.RemoveOrgMember))).Methods("DELETE")
+		r.HandleFunc("/api/me/invitations", h.RequireAuth(RequireScope(models.ScopeAccount, h.GetMyInvitations))).Methods("GET")
+		r.HandleFunc("/api/me/invitations/{invitationId}/accept", h.RequireAuth(RequireScope(models.ScopeAccount, h.AcceptInvitation))).Methods("POST")
+		r.HandleFunc("/api/me/invitations/{invitationId}", h.RequireAuth(RequireScope(models.ScopeAccount, h.DeclineInvitation))).Methods("DELETE")
+	}
+
+	if h.Admin != nil && h.Logins != nil && h.PasteKeys != nil && h.DevKeys != nil {
+		// moderation
+		r.HandleFunc("/api/admin/users", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleModerator, h.AdminListUsers)))).Methods("GET")
+		r.HandleFunc("/api/admin/users/{userId}/role", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleAdmin, h.AdminSetRole)))).Methods("PUT")
+		r.HandleFunc("/api/admin/users/{userId}/suspension", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleModerator, h.AdminSuspendUser)))).Methods("PUT")
+		r.HandleFunc("/api/admin/users/{userId}/suspension", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleModerator, h.AdminUnsuspendUser)))).Methods("DELETE")
+		r.HandleFunc("/api/admin/pastes/{pasteKey}", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleModerator, h.AdminReadPaste)))).Methods("GET")
+		r.HandleFunc("/api/admin/pastes/{pasteKey}", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleModerator, h.AdminDeletePaste)))).Methods("DELETE")
+		r.HandleFunc("/api/admin/kgs", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleAdmin, h.AdminKgsStats)))).Methods("GET")
+		r.HandleFunc("/api/admin/audit", h.RequireAuth(RequireScope(models.ScopeAccount, RequireRole(models.RoleAdmin, h.AdminGetAudit)))).Methods("GET")
+	}
+
+	if h.Explore != nil {
+		// public pastes
+		r.HandleFunc("/api/archive", h.GetArchive).Methods("GET")
+		r.HandleFunc("/api/trending", h.GetTrending).Methods("GET")
+	}
+}
@@ -0,0 +1,607 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pastebin/db"
+	"pastebin/kgs"
+	"pastebin/models"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testStore is what the tests use of the stores besides the interfaces, both MemoryDB and
+// the SQLite PostgresDB have it
+type testStore interface {
+	db.UserStore
+	db.ObjectStore
+	RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	CreateApiToken(ctx context.Context, token *models.ApiToken) error
+	CreateOrganisation(ctx context.Context, org *models.Organisation, ownerID uuid.UUID) error
+	SetPasteGrant(ctx context.Context, grant *models.PasteGrant) error
+	ReadPendingOutboxEntries(ctx context.Context) ([]models.OutboxEntry, error)
+}
+
+// testServer runs the handlers on the in-memory stores, or on a SQLite file when TEST_STORE=sqlite
+type testServer struct {
+	t      *testing.T
+	users  testStore
+	server *httptest.Server
+}
+
+func newTestServer(t *testing.T) *testServer {
+	switch os.Getenv("TEST_STORE") {
+	case "sqlite":
+		return newStoreTestServer(t)
+	case "", "memory":
+		store := db.NewMemoryDB()
+		return startTestServer(t, store, NewHandlers(store, store, db.NewMemoryMessageDB(), kgs.NewMemory()))
+	default:
+		t.Fatal("TEST_STORE must be memory or sqlite")
+		return nil
+	}
+}
+
+// newStoreTestServer runs every endpoint on a SQLite file, the in-memory stores only have what the
+// paste endpoints need
+func newStoreTestServer(t *testing.T) *testServer {
+	store, h := newStoreHandlers(t)
+	return startTestServer(t, store, h)
+}
+
+// newStoreHandlers serves every endpoint from a SQLite file, tests can replace some of the stores
+func newStoreHandlers(t *testing.T) (*db.PostgresDB, *Handlers) {
+	conn, err := db.ConnectToSQLiteDb(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DisconnectFromSQLiteDb(conn) })
+	store, keys := db.NewSQLiteDB(conn), kgs.GetSQLiteInstance(context.Background(), conn)
+	return store, NewStoreHandlers(store, db.NewSQLiteMessageDB(conn), keys, keys)
+}
+
+func startTestServer(t *testing.T, store testStore, h *Handlers) *testServer {
+	ring := NewKeyRing()
+	assert.NoError(t, ring.AddKey("test", "HS256", []byte("0123456789abcdef0123456789abcdef")))
+	assert.NoError(t, ring.SetActive("test"))
+	SigningKeys = ring
+
+	r := mux.NewRouter()
+	h.Routes(r)
+
+	s := &testServer{t: t, users: store, server: httptest.NewServer(r)}
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// createUser stores a user and returns an access token for it
+func (s *testServer) createUser(name string) (models.User, string) {
+	user := models.User{Name: name, Password: "pw", DevKey: name + "_dev_key", Email: name + "@example.com"}
+	_, err := s.users.CreateUser(context.Background(), &user)
+	assert.NoError(s.t, err)
+
+	token, err := CreateNewToken(user.UserID, user.Name, user.DevKey, user.Role)
+	assert.NoError(s.t, err)
+	return user, token
+}
+
+// do sends the request with the token, when there is one, and decodes a JSON answer into out
+func (s *testServer) do(method, path, token string, body interface{}, out interface{}) int {
+	var reader bytes.Buffer
+	if body != nil {
+		assert.NoError(s.t, json.NewEncoder(&reader).Encode(body))
+	}
+	req, err := http.NewRequest(method, s.server.URL+path, &reader)
+	assert.NoError(s.t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.server.Client().Do(req)
+	assert.NoError(s.t, err)
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		assert.NoError(s.t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func (s *testServer) createPaste(token string, paste models.Paste) string {
+	var created map[string]string
+	assert.Equal(s.t, http.StatusCreated, s.do("POST", "/api/createPaste", token, paste, &created))
+	return created["PasteKey"]
+}
+
+func TestHandlersAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("alice")
+
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/api/getUserInfo", "", nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/api/getUserInfo", "not-a-token", nil, nil))
+
+	var info map[string]interface{}
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getUserInfo", token, nil, &info))
+	assert.Equal(t, "alice", info["username"])
+	assert.Equal(t, user.DevKey, info["devkey"])
+	assert.Equal(t, models.RoleUser, info["role"])
+
+	// tokens name the user by id, a token for another account with the same name is refused
+	other, err := CreateNewToken(uuid.New(), "alice", user.DevKey, models.RoleUser)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/api/getUserInfo", other, nil, nil))
+
+	// revoked tokens are refused
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	assert.NoError(t, err)
+	jti, err := tokenID(parsed.Claims.(jwt.MapClaims))
+	assert.NoError(t, err)
+	assert.NoError(t, s.users.RevokeAccessToken(context.Background(), jti, time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/api/getUserInfo", token, nil, nil))
+}
+
+func TestHandlersRoutesWithoutStores(t *testing.T) {
+	store := db.NewMemoryDB()
+	h := NewHandlers(store, store, db.NewMemoryMessageDB(), kgs.NewMemory())
+	s := startTestServer(t, store, h)
+	_, token := s.createUser("alice")
+
+	// every route NewHandlers registers runs on the stores it was given
+	r := mux.NewRouter()
+	h.Routes(r)
+	placeholder := regexp.MustCompile(`\{[^}]+\}`)
+	routes := 0
+	assert.NoError(t, r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		path := placeholder.ReplaceAllString(template, "x")
+		for _, method := range methods {
+			for _, authorization := range []string{"", "Bearer " + token} {
+				req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+				if authorization != "" {
+					req.Header.Set("Authorization", authorization)
+				}
+				assert.NotPanics(t, func() { r.ServeHTTP(httptest.NewRecorder(), req) }, method+" "+template)
+			}
+			routes++
+		}
+		return nil
+	}))
+	assert.NotZero(t, routes)
+
+	// the endpoints of the stores that are not set are not served
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/api/login", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandlersApiToken(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.createUser("alice")
+
+	key := apiTokenPrefix + "secret"
+	apiToken := models.ApiToken{UserID: user.UserID, Name: "ci", TokenHash: hashToken(key), Scopes: []string{models.ScopePasteRead}}
+	assert.NoError(t, s.users.CreateApiToken(context.Background(), &apiToken))
+
+	call := func(method, path string, body interface{}) int {
+		var reader bytes.Buffer
+		assert.NoError(t, json.NewEncoder(&reader).Encode(body))
+		req := httptest.NewRequest(method, path, &reader)
+		req.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		s.server.Config.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("GET", "/api/getUserPastes", nil))
+	assert.Equal(t, http.StatusForbidden, call("POST", "/api/createPaste", models.Paste{Message: "hello"}))
+
+	// the devkey works with pastes but can't manage the account
+	principal, err := NewHandlers(s.users, s.users, nil, nil).resolveApiKey(context.Background(), user.DevKey)
+	assert.NoError(t, err)
+	assert.True(t, principal.HasScope(models.ScopePasteWrite))
+	assert.False(t, principal.HasScope(models.ScopeAccount))
+}
+
+func TestHandlersPasteLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.createUser("alice")
+	_, bob := s.createUser("bob")
+
+	pasteKey := s.createPaste(alice, models.Paste{Message: "hello world", Language: "go", Tags: []string{"demo"}})
+	assert.NotEmpty(t, pasteKey)
+
+	// public pastes can be read by anyone
+	var paste map[string]interface{}
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getPaste/"+pasteKey, "", nil, &paste))
+	assert.Equal(t, "hello world", paste["Message"])
+	assert.Equal(t, "go", paste["Language"])
+
+	// only the owner can change or delete it
+	update := models.PasteUpdateRequest{Message: "changed"}
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/pastes/"+pasteKey, bob, update, nil))
+	assert.Equal(t, http.StatusOK, s.do("PUT", "/api/pastes/"+pasteKey, alice, update, nil))
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getPaste/"+pasteKey, "", nil, &paste))
+	assert.Equal(t, "changed", paste["Message"])
+
+	deleteRequest := models.DeleteRequest{PasteKey: pasteKey}
+	assert.Equal(t, http.StatusBadRequest, s.do("POST", "/api/deletePaste", bob, deleteRequest, nil))
+	assert.Equal(t, http.StatusAccepted, s.do("POST", "/api/deletePaste", alice, deleteRequest, nil))
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/getPaste/"+pasteKey, "", nil, nil))
+
+	// creating and deleting committed their outbox entries
+	pending, err := s.users.ReadPendingOutboxEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// failingTags is a MemoryDB that can't store tags
+type failingTags struct {
+	*db.MemoryDB
+}
+
+func (failingTags) SetPasteTags(ctx context.Context, pasteKey string, tags []string) error {
+	return errors.New("tags are not stored")
+}
+
+func TestHandlersCreatePasteTagFailure(t *testing.T) {
+	store, messages := failingTags{db.NewMemoryDB()}, db.NewMemoryMessageDB()
+	s := startTestServer(t, store, NewHandlers(store, store, messages, kgs.NewMemory()))
+	_, alice := s.createUser("alice")
+
+	paste := models.Paste{PasteKey: "tagged", Message: "hello", Tags: []string{"demo"}}
+	assert.Equal(t, http.StatusInternalServerError, s.do("POST", "/api/createPaste", alice, paste, nil))
+
+	// the paste is taken back through the outbox
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/getPaste/tagged", "", nil, nil))
+	pending, err := store.ReadPendingOutboxEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	var ids int
+	assert.NoError(t, messages.ReadMessageIDs(context.Background(), func(primitive.ObjectID) error {
+		ids++
+		return nil
+	}))
+	assert.Zero(t, ids)
+}
+
+// failingUpdates is a MemoryDB that can't update Objects
+type failingUpdates struct {
+	*db.MemoryDB
+}
+
+func (failingUpdates) UpdateObject(ctx context.Context, object *models.Object) error {
+	return errors.New("objects are not updated")
+}
+
+func TestHandlersUpdatePasteFailure(t *testing.T) {
+	store := failingUpdates{db.NewMemoryDB()}
+	s := startTestServer(t, store, NewHandlers(store, store, db.NewMemoryMessageDB(), kgs.NewMemory()))
+	_, alice := s.createUser("alice")
+	pasteKey := s.createPaste(alice, models.Paste{Message: "hello"})
+
+	update := models.PasteUpdateRequest{Message: "changed"}
+	assert.Equal(t, http.StatusInternalServerError, s.do("PUT", "/api/pastes/"+pasteKey, alice, update, nil))
+}
+
+func TestHandlersPrivatePaste(t *testing.T) {
+	s := newTestServer(t)
+	_, alice := s.createUser("alice")
+	bob, bobToken := s.createUser("bob")
+
+	pasteKey := s.createPaste(alice, models.Paste{Message: "secret", Visibility: models.VisibilityPrivate})
+
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/getPaste/"+pasteKey, "", nil, nil))
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/getPaste/"+pasteKey, bobToken, nil, nil))
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getPaste/"+pasteKey, alice, nil, nil))
+
+	// a read grant lets bob read but not change it
+	grant := models.PasteGrant{PasteKey: pasteKey, GranteeType: models.GranteeUser, GranteeID: bob.UserID, Permission: models.PermissionRead}
+	assert.NoError(t, s.users.SetPasteGrant(context.Background(), &grant))
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getPaste/"+pasteKey, bobToken, nil, nil))
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/pastes/"+pasteKey, bobToken, models.PasteUpdateRequest{Message: "mine"}, nil))
+
+	grant.Permission = models.PermissionEdit
+	assert.NoError(t, s.users.SetPasteGrant(context.Background(), &grant))
+	assert.Equal(t, http.StatusOK, s.do("PUT", "/api/pastes/"+pasteKey, bobToken, models.PasteUpdateRequest{Message: "mine"}, nil))
+}
+
+func TestHandlersOrganisationPastes(t *testing.T) {
+	s := newTestServer(t)
+	alice, aliceToken := s.createUser("alice")
+	_, bobToken := s.createUser("bob")
+
+	org := models.Organisation{Name: "Team", DevKey: "team_dev_key"}
+	assert.NoError(t, s.users.CreateOrganisation(context.Background(), &org, alice.UserID))
+
+	paste := models.Paste{Message: "team paste", OrgID: org.OrgID.String()}
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/api/createPaste", bobToken, paste, nil))
+	pasteKey := s.createPaste(aliceToken, paste)
+	s.createPaste(aliceToken, models.Paste{Message: "own paste"})
+
+	var page struct {
+		Pastes []models.PasteSummary `json:"pastes"`
+	}
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getUserPastes", aliceToken, nil, &page))
+	assert.Len(t, page.Pastes, 1)
+
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getUserPastes?include=orgs", aliceToken, nil, &page))
+	assert.Len(t, page.Pastes, 2)
+	for _, summary := range page.Pastes {
+		if summary.PasteKey == pasteKey {
+			assert.Equal(t, org.DevKey, summary.DevKey)
+			assert.Equal(t, "team paste", summary.Message)
+		}
+	}
+}
+
+func TestHandlersUserPastesPagination(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createUser("alice")
+
+	for _, message := range []string{"one", "two", "three"} {
+		s.createPaste(token, models.Paste{Message: message, Tags: []string{"numbers"}})
+	}
+	s.createPaste(token, models.Paste{Message: "other"})
+
+	var page struct {
+		Pastes     []models.PasteSummary `json:"pastes"`
+		NextCursor string                `json:"nextCursor"`
+	}
+	seen := make(map[string]bool)
+	path := "/api/tags/numbers/pastes?limit=2&content=preview"
+	for {
+		assert.Equal(t, http.StatusOK, s.do("GET", path, token, nil, &page))
+		for _, summary := range page.Pastes {
+			assert.False(t, seen[summary.PasteKey])
+			assert.Equal(t, []string{"numbers"}, summary.Tags)
+			seen[summary.PasteKey] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/api/tags/numbers/pastes?limit=2&content=preview&cursor=" + page.NextCursor
+	}
+	assert.Len(t, seen, 3)
+
+	assert.Equal(t, http.StatusBadRequest, s.do("GET", "/api/getUserPastes?content=everything", token, nil, nil))
+}
+
+// blockingMessages holds ReadMessage until its context ends, like a query on a slow database, and
+// sends the reason it was aborted
+type blockingMessages struct {
+	*db.MemoryMessageDB
+	started chan struct{}
+	aborted chan error
+}
+
+func (m blockingMessages) ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
+	close(m.started)
+	<-ctx.Done()
+	m.aborted <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestHandlersFolders(t *testing.T) {
+	s := newStoreTestServer(t)
+	_, alice := s.createUser("alice")
+	_, bob := s.createUser("bob")
+	own := s.createPaste(alice, models.Paste{Message: "mine"})
+	other := s.createPaste(bob, models.Paste{Message: "not mine"})
+
+	var folder models.Folder
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/folders", alice, models.FolderRequest{Name: "notes"}, &folder))
+	move := models.MoveRequest{FolderID: folder.FolderID.String()}
+	assert.Equal(t, http.StatusOK, s.do("PUT", "/api/pastes/"+own+"/folder", alice, move, nil))
+	// pastes of other users can't be moved into the folder
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/pastes/"+other+"/folder", alice, move, nil))
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/pastes/"+own+"/folder", bob, models.MoveRequest{}, nil))
+
+	var listed struct{ Folders []models.Folder }
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/folders", alice, nil, &listed))
+	if assert.Len(t, listed.Folders, 1) {
+		assert.Equal(t, 1, listed.Folders[0].PasteNum)
+	}
+}
+
+// brokenTotp is a LoginStore that can't read 2FA settings, like a database that is down
+type brokenTotp struct {
+	db.LoginStore
+}
+
+func (brokenTotp) ReadTotp(ctx context.Context, userID uuid.UUID) (*models.UserTotp, error) {
+	return nil, errors.New("database is down")
+}
+
+func TestHandlersTwoFactorFailsClosed(t *testing.T) {
+	store, h := newStoreHandlers(t)
+	h.Logins = brokenTotp{h.Logins}
+	s := startTestServer(t, store, h)
+	_, token := s.createUser("alice")
+
+	// without the 2FA settings the login doesn't know if a second factor is needed
+	var session map[string]interface{}
+	assert.Equal(t, http.StatusInternalServerError, s.do("POST", "/api/login", "", models.UserLogin{Username: "alice", Password: "pw"}, &session))
+	assert.Empty(t, session)
+
+	code := models.TotpCodeRequest{Code: "123456"}
+	assert.Equal(t, http.StatusInternalServerError, s.do("POST", "/api/2fa/enable", token, code, nil))
+	assert.Equal(t, http.StatusInternalServerError, s.do("POST", "/api/2fa/disable", token, code, nil))
+	assert.Equal(t, http.StatusInternalServerError, s.do("POST", "/api/2fa/recovery-codes", token, code, nil))
+}
+
+func TestHandlersArchive(t *testing.T) {
+	s := newStoreTestServer(t)
+	_, alice := s.createUser("alice")
+	s.createPaste(alice, models.Paste{Message: "public", Tags: []string{"demo"}})
+	s.createPaste(alice, models.Paste{Message: "private", Visibility: models.VisibilityPrivate})
+
+	var archive struct{ Pastes []models.PasteSummary }
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/archive", "", nil, &archive))
+	if assert.Len(t, archive.Pastes, 1) {
+		assert.Empty(t, archive.Pastes[0].DevKey)
+	}
+
+	// the filters of a user's own pastes are not available
+	assert.Equal(t, http.StatusBadRequest, s.do("GET", "/api/archive?tag=demo", "", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, s.do("GET", "/api/archive?folder="+uuid.NewString(), "", nil, nil))
+}
+
+func TestHandlersRegisterReleasesDevKey(t *testing.T) {
+	store, h := newStoreHandlers(t)
+	s := startTestServer(t, store, h)
+	s.createUser("alice")
+	before, err := h.DevKeys.Stats(context.Background())
+	assert.NoError(t, err)
+
+	// the devkey taken for a user that can't be created goes back to the pool
+	register := models.UserRegistration{Username: "alice", Password: "correct-horse-42", Email: "other@example.com"}
+	assert.NotEqual(t, http.StatusCreated, s.do("POST", "/api/register", "", register, nil))
+	after, err := h.DevKeys.Stats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, before.Used, after.Used)
+}
+
+func TestHandlersPasswordChange(t *testing.T) {
+	s := newStoreTestServer(t)
+	_, token := s.createUser("alice")
+
+	login := func(password string) int {
+		return s.do("POST", "/api/login", "", models.UserLogin{Username: "alice", Password: password}, nil)
+	}
+	assert.Equal(t, http.StatusAccepted, login("pw"))
+
+	change := models.PasswordChangeRequest{CurrentPassword: "pw", NewPassword: "correct-horse-42"}
+	assert.Equal(t, http.StatusAccepted, s.do("PUT", "/api/me/password", token, change, nil))
+	assert.Equal(t, http.StatusBadRequest, login("pw"))
+	assert.Equal(t, http.StatusAccepted, login("correct-horse-42"))
+}
+
+func TestHandlersDeleteAccount(t *testing.T) {
+	store, h := newStoreHandlers(t)
+	s := startTestServer(t, store, h)
+	_, alice := s.createUser("alice")
+	private := s.createPaste(alice, models.Paste{Message: "private", Visibility: models.VisibilityPrivate})
+	public := s.createPaste(alice, models.Paste{Message: "public"})
+
+	request := models.AccountDeleteRequest{Password: "pw", KeepPublicPastes: true}
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", "/api/me", alice, request, nil))
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/getPaste/"+private, "", nil, nil))
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/getPaste/"+public, "", nil, nil))
+
+	// the private paste was deleted through the outbox, only the message of the public one is left
+	pending, err := store.ReadPendingOutboxEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	var ids int
+	assert.NoError(t, h.Messages.ReadMessageIDs(context.Background(), func(primitive.ObjectID) error {
+		ids++
+		return nil
+	}))
+	assert.Equal(t, 1, ids)
+}
+
+func TestHandlersRequestContext(t *testing.T) {
+	objects, messages := db.NewMemoryDB(), db.NewMemoryMessageDB()
+	object := models.Object{PasteKey: "slow", DevKey: "owner"}
+	assert.NoError(t, createPaste(context.Background(), objects, messages, &object, "body"))
+
+	// serve starts the request and returns once the handler is reading the message, the status is
+	// sent when the handler is done
+	serve := func(ctx context.Context) (blockingMessages, chan int) {
+		blocking := blockingMessages{messages, make(chan struct{}), make(chan error, 1)}
+		r := mux.NewRouter()
+		NewHandlers(objects, objects, blocking, kgs.NewMemory()).Routes(r)
+		status := make(chan int, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", "/api/getPaste/slow", nil).WithContext(ctx))
+			status <- rec.Code
+		}()
+		<-blocking.started
+		return blocking, status
+	}
+
+	// the client goes away while the message is read
+	ctx, cancel := context.WithCancel(context.Background())
+	blocking, status := serve(ctx)
+	cancel()
+	select {
+	case err := <-blocking.aborted:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read was not aborted when the request was cancelled")
+	}
+	assert.Equal(t, http.StatusInternalServerError, <-status)
+
+	// on SQLite the query is interrupted when the client goes away, the outbox entry of a new
+	// paste is stored with a query that never finishes
+	conn, err := db.ConnectToSQLiteDb(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DisconnectFromSQLiteDb(conn)
+	store, keys := db.NewSQLiteDB(conn), kgs.GetSQLiteInstance(context.Background(), conn)
+	h := NewStoreHandlers(store, db.NewSQLiteMessageDB(conn), keys, keys)
+	_, alice := startTestServer(t, store, h).createUser("alice")
+	_, err = conn.Exec(`
+		CREATE VIEW Forever AS WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n;
+		CREATE TRIGGER forever_outbox BEFORE INSERT ON PasteOutbox BEGIN SELECT * FROM Forever; END;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	h.Routes(r)
+	ctx, cancel = context.WithCancel(context.Background())
+	status = make(chan int, 1)
+	go func() {
+		var body bytes.Buffer
+		json.NewEncoder(&body).Encode(models.Paste{Message: "hello"})
+		req := httptest.NewRequest("POST", "/api/createPaste", &body).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+alice)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		status <- rec.Code
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-status:
+		assert.Equal(t, http.StatusInternalServerError, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("query was not interrupted when the request was cancelled")
+	}
+
+	// the read takes longer than the request may spend on the database
+	defer func(timeout time.Duration) { dbTimeout = timeout }(dbTimeout)
+	dbTimeout = 50 * time.Millisecond
+	blocking, status = serve(context.Background())
+	select {
+	case err := <-blocking.aborted:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read was not aborted after dbTimeout")
+	}
+	assert.Equal(t, http.StatusInternalServerError, <-status)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"pastebin/config"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one key of the key ring, keys without private part only verify tokens
+// signed before the key was rotated out
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// KeyRing signs new tokens with the active key and verifies tokens with any key it knows,
+// found by the kid header of the token
+type KeyRing struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// SigningKeys is the key ring used for access tokens
+var SigningKeys *KeyRing
+
+// LoadKeyRing builds the key ring from auth.jwt_signing_keys, a list of kid:algorithm:path
+// entries, and auth.jwt_active_key, the kid used for signing new tokens.
+// Algorithm is HS256 (file holds the secret), RS256 or EdDSA (file holds a PEM private key,
+// or only the public key for keys that no longer sign). Without configuration a random
+// HS256 key is generated, tokens then stop working on restart.
+func LoadKeyRing(cfg config.Auth) (*KeyRing, error) {
+	if len(cfg.JWTSigningKeys) == 0 {
+		log.Println("Warning: auth.jwt_signing_keys is not set, using a random key, tokens won't survive restart")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		ring := NewKeyRing()
+		if err := ring.AddKey("ephemeral", "HS256", []byte(base64.StdEncoding.EncodeToString(secret))); err != nil {
+			return nil, err
+		}
+		return ring, ring.SetActive("ephemeral")
+	}
+
+	ring := NewKeyRing()
+	for _, entry := range cfg.JWTSigningKeys {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid auth.jwt_signing_keys entry %q, expected kid:algorithm:path", entry)
+		}
+		material, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key %s: %w", parts[0], err)
+		}
+		if err := ring.AddKey(parts[0], parts[1], material); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, ring.SetActive(cfg.JWTActiveKey)
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string]*signingKey)}
+}
+
+// AddKey parses key material for the algorithm and adds it to the ring
+func (k *KeyRing) AddKey(kid, algorithm string, material []byte) error {
+	if kid == "" {
+		return fmt.Errorf("key id must not be empty")
+	}
+	if _, exists := k.keys[kid]; exists {
+		return fmt.Errorf("duplicate key id %s", kid)
+	}
+
+	key := &signingKey{id: kid}
+	switch algorithm {
+	case "HS256":
+		secret := []byte(strings.TrimSpace(string(material)))
+		if len(secret) < 32 {
+			return fmt.Errorf("key %s: HS256 secret must have at least 32 bytes", kid)
+		}
+		key.method, key.private, key.public = jwt.SigningMethodHS256, secret, secret
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(material); err == nil {
+			key.private, key.public = private, &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(material); err == nil {
+			key.public = public
+		} else {
+			return fmt.Errorf("key %s: %w", kid, err)
+		}
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(material); err == nil {
+			key.private, key.public = private, private.(crypto.Signer).Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(material); err == nil {
+			key.public = public
+		} else {
+			return fmt.Errorf("key %s: %w", kid, err)
+		}
+	default:
+		return fmt.Errorf("key %s: unsupported algorithm %s", kid, algorithm)
+	}
+
+	k.keys[kid] = key
+	return nil
+}
+
+// SetActive chooses the key that signs new tokens, it must have a private part
+func (k *KeyRing) SetActive(kid string) error {
+	key, ok := k.keys[kid]
+	if !ok {
+		return fmt.Errorf("active key %q is not configured", kid)
+	}
+	if key.private == nil {
+		return fmt.Errorf("active key %s has no private key", kid)
+	}
+	k.active = key
+	return nil
+}
+
+// Sign creates a token signed with the active key and carrying its kid
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if k == nil || k.active == nil {
+		return "", fmt.Errorf("no active signing key")
+	}
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	return token.SignedString(k.active.private)
+}
+
+// Keyfunc finds the verification key of a token, the token has to use the algorithm of its key
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Error: unknown signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Error: wrong authorization method used")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys in JSON Web Key Set format, HMAC secrets are never published
+func (k *KeyRing) JWKS() map[string]interface{} {
+	encode := base64.RawURLEncoding.EncodeToString
+	keys := make([]map[string]string, 0)
+
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := k.keys[kid]
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kid": kid, "kty": "RSA", "alg": "RS256", "use": "sig",
+				"n": encode(public.N.Bytes()),
+				"e": encode(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kid": kid, "kty": "OKP", "crv": "Ed25519", "alg": "EdDSA", "use": "sig",
+				"x": encode(public),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// JWKSHandler publishes public keys so other services can verify our tokens
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SigningKeys.JWKS())
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func rsaKeyPEM(t *testing.T) (private, public []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return private, public
+}
+
+func edKeyPEM(t *testing.T) []byte {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	oldPrivate, oldPublic := rsaKeyPEM(t)
+
+	// Tokens signed before rotation
+	before := NewKeyRing()
+	assert.NoError(t, before.AddKey("2024-01", "RS256", oldPrivate))
+	assert.NoError(t, before.SetActive("2024-01"))
+	oldToken, err := before.Sign(jwt.MapClaims{"username": "test"})
+	assert.NoError(t, err, "Expected no error")
+
+	// After rotation the old key only verifies
+	after := NewKeyRing()
+	assert.NoError(t, after.AddKey("2024-01", "RS256", oldPublic))
+	assert.NoError(t, after.AddKey("2024-06", "EdDSA", edKeyPEM(t)))
+	assert.Error(t, after.SetActive("2024-01"), "Expected a key without private part not to sign")
+	assert.NoError(t, after.SetActive("2024-06"))
+
+	newToken, err := after.Sign(jwt.MapClaims{"username": "test"})
+	assert.NoError(t, err, "Expected no error")
+
+	for _, tokenString := range []string{oldToken, newToken} {
+		token, err := jwt.Parse(tokenString, after.Keyfunc)
+		assert.NoError(t, err, "Expected tokens of both keys to verify")
+		assert.True(t, token.Valid)
+	}
+
+	// Tokens of unknown keys are refused
+	unknown := NewKeyRing()
+	assert.NoError(t, unknown.AddKey("2023-01", "HS256", []byte("a secret that is at least 32 bytes long")))
+	assert.NoError(t, unknown.SetActive("2023-01"))
+	unknownToken, err := unknown.Sign(jwt.MapClaims{"username": "test"})
+	assert.NoError(t, err, "Expected no error")
+
+	_, err = jwt.Parse(unknownToken, after.Keyfunc)
+	assert.Error(t, err, "Expected a token of an unknown key to be refused")
+}
+
+func TestKeyRingJWKS(t *testing.T) {
+	private, _ := rsaKeyPEM(t)
+
+	ring := NewKeyRing()
+	assert.NoError(t, ring.AddKey("hmac", "HS256", []byte("a secret that is at least 32 bytes long")))
+	assert.NoError(t, ring.AddKey("rsa", "RS256", private))
+	assert.NoError(t, ring.AddKey("ed", "EdDSA", edKeyPEM(t)))
+
+	keys := ring.JWKS()["keys"].([]map[string]string)
+	assert.Len(t, keys, 2, "Expected HMAC secret not to be published")
+	assert.Equal(t, "ed", keys[0]["kid"])
+	assert.Equal(t, "OKP", keys[0]["kty"])
+	assert.Equal(t, "rsa", keys[1]["kid"])
+	assert.Equal(t, "AQAB", keys[1]["e"])
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"pastebin/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// failures of a username before each further attempt has to wait, doubling every time,
+	// and failures until the username is locked
+	userBackoffAfter = 3
+	userLockoutAfter = 10
+	// an address may be shared by many users, it gets more attempts
+	ipBackoffAfter  = 20
+	ipLockoutAfter  = 30
+	lockoutDuration = 15 * time.Minute
+	// failures older than this are forgotten
+	loginFailureWindow = 24 * time.Hour
+	// failed logins take at least this long, so the response time doesn't tell if the user exists
+	loginFailureDelay = 300 * time.Millisecond
+)
+
+// loginBackoff is how long logins wait after the given number of failures
+func loginBackoff(failures, backoffAfter, lockoutAfter int) time.Duration {
+	switch {
+	case failures >= lockoutAfter:
+		return lockoutDuration
+	case failures < backoffAfter:
+		return 0
+	}
+	// the shift is limited so the duration can't overflow
+	return min(time.Second<<min(failures-backoffAfter, 20), lockoutDuration)
+}
+
+// clientIP is the address the request came from, without port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginThrottleKeys returns the failure counter keys of a username, compared ignoring case
+// like usernames are, and of a client address
+func loginThrottleKeys(username, ip string) (string, string) {
+	return "user:" + hashToken(strings.ToLower(username)), "ip:" + hashToken(ip)
+}
+
+// hashPassword returns the bcrypt hash that is stored instead of the password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// isPasswordHash tells bcrypt hashes from passwords stored in plain text before they were hashed
+func isPasswordHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// passwordMatches checks the password against the stored hash. Passwords stored in plain text are
+// compared in constant time, so the time doesn't tell how much of the password is right, login
+// replaces them by their hash.
+func passwordMatches(stored, given string) bool {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(given)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(given)) == 1
+}
+
+// rehashPassword replaces a password stored in plain text by its hash once the user logged in with
+// it, a failure is logged and tried again on the next login
+func (h *Handlers) rehashPassword(ctx context.Context, user models.User, password string) {
+	hash, err := hashPassword(password)
+	if err == nil {
+		err = h.Accounts.UpdateUserPassword(ctx, user.UserID, hash)
+	}
+	if err != nil {
+		log.Println("Error: Cannot hash stored password of user " + user.UserID.String() + ": " + err.Error())
+	}
+}
+
+// loginBlockedFor returns how long logins for the keys have to wait, zero when they may try now
+func (h *Handlers) loginBlockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	until, err := h.Logins.ReadLoginBlockedUntil(ctx, keys, now)
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+	return until.Sub(now), nil
+}
+
+// recordLoginFailure counts a failure for the key and blocks it as long as the backoff says
+func (h *Handlers) recordLoginFailure(ctx context.Context, key string, backoffAfter, lockoutAfter int) error {
+	now := time.Now()
+	failures, err := h.Logins.RecordLoginFailure(ctx, key, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+	if backoff := loginBackoff(failures, backoffAfter, lockoutAfter); backoff > 0 {
+		return h.Logins.BlockLogin(ctx, key, now.Add(backoff))
+	}
+	return nil
+}
+
+// writeLoginBlocked answers 429 with the seconds until the next attempt
+func writeLoginBlocked(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+}
+
+// waitForFailureDelay pads a failed login to loginFailureDelay since start
+func waitForFailureDelay(start time.Time) {
+	time.Sleep(time.Until(start.Add(loginFailureDelay)))
+}
+
+// checkLoginBlocked answers the request when logins for the keys have to wait, it returns false then
+func (h *Handlers) checkLoginBlocked(w http.ResponseWriter, r *http.Request, userKey, ipKey string) bool {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	wait, err := h.loginBlockedFor(ctx, userKey, ipKey)
+	if err != nil {
+		log.Println("Error: Cannot check failed logins: " + err.Error())
+		http.Error(w, "Error: Cannot login", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		writeLoginBlocked(w, wait)
+		return false
+	}
+	return true
+}
+
+// loginFailed counts the failure for the username and the address and answers after loginFailureDelay
+func (h *Handlers) loginFailed(w http.ResponseWriter, r *http.Request, start time.Time, userKey, ipKey, message string) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	log.Println("Error: failed login from " + clientIP(r))
+	if err := h.recordLoginFailure(ctx, userKey, userBackoffAfter, userLockoutAfter); err != nil {
+		log.Println("Error: Cannot record failed login: " + err.Error())
+	}
+	if err := h.recordLoginFailure(ctx, ipKey, ipBackoffAfter, ipLockoutAfter); err != nil {
+		log.Println("Error: Cannot record failed login: " + err.Error())
+	}
+
+	waitForFailureDelay(start)
+	http.Error(w, message, http.StatusBadRequest)
+}
+
+// clearUserLoginFailures unlocks the username after a successful login or password reset
+func (h *Handlers) clearUserLoginFailures(ctx context.Context, username string) {
+	userKey, _ := loginThrottleKeys(username, "")
+	if err := h.Logins.ClearLoginFailures(ctx, userKey); err != nil {
+		log.Println("Error: Cannot clear failed logins: " + err.Error())
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), loginBackoff(2, 3, 10))
+	assert.Equal(t, time.Second, loginBackoff(3, 3, 10))
+	assert.Equal(t, 2*time.Second, loginBackoff(4, 3, 10))
+	assert.Equal(t, 64*time.Second, loginBackoff(9, 3, 10))
+	assert.Equal(t, lockoutDuration, loginBackoff(10, 3, 10))
+	assert.Equal(t, 512*time.Second, loginBackoff(29, ipBackoffAfter, ipLockoutAfter))
+	// the backoff never gets longer than a lockout
+	assert.Equal(t, lockoutDuration, loginBackoff(80, 3, 100))
+}
+
+func TestLoginThrottleKeys(t *testing.T) {
+	userKey, ipKey := loginThrottleKeys("Alice", "10.0.0.1")
+	otherUserKey, otherIPKey := loginThrottleKeys("alice", "10.0.0.2")
+
+	assert.Equal(t, userKey, otherUserKey, "Expected usernames to be compared ignoring case")
+	assert.NotEqual(t, ipKey, otherIPKey)
+	assert.NotContains(t, userKey, "alice", "Expected usernames to be stored only as hash")
+	assert.LessOrEqual(t, len(userKey), 80)
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/login", nil)
+	r.RemoteAddr = "192.0.2.1:51234"
+	assert.Equal(t, "192.0.2.1", clientIP(r))
+
+	r.RemoteAddr = "[2001:db8::1]:443"
+	assert.Equal(t, "2001:db8::1", clientIP(r))
+}
+
+func TestPasswordMatches(t *testing.T) {
+	hash, err := hashPassword("s3cret-pw")
+	assert.NoError(t, err)
+	assert.True(t, isPasswordHash(hash))
+	assert.True(t, passwordMatches(hash, "s3cret-pw"))
+	assert.False(t, passwordMatches(hash, "s3cret-p"))
+	assert.False(t, passwordMatches(hash, hash))
+
+	// passwords stored before they were hashed still work until the next login hashes them
+	assert.False(t, isPasswordHash("s3cret-pw"))
+	assert.True(t, passwordMatches("s3cret-pw", "s3cret-pw"))
+	assert.False(t, passwordMatches("s3cret-pw", "s3cret-p"))
+	assert.False(t, passwordMatches("s3cret-pw", ""))
+}
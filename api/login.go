@@ -1,16 +1,23 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"pastebin/models"
-	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
 	var newUserReg models.UserRegistration
 	if err := json.NewDecoder(r.Body).Decode(&newUserReg); err != nil {
 		log.Println(err)
@@ -25,9 +32,32 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ovde bih mozda uradio md5 ili neku hes funkciju na pasvordu ali to mozemo i posle
-	
-	devkey, errDev := KgsDevKeys.Check("")
+	if !isValidUsername(newUserReg.Username) {
+		log.Println("Bad request for registration: invalid username")
+		http.Error(w, "Bad Request: username must have 3 to 20 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+
+	if !isValidEmail(newUserReg.Email) {
+		log.Println("Bad request for registration: invalid email")
+		http.Error(w, "Bad Request: invalid email", http.StatusBadRequest)
+		return
+	}
+
+	if problem := passwordProblem(newUserReg.Password, newUserReg.Username, newUserReg.Email); problem != "" {
+		log.Println("Bad request for registration: weak password")
+		http.Error(w, "Bad Request: " + problem, http.StatusBadRequest)
+		return
+	}
+
+	hash, errHash := hashPassword(newUserReg.Password)
+	if errHash != nil {
+		http.Error(w,"Error: Cannot register user", http.StatusInternalServerError)
+		log.Println("Error: Cannot hash password: " + errHash.Error())
+		return
+	}
+
+	devkey, errDev := h.DevKeys.Check(ctx, "")
 	if errDev != nil {
 		http.Error(w,"Error: Cannot register user", http.StatusInternalServerError)
 		log.Println("Error: Cannot create key for user: " + errDev.Error())
@@ -36,25 +66,40 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	newUser := models.User{
 		Name: 		newUserReg.Username,
-		Password:	newUserReg.Password,
+		Password:	hash,
 		PasteNum: 	0,
 		DevKey: 	devkey,
 		Email: 		newUserReg.Email,
 	}
 
 
-	if _, err := ConnectorPostgresDB.CreateUser(context.Background(), &newUser); err!=nil{
+	if _, err := h.Users.CreateUser(ctx, &newUser); err!=nil{
 		log.Println(err)
+		if err := h.DevKeys.Release(ctx, devkey); err != nil {
+			log.Println("Error: Cannot release devkey: " + err.Error())
+		}
+		if field := userConflictField(err); field != "" {
+			http.Error(w, "Conflict: " + field + " is already taken", http.StatusConflict)
+			return
+		}
 		http.Error(w,"Impossible to register", http.StatusBadRequest)
 		return
 	} 
 
+	// registration works even if the mail can't be sent, the user can ask for a new one
+	if err := h.sendVerificationEmail(ctx, newUser); err != nil {
+		log.Println("Error: Cannot send verification email: " + err.Error())
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
 
 
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
 	var loginRequest models.UserLogin
 	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
 		log.Println(err)
@@ -69,31 +114,89 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := ConnectorPostgresDB.ReadUserByUsername(context.Background(), loginRequest.Username);
-	if err!=nil{
+	start := time.Now()
+	userKey, ipKey := loginThrottleKeys(loginRequest.Username, clientIP(r))
+	if !h.checkLoginBlocked(w, r, userKey, ipKey) {
+		return
+	}
+
+	// unknown users and wrong passwords get the same answer after the same time
+	user, err := h.Users.ReadUserByUsername(ctx, loginRequest.Username);
+	if err!=nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Println(err)
-		http.Error(w,"Cannot login with these credentials", http.StatusBadRequest)
+	}
+	if err!=nil || !passwordMatches(user.Password, loginRequest.Password) {
+		h.loginFailed(w, r, start, userKey, ipKey, "Bad credentials")
 		return
-	} 
-	
-	// check if user password is ok
-	if user.Password != loginRequest.Password {
-		log.Println("Error: " + loginRequest.Username + " tried to login with bad password")
-		http.Error(w,"Bad credentials", http.StatusBadRequest)
+	}
+	if !isPasswordHash(user.Password) {
+		h.rehashPassword(ctx, user, loginRequest.Password)
+	}
+	h.loginOrChallenge(w, r, user, loginRequest.Device)
+}
+
+// loginOrChallenge starts a session for a user whose identity was checked, users with 2FA
+// get a challenge instead of a session, see TwoFactorLoginHandler
+func (h *Handlers) loginOrChallenge(w http.ResponseWriter, r *http.Request, user models.User, device string) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if rejectSuspended(w, user) {
+		return
+	}
+
+	// 2FA fails closed, only users who never enrolled log in without the second factor
+	userTotp, errTotp := h.Logins.ReadTotp(ctx, user.UserID)
+	if errTotp != nil && !errors.Is(errTotp, sql.ErrNoRows) {
+		http.Error(w, "Error: Cannot log in", http.StatusInternalServerError)
+		log.Println("Error: Cannot read 2FA settings: " + errTotp.Error())
+		return
+	}
+	if errTotp == nil && userTotp.Enabled {
+		challenge, err := createTwoFactorChallenge(user)
+		if err!=nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return;
+		}
+		w.WriteHeader(http.StatusAccepted)
+		data,_ := json.Marshal(map[string]interface{}{"TwoFactorRequired": true, "ChallengeToken": challenge})
+		w.Write(data)
 		return
 	}
 
+	// failures are only forgotten once the login is complete, a right password alone doesn't
+	// reset the lockout of the second factor
+	h.clearUserLoginFailures(ctx, user.Name)
+	h.completeLogin(w, r, user, device)
+}
+
+// completeLogin issues the access and refresh token of a new session
+func (h *Handlers) completeLogin(w http.ResponseWriter, r *http.Request, user models.User, device string) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	if rejectSuspended(w, user) {
+		return
+	}
 
 	// make jwt token and send back to user
-	newToken, err := CreateNewToken(user.Name, user.DevKey);
+	newToken, err := CreateNewToken(user.UserID, user.Name, user.DevKey, user.Role);
+	if err!=nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return;
+	}
+
+
+	refreshToken, err := h.issueRefreshToken(ctx, user.UserID, uuid.Nil, deviceInfo(r, device))
 	if err!=nil {
+		log.Println("Error: Cannot issue refresh token: " + err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return;
 	}
 
 
 	w.WriteHeader(http.StatusAccepted)
-	data,_ := json.Marshal(map[string]interface{}{"Token": newToken, "DevKey": user.DevKey})
+	data,_ := json.Marshal(map[string]interface{}{"Token": newToken, "RefreshToken": refreshToken, "DevKey": user.DevKey})
 	w.Write(data)
 
 }
@@ -0,0 +1,542 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/db"
+	"pastebin/mail"
+	"pastebin/models"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	minOrgNameLength   = 3
+	maxOrgNameLength   = 40
+	invitationLifetime = 7 * 24 * time.Hour
+)
+
+// orgRoleRank orders the roles in an organisation: viewers list and read the pastes,
+// editors also create, change and delete them, owners also manage members and the organisation
+var orgRoleRank = map[string]int{
+	models.OrgRoleViewer: 0,
+	models.OrgRoleEditor: 1,
+	models.OrgRoleOwner:  2,
+}
+
+func isValidOrgRole(role string) bool {
+	_, ok := orgRoleRank[role]
+	return ok
+}
+
+// hasOrgRole reports if a member with the role may do what the required role allows
+func hasOrgRole(role, required string) bool {
+	rank, ok := orgRoleRank[role]
+	return ok && rank >= orgRoleRank[required]
+}
+
+// isValidOrgName accepts 3 to 40 letters, digits, spaces, dots, dashes and underscores
+func isValidOrgName(name string) bool {
+	if len(name) < minOrgNameLength || len(name) > maxOrgNameLength {
+		return false
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune(" ._-", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifiedEmail is the email invitations may be sent to, empty when the user hasn't verified it
+func verifiedEmail(user models.User) string {
+	if !user.EmailVerified {
+		return ""
+	}
+	return user.Email
+}
+
+// readOrgWithRole loads the organisation of the orgId route variable for a member with the role.
+// Non members get 404, so they don't learn which organisations exist.
+func (h *Handlers) readOrgWithRole(w http.ResponseWriter, r *http.Request, required string) (*models.Organisation, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	orgID, err := uuid.Parse(mux.Vars(r)["orgId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid organisation id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	role, err := h.Users.ReadOrgMemberRole(ctx, orgID, principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Organisation not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error: Cannot read organisation", http.StatusInternalServerError)
+		log.Println("Error: Cannot read organisation role: " + err.Error())
+		return nil, false
+	}
+	if !hasOrgRole(role, required) {
+		http.Error(w, "Forbidden: requires organisation role "+required, http.StatusForbidden)
+		return nil, false
+	}
+
+	org, err := h.Users.ReadOrganisation(ctx, orgID)
+	if err != nil {
+		http.Error(w, "Organisation not found", http.StatusNotFound)
+		return nil, false
+	}
+	org.Role = role
+	return org, true
+}
+
+// CreateOrganisation creates an organisation with its own devkey, the user becomes its owner
+func (h *Handlers) CreateOrganisation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.OrganisationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(requestData.Name)
+	if !isValidOrgName(name) {
+		http.Error(w, "Bad Request: name must have 3 to 40 letters, digits, spaces, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+
+	devKey, err := h.DevKeys.Check(ctx, "")
+	if err != nil {
+		http.Error(w, "Error: Cannot create organisation", http.StatusInternalServerError)
+		log.Println("Error: Cannot create key for organisation: " + err.Error())
+		return
+	}
+
+	org := models.Organisation{Name: name, DevKey: devKey}
+	if err := h.Orgs.CreateOrganisation(ctx, &org, principal.UserID); err != nil {
+		if err := h.DevKeys.Release(ctx, devKey); err != nil {
+			log.Println("Error: Cannot release devkey: " + err.Error())
+		}
+		if isUniqueViolation(err) {
+			http.Error(w, "Conflict: name is already taken", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot create organisation", http.StatusInternalServerError)
+		log.Println("Error: Cannot create organisation: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(org)
+	w.Write(data)
+}
+
+// GetOrganisations lists the organisations of the user with the user's role
+func (h *Handlers) GetOrganisations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	orgs, err := h.Users.ReadOrganisationsByUser(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: Cannot read organisations", http.StatusInternalServerError)
+		log.Println("Error: Cannot read organisations: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"organisations": orgs})
+	w.Write(data)
+}
+
+// GetOrganisation returns the organisation with its members
+func (h *Handlers) GetOrganisation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := h.Orgs.ReadOrgMembers(ctx, org.OrgID)
+	if err != nil {
+		http.Error(w, "Error: Cannot read organisation", http.StatusInternalServerError)
+		log.Println("Error: Cannot read organisation members: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"organisation": org, "members": members})
+	w.Write(data)
+}
+
+// DeleteOrganisation removes an organisation without pastes and gives its devkey back to the pool
+func (h *Handlers) DeleteOrganisation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := h.Orgs.DeleteOrganisation(ctx, org.OrgID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Conflict: organisation still has pastes", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot delete organisation", http.StatusInternalServerError)
+		log.Println("Error: Cannot delete organisation: " + err.Error())
+		return
+	}
+	if err := h.DevKeys.Release(ctx, org.DevKey); err != nil {
+		log.Println("Error: Cannot release devkey of deleted organisation: " + err.Error())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetOrgPastes returns one page of the organisation's pastes, with the query parameters of GetUserPastes
+func (h *Handlers) GetOrgPastes(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+
+	pastes, nextCursor, ok := h.readPastesPage(w, r, []string{org.DevKey})
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"orgId":      org.OrgID,
+		"name":       org.Name,
+		"devkey":     org.DevKey,
+		"pastes":     pastes,
+		"nextCursor": nextCursor,
+	})
+	w.Write(data)
+}
+
+// InviteToOrganisation invites a user by username, or anyone by email. Email invitations can be
+// accepted by a user who has verified that email.
+func (h *Handlers) InviteToOrganisation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if requestData.Role == "" {
+		requestData.Role = models.OrgRoleViewer
+	}
+	if !isValidOrgRole(requestData.Role) {
+		http.Error(w, "Bad Request: role must be viewer, editor or owner", http.StatusBadRequest)
+		return
+	}
+	if (requestData.Username == "") == (requestData.Email == "") {
+		http.Error(w, "Bad Request: send either username or email", http.StatusBadRequest)
+		return
+	}
+	if requestData.Email != "" && !isValidEmail(requestData.Email) {
+		http.Error(w, "Bad Request: invalid email", http.StatusBadRequest)
+		return
+	}
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+
+	invitation := models.OrgInvitation{
+		OrgID:     org.OrgID,
+		OrgName:   org.Name,
+		Email:     requestData.Email,
+		Role:      requestData.Role,
+		InvitedBy: principal.UserID,
+		ExpiresAt: time.Now().Add(invitationLifetime),
+	}
+
+	if requestData.Username != "" {
+		user, err := h.Users.ReadUserByUsername(ctx, requestData.Username)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if _, err := h.Users.ReadOrgMemberRole(ctx, org.OrgID, user.UserID); err == nil {
+			http.Error(w, "Conflict: user is already a member", http.StatusConflict)
+			return
+		}
+		invitation.UserID = &user.UserID
+	}
+
+	if err := h.Orgs.CreateOrgInvitation(ctx, &invitation); err != nil {
+		http.Error(w, "Error: Cannot create invitation", http.StatusInternalServerError)
+		log.Println("Error: Cannot create invitation: " + err.Error())
+		return
+	}
+
+	if invitation.Email != "" {
+		err := Mailer.Send(ctx, mail.Message{
+			To:      invitation.Email,
+			Subject: "Invitation to " + org.Name,
+			Body: "Hi,\n\n" + principal.Username + " invited you to join " + org.Name + " as " + invitation.Role + ".\n\n" +
+				"Log in with this email verified and accept the invitation at " + AppURL + "/invitations\n\n" +
+				"The invitation expires in " + invitationLifetime.String() + ".\n",
+		})
+		if err != nil {
+			log.Println("Error: Cannot send invitation email: " + err.Error())
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(invitation)
+	w.Write(data)
+}
+
+// GetOrgInvitations lists open invitations of the organisation
+func (h *Handlers) GetOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.Orgs.ReadOrgInvitations(ctx, org.OrgID, time.Now())
+	if err != nil {
+		http.Error(w, "Error: Cannot read invitations", http.StatusInternalServerError)
+		log.Println("Error: Cannot read invitations: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"invitations": invitations})
+	w.Write(data)
+}
+
+// RevokeOrgInvitation withdraws an invitation that was not accepted yet
+func (h *Handlers) RevokeOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+
+	invitationID, err := uuid.Parse(mux.Vars(r)["invitationId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid invitation id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Orgs.RevokeOrgInvitation(ctx, org.OrgID, invitationID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot revoke invitation", http.StatusInternalServerError)
+		log.Println("Error: Cannot revoke invitation: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// memberUserID reads the userId route variable
+func memberUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid user id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// writeMemberChangeError answers failed changes of a member
+func writeMemberChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrLastOwner):
+		http.Error(w, "Conflict: organisation needs an owner", http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Member not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Error: Cannot change member", http.StatusInternalServerError)
+		log.Println("Error: Cannot change organisation member: " + err.Error())
+	}
+}
+
+// SetOrgMemberRole changes the role of a member, the last owner can't be demoted
+func (h *Handlers) SetOrgMemberRole(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || !isValidOrgRole(requestData.Role) {
+		http.Error(w, "Bad Request: role must be viewer, editor or owner", http.StatusBadRequest)
+		return
+	}
+
+	org, ok := h.readOrgWithRole(w, r, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	userID, ok := memberUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Orgs.SetOrgMemberRole(ctx, org.OrgID, userID, requestData.Role); err != nil {
+		writeMemberChangeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveOrgMember removes a member, owners can remove anyone and every member can leave
+func (h *Handlers) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	userID, ok := memberUserID(w, r)
+	if !ok {
+		return
+	}
+	required := models.OrgRoleOwner
+	if userID == principal.UserID {
+		required = models.OrgRoleViewer
+	}
+
+	org, ok := h.readOrgWithRole(w, r, required)
+	if !ok {
+		return
+	}
+
+	if err := h.Orgs.RemoveOrgMember(ctx, org.OrgID, userID); err != nil {
+		writeMemberChangeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMyInvitations lists open invitations for the user and for its verified email
+func (h *Handlers) GetMyInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	user, err := h.Users.ReadUserById(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: user doesn't exist", http.StatusNotFound)
+		return
+	}
+
+	invitations, err := h.Orgs.ReadInvitationsForUser(ctx, user.UserID, verifiedEmail(user), time.Now())
+	if err != nil {
+		http.Error(w, "Error: Cannot read invitations", http.StatusInternalServerError)
+		log.Println("Error: Cannot read invitations: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"invitations": invitations})
+	w.Write(data)
+}
+
+// readInvitationTarget reads the invitationId route variable and the user answering the invitation
+func (h *Handlers) readInvitationTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, models.User, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	invitationID, err := uuid.Parse(mux.Vars(r)["invitationId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid invitation id", http.StatusBadRequest)
+		return uuid.Nil, models.User{}, false
+	}
+
+	user, err := h.Users.ReadUserById(ctx, principal.UserID)
+	if err != nil {
+		http.Error(w, "Error: user doesn't exist", http.StatusNotFound)
+		return uuid.Nil, models.User{}, false
+	}
+	return invitationID, user, true
+}
+
+// AcceptInvitation makes the user a member with the role of the invitation
+func (h *Handlers) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	invitationID, user, ok := h.readInvitationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	orgID, err := h.Orgs.AcceptOrgInvitation(ctx, invitationID, user.UserID, verifiedEmail(user), time.Now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot accept invitation", http.StatusInternalServerError)
+		log.Println("Error: Cannot accept invitation: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"orgId": orgID})
+	w.Write(data)
+}
+
+// DeclineInvitation deletes an invitation for the user
+func (h *Handlers) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	invitationID, user, ok := h.readInvitationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Orgs.DeclineOrgInvitation(ctx, invitationID, user.UserID, verifiedEmail(user)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot decline invitation", http.StatusInternalServerError)
+		log.Println("Error: Cannot decline invitation: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"pastebin/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasOrgRole(t *testing.T) {
+	assert.True(t, hasOrgRole(models.OrgRoleOwner, models.OrgRoleEditor))
+	assert.True(t, hasOrgRole(models.OrgRoleEditor, models.OrgRoleEditor))
+	assert.True(t, hasOrgRole(models.OrgRoleViewer, models.OrgRoleViewer))
+	assert.False(t, hasOrgRole(models.OrgRoleViewer, models.OrgRoleEditor))
+	assert.False(t, hasOrgRole(models.OrgRoleEditor, models.OrgRoleOwner))
+	assert.False(t, hasOrgRole("", models.OrgRoleViewer))
+}
+
+func TestIsValidOrgName(t *testing.T) {
+	assert.True(t, isValidOrgName("Platform Team"))
+	assert.True(t, isValidOrgName("ops.eu-1_x"))
+	assert.True(t, isValidOrgName("Équipe"))
+	assert.False(t, isValidOrgName("ab"))
+	assert.False(t, isValidOrgName(strings.Repeat("a", maxOrgNameLength+1)))
+	assert.False(t, isValidOrgName("team/ops"))
+	assert.False(t, isValidOrgName("team\nops"))
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"log"
+	"pastebin/db"
+	"pastebin/models"
+	"pastebin/reconcile"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// createPaste writes the message and the Object of a new paste. The paste is recorded in the outbox
+// first, if the server stops halfway the reconciler deletes the message or commits the entry.
+func createPaste(ctx context.Context, objects db.ObjectStore, messages db.MessageStore, object *models.Object, messageBody string) error {
+	messageID := primitive.NewObjectID()
+	object.MessageID = messageID.Hex()
+
+	entry := models.OutboxEntry{Operation: models.OutboxCreate, PasteKey: object.PasteKey, MessageID: object.MessageID}
+	if err := objects.CreateOutboxEntry(ctx, &entry); err != nil {
+		return err
+	}
+
+	if err := messages.PutMessage(ctx, messageID, messageBody); err != nil {
+		// the message may have been written anyway, the entry is left for the reconciler
+		return err
+	}
+
+	if err := objects.CreateObject(ctx, object); err != nil {
+		if errMsg := messages.DeleteMessage(ctx, messageID); errMsg == nil {
+			objects.DeleteOutboxEntry(ctx, entry.OutboxID)
+		}
+		return err
+	}
+
+	if err := objects.CommitOutboxEntry(ctx, entry.OutboxID); err != nil {
+		log.Println("Error: Cannot commit outbox entry of paste: " + object.PasteKey + ": " + err.Error())
+	}
+	return nil
+}
+
+// deletePaste deletes the Object of a paste and then its message. Once the Object is deleted the
+// paste is gone, if deleting the message fails the reconciler deletes it later.
+func deletePaste(ctx context.Context, objects db.ObjectStore, messages db.MessageStore, object *models.Object) error {
+	entry := models.OutboxEntry{Operation: models.OutboxDelete, PasteKey: object.PasteKey, MessageID: object.MessageID}
+	if err := objects.CreateOutboxEntry(ctx, &entry); err != nil {
+		return err
+	}
+
+	if err := objects.DeleteObject(ctx, object.PasteKey, object.DevKey); err != nil {
+		objects.DeleteOutboxEntry(ctx, entry.OutboxID)
+		return err
+	}
+
+	deleteMessageOf(ctx, objects, messages, entry)
+	return nil
+}
+
+// deleteMessageOf deletes the message of a paste whose Object is already deleted and commits the
+// pending delete entry. Failures are only logged, the reconciler finishes the entry later.
+func deleteMessageOf(ctx context.Context, objects db.ObjectStore, messages db.MessageStore, entry models.OutboxEntry) {
+	messageID, err := primitive.ObjectIDFromHex(entry.MessageID)
+	if err == nil {
+		err = messages.DeleteMessage(ctx, messageID)
+	}
+	if err != nil {
+		log.Println("Error: Cannot delete message: " + entry.MessageID + ", the reconciler will: " + err.Error())
+		return
+	}
+
+	if err := objects.CommitOutboxEntry(ctx, entry.OutboxID); err != nil {
+		log.Println("Error: Cannot commit outbox entry of paste: " + entry.PasteKey + ": " + err.Error())
+	}
+}
+
+// reconcilePastes repairs pastes left inconsistent by interrupted creates and deletes, the App runs it every
+// hour. Pastes whose message is missing are only logged, cmd/reconcile deletes them.
+func (a *App) reconcilePastes(ctx context.Context) {
+	report, err := reconcile.New(a.store, a.messages, reconcile.DefaultGrace).Run(ctx, false)
+	if err != nil {
+		log.Println("Error: Cannot reconcile pastes: " + err.Error())
+		return
+	}
+	if report.Repairs() > 0 {
+		log.Print("Reconciled pastes:\n" + report.String())
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"pastebin/db"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingMessages fails to write or delete messages, like a message store that went down
+type failingMessages struct {
+	*db.MemoryMessageDB
+}
+
+func (failingMessages) PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error {
+	return errors.New("message store is down")
+}
+
+func (failingMessages) DeleteMessage(ctx context.Context, id primitive.ObjectID) error {
+	return errors.New("message store is down")
+}
+
+func TestPasteOutbox(t *testing.T) {
+	ctx := context.Background()
+	objects, messages := db.NewMemoryDB(), db.NewMemoryMessageDB()
+	broken := failingMessages{messages}
+
+	// the create fails before the Object is written, the entry is left for the reconciler
+	failed := models.Object{PasteKey: "failed", DevKey: "owner"}
+	assert.Error(t, createPaste(ctx, objects, broken, &failed, "body"))
+	_, err := objects.ReadObjectWithoutDevKey(ctx, "failed")
+	assert.Error(t, err)
+	pending, _ := objects.ReadPendingOutboxEntries(ctx)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, models.OutboxCreate, pending[0].Operation)
+	assert.NoError(t, objects.DeleteOutboxEntry(ctx, pending[0].OutboxID))
+
+	object := models.Object{PasteKey: "paste", DevKey: "owner"}
+	assert.NoError(t, createPaste(ctx, objects, messages, &object, "body"))
+	pending, _ = objects.ReadPendingOutboxEntries(ctx)
+	assert.Empty(t, pending)
+
+	// the paste is gone once its Object is deleted, the message is deleted later
+	assert.NoError(t, deletePaste(ctx, objects, broken, &object))
+	_, err = objects.ReadObjectWithoutDevKey(ctx, "paste")
+	assert.Error(t, err)
+	pending, _ = objects.ReadPendingOutboxEntries(ctx)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, models.OutboxDelete, pending[0].Operation)
+	assert.Equal(t, object.MessageID, pending[0].MessageID)
+}
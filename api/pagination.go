@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pastebin/models"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	previewLength   = 200
+)
+
+func isValidVisibility(visibility string) bool {
+	switch visibility {
+	case models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// cursors are opaque for clients, they only pass back what they got in nextCursor
+func encodeCursor(cursor models.ObjectCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*models.ObjectCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor models.ObjectCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.PasteKey == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// parseObjectQuery reads limit, cursor, sort, order, language, visibility, tag and folder query parameters.
+// Tag and folder may also come from the route, as in /api/tags/{tag}/pastes and /api/folders/{folderId}/pastes.
+func parseObjectQuery(r *http.Request) (models.ObjectQuery, error) {
+	params := r.URL.Query()
+	query := models.ObjectQuery{
+		SortBy:     models.SortByCreated,
+		Desc:       true,
+		Language:   params.Get("language"),
+		Visibility: params.Get("visibility"),
+		Tag:        params.Get("tag"),
+		FolderID:   params.Get("folder"),
+		Limit:      defaultPageSize,
+	}
+
+	vars := mux.Vars(r)
+	if tag, ok := vars["tag"]; ok {
+		query.Tag = tag
+	}
+	if folderID, ok := vars["folderId"]; ok {
+		query.FolderID = folderID
+	}
+
+	if query.Tag != "" {
+		query.Tag = normalizeTag(query.Tag)
+	}
+	if query.FolderID != "" {
+		if _, err := uuid.Parse(query.FolderID); err != nil {
+			return query, fmt.Errorf("invalid folder: %s", query.FolderID)
+		}
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return query, fmt.Errorf("invalid limit: %s", limit)
+		}
+		query.Limit = min(n, maxPageSize)
+	}
+
+	switch sortBy := params.Get("sort"); sortBy {
+	case "":
+	case models.SortByCreated, models.SortByUpdated, models.SortByViews:
+		query.SortBy = sortBy
+	default:
+		return query, fmt.Errorf("invalid sort field: %s", sortBy)
+	}
+
+	switch order := params.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return query, fmt.Errorf("invalid order: %s", order)
+	}
+
+	if query.Visibility != "" && !isValidVisibility(query.Visibility) {
+		return query, fmt.Errorf("invalid visibility: %s", query.Visibility)
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	return query, nil
+}
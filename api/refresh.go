@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pastebin/db"
+	"pastebin/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	refreshTokenLifetime = 30 * 24 * time.Hour
+	maxDeviceLength      = 256
+)
+
+// hashToken is how refresh tokens are stored, a leaked table doesn't give usable tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// deviceInfo describes where a login came from, shown to users reviewing their sessions
+func deviceInfo(r *http.Request, device string) string {
+	info := strings.TrimSpace(device + " " + r.UserAgent() + " " + r.RemoteAddr)
+	if len(info) > maxDeviceLength {
+		info = info[:maxDeviceLength]
+	}
+	return info
+}
+
+// issueRefreshToken creates a new refresh token in the given family, uuid.Nil starts a new family
+func (h *Handlers) issueRefreshToken(ctx context.Context, userID, familyID uuid.UUID, device string) (string, error) {
+	token, err := newRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := models.RefreshToken{
+		FamilyID:  familyID,
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		Device:    device,
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+	}
+	if err := h.Logins.CreateRefreshToken(ctx, &refreshToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh token.
+// Every refresh token works once, using it again revokes all tokens issued from the same login.
+func (h *Handlers) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.RefreshToken == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	used, err := h.Logins.UseRefreshToken(ctx, hashToken(requestData.RefreshToken), time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrRefreshTokenReused):
+			log.Println("Error: refresh token reused, token family revoked")
+			http.Error(w, "You're Unauthorized due to invalid token", http.StatusUnauthorized)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "You're Unauthorized due to invalid token", http.StatusUnauthorized)
+		default:
+			log.Println("Error: Cannot refresh token: " + err.Error())
+			http.Error(w, "Error: Cannot refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user, err := h.Users.ReadUserById(ctx, used.UserID)
+	if err != nil {
+		http.Error(w, "You're Unauthorized due to invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if rejectSuspended(w, user) {
+		return
+	}
+
+	newToken, err := CreateNewToken(user.UserID, user.Name, user.DevKey, user.Role)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	newRefreshToken, err := h.issueRefreshToken(ctx, user.UserID, used.FamilyID, used.Device)
+	if err != nil {
+		log.Println("Error: Cannot issue refresh token: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"Token": newToken, "RefreshToken": newRefreshToken})
+	w.Write(data)
+}
+
+// LogoutHandler revokes the access token used for the request and the session of the refresh token,
+// or every session of the user when all is set
+func (h *Handlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// requests made with an API key have no access token to revoke
+	if principal.TokenID != uuid.Nil {
+		if err := h.Logins.RevokeAccessToken(ctx, principal.TokenID, principal.ExpiresAt); err != nil {
+			log.Println("Error: Cannot revoke access token: " + err.Error())
+			http.Error(w, "Error: Cannot log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var err error
+	if requestData.All {
+		err = h.Logins.RevokeUserRefreshTokens(ctx, principal.UserID)
+	} else if requestData.RefreshToken != "" {
+		// only the owner of the refresh token can end its session
+		stored, errRead := h.Logins.ReadRefreshToken(ctx, hashToken(requestData.RefreshToken))
+		if errRead == nil && stored.UserID == principal.UserID {
+			err = h.Logins.RevokeRefreshTokenFamily(ctx, stored.FamilyID)
+		}
+	}
+	if err != nil {
+		log.Println("Error: Cannot revoke refresh tokens: " + err.Error())
+		http.Error(w, "Error: Cannot log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteExpiredTokens removes revocations, refresh tokens and email tokens that expired, the App runs it every hour
+func (h *Handlers) deleteExpiredTokens(ctx context.Context) {
+	if err := h.Logins.DeleteExpiredTokens(ctx, time.Now()); err != nil {
+		log.Println("Error: Cannot delete expired tokens: " + err.Error())
+	}
+	if err := h.Accounts.DeleteExpiredUserTokens(ctx, time.Now()); err != nil {
+		log.Println("Error: Cannot delete expired email tokens: " + err.Error())
+	}
+	if err := h.Logins.DeleteExpiredSsoLogins(ctx, time.Now()); err != nil {
+		log.Println("Error: Cannot delete expired sso logins: " + err.Error())
+	}
+	if err := h.Logins.DeleteStaleLoginFailures(ctx, time.Now().Add(-loginFailureWindow)); err != nil {
+		log.Println("Error: Cannot delete old failed logins: " + err.Error())
+	}
+	if err := h.Orgs.DeleteExpiredOrgInvitations(ctx, time.Now()); err != nil {
+		log.Println("Error: Cannot delete expired invitations: " + err.Error())
+	}
+	if err := h.Shares.DeleteExpiredShareLinks(ctx, time.Now()); err != nil {
+		log.Println("Error: Cannot delete expired share links: " + err.Error())
+	}
+}
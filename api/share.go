@@ -0,0 +1,489 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"pastebin/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// what a principal may do with a paste, every level includes the ones before it
+const (
+	accessNone = iota
+	// read private pastes
+	accessRead
+	// change the content
+	accessEdit
+	// also delete, tag, moderate comments and share
+	accessManage
+)
+
+const (
+	defaultShareLinkLifetime = 24 * time.Hour
+	maxShareLinkLifetime     = 30 * 24 * time.Hour
+	minShareLinkSecretLength = 32
+)
+
+// ShareLinkSecret signs share links, links stop working when it changes
+var ShareLinkSecret []byte
+
+// LoadShareLinkSecret reads the secret from the file in auth.share_link_secret_file. Without
+// configuration a random secret is generated, share links then stop working on restart.
+func LoadShareLinkSecret(path string) error {
+	if path == "" {
+		log.Println("Warning: auth.share_link_secret_file is not set, using a random secret, share links won't survive restart")
+		ShareLinkSecret = make([]byte, minShareLinkSecretLength)
+		_, err := rand.Read(ShareLinkSecret)
+		return err
+	}
+
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read share link secret: %w", err)
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) < minShareLinkSecretLength {
+		return fmt.Errorf("share link secret must have at least %d bytes", minShareLinkSecretLength)
+	}
+	ShareLinkSecret = secret
+	return nil
+}
+
+// pasteAccess returns what the principal may do with the paste: everything with its own pastes,
+// what its organisation role allows with pastes of its organisations, and what was granted to it
+// or one of its organisations
+func (h *Handlers) pasteAccess(ctx context.Context, principal *Principal, object *models.Object) int {
+	if principal == nil || object.DevKey == "" {
+		return accessNone
+	}
+	if principal.DevKey == object.DevKey {
+		return accessManage
+	}
+
+	access := accessNone
+	role, err := h.Users.ReadOrgRoleByDevKey(ctx, object.DevKey, principal.UserID)
+	switch {
+	case err == nil && hasOrgRole(role, models.OrgRoleEditor):
+		return accessManage
+	case err == nil:
+		access = accessRead
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Println("Error: Cannot read organisation role: " + err.Error())
+	}
+
+	permission, err := h.Objects.ReadGrantPermission(ctx, object.PasteKey, principal.UserID)
+	switch {
+	case err == nil && permission == models.PermissionEdit:
+		access = accessEdit
+	case err == nil:
+		access = max(access, accessRead)
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Println("Error: Cannot read paste grants: " + err.Error())
+	}
+	return access
+}
+
+// readPasteWithAccess loads a paste the principal has the access to, sql.ErrNoRows when the paste
+// doesn't exist or the principal may not
+func (h *Handlers) readPasteWithAccess(ctx context.Context, principal *Principal, pasteKey string, required int) (*models.Object, error) {
+	object, err := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if err != nil {
+		return nil, err
+	}
+	if h.pasteAccess(ctx, principal, object) < required {
+		return nil, sql.ErrNoRows
+	}
+	return object, nil
+}
+
+// signShareLink returns the token of a link: its id and expiry with an HMAC over both, so forged
+// or changed tokens are refused without a database lookup
+func signShareLink(linkID uuid.UUID, expiresAt time.Time) string {
+	payload := make([]byte, 24)
+	copy(payload, linkID[:])
+	binary.BigEndian.PutUint64(payload[16:], uint64(expiresAt.Unix()))
+
+	mac := hmac.New(sha256.New, ShareLinkSecret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(payload))
+}
+
+// verifyShareLink checks the signature and expiry of a token and returns the link id
+func verifyShareLink(token string, now time.Time) (uuid.UUID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 24+sha256.Size {
+		return uuid.Nil, fmt.Errorf("invalid share link")
+	}
+	payload, signature := data[:24], data[24:]
+
+	mac := hmac.New(sha256.New, ShareLinkSecret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return uuid.Nil, fmt.Errorf("invalid share link")
+	}
+	if now.Unix() >= int64(binary.BigEndian.Uint64(payload[16:])) {
+		return uuid.Nil, fmt.Errorf("share link expired")
+	}
+
+	linkID, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid share link")
+	}
+	return linkID, nil
+}
+
+func shareLinkURL(link models.ShareLink) string {
+	return AppURL + "/shared/" + signShareLink(link.LinkID, link.ExpiresAt)
+}
+
+// readManagedPaste loads the paste of the pasteKey route variable for its owner
+func (h *Handlers) readManagedPaste(w http.ResponseWriter, r *http.Request) (*models.Object, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	object, err := h.readPasteWithAccess(ctx, principalFrom(r), pasteKey, accessManage)
+	if err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return nil, false
+	}
+	return object, true
+}
+
+// UpdatePaste replaces the content of a paste, its owner and users granted edit can do it
+func (h *Handlers) UpdatePaste(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	var requestData models.PasteUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Message == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	object, err := h.readPasteWithAccess(ctx, principalFrom(r), pasteKey, accessEdit)
+	if err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+
+	messageId, err := primitive.ObjectIDFromHex(object.MessageID)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		log.Println("Error: Cannot convert from string to primitive.ObjectId")
+		return
+	}
+	if err := h.Messages.UpdateMessage(ctx, messageId, models.Message{MessageBody: requestData.Message}); err != nil {
+		http.Error(w, "Error: Cannot update paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot update message of paste " + pasteKey + ": " + err.Error())
+		return
+	}
+	if err := h.Objects.UpdateObject(ctx, object); err != nil {
+		http.Error(w, "Error: Cannot update paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot update paste " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetPasteGrants lists who the paste is shared with
+func (h *Handlers) GetPasteGrants(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	grants, err := h.Shares.ReadPasteGrants(ctx, object.PasteKey)
+	if err != nil {
+		http.Error(w, "Error: Cannot read grants", http.StatusInternalServerError)
+		log.Println("Error: Cannot read grants of paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"pastekey": object.PasteKey, "grants": grants})
+	w.Write(data)
+}
+
+// SetPasteGrant gives a user or all members of an organisation read or edit rights, an existing
+// grant of the same grantee is replaced
+func (h *Handlers) SetPasteGrant(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.GrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if requestData.Permission != models.PermissionRead && requestData.Permission != models.PermissionEdit {
+		http.Error(w, "Bad Request: permission must be read or edit", http.StatusBadRequest)
+		return
+	}
+	if (requestData.Username == "") == (requestData.OrgID == "") {
+		http.Error(w, "Bad Request: send either username or orgId", http.StatusBadRequest)
+		return
+	}
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	grant := models.PasteGrant{PasteKey: object.PasteKey, Permission: requestData.Permission}
+	if requestData.Username != "" {
+		user, err := h.Users.ReadUserByUsername(ctx, requestData.Username)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if user.UserID == principalFrom(r).UserID {
+			http.Error(w, "Bad Request: cannot share a paste with yourself", http.StatusBadRequest)
+			return
+		}
+		grant.GranteeType, grant.GranteeID, grant.GranteeName = models.GranteeUser, user.UserID, user.Name
+	} else {
+		orgID, err := uuid.Parse(requestData.OrgID)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid orgId", http.StatusBadRequest)
+			return
+		}
+		org, err := h.Users.ReadOrganisation(ctx, orgID)
+		if err != nil {
+			http.Error(w, "Organisation not found", http.StatusNotFound)
+			return
+		}
+		grant.GranteeType, grant.GranteeID, grant.GranteeName = models.GranteeOrg, org.OrgID, org.Name
+	}
+
+	if err := h.Shares.SetPasteGrant(ctx, &grant); err != nil {
+		http.Error(w, "Error: Cannot share paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot grant access to paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(grant)
+	w.Write(data)
+}
+
+// DeletePasteGrant takes the rights of a user or organisation away
+func (h *Handlers) DeletePasteGrant(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+
+	granteeType := vars["granteeType"]
+	if granteeType != models.GranteeUser && granteeType != models.GranteeOrg {
+		http.Error(w, "Bad Request: grantee type must be user or org", http.StatusBadRequest)
+		return
+	}
+	granteeID, err := uuid.Parse(vars["granteeId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid grantee id", http.StatusBadRequest)
+		return
+	}
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Shares.DeletePasteGrant(ctx, object.PasteKey, granteeType, granteeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot remove grant", http.StatusInternalServerError)
+		log.Println("Error: Cannot remove grant of paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateShareLink creates a signed link that lets anyone read the paste until it expires or
+// was used maxUses times
+func (h *Handlers) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.ShareLinkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+	lifetime := defaultShareLinkLifetime
+	if requestData.ExpiresIn != 0 {
+		lifetime = time.Duration(requestData.ExpiresIn) * time.Second
+	}
+	if lifetime <= 0 || lifetime > maxShareLinkLifetime {
+		http.Error(w, "Bad Request: expiresIn must be between 1 second and 30 days", http.StatusBadRequest)
+		return
+	}
+	if requestData.MaxUses != nil && *requestData.MaxUses < 1 {
+		http.Error(w, "Bad Request: maxUses must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	link := models.ShareLink{
+		PasteKey:  object.PasteKey,
+		CreatedBy: principal.UserID,
+		// the token carries the expiry in seconds, the stored one has to match it
+		ExpiresAt: time.Now().Add(lifetime).Truncate(time.Second),
+		MaxUses:   requestData.MaxUses,
+	}
+	if err := h.Shares.CreateShareLink(ctx, &link); err != nil {
+		http.Error(w, "Error: Cannot create share link", http.StatusInternalServerError)
+		log.Println("Error: Cannot create share link for paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+	link.URL = shareLinkURL(link)
+
+	w.WriteHeader(http.StatusCreated)
+	data, _ := json.Marshal(link)
+	w.Write(data)
+}
+
+// GetShareLinks lists the links of the paste with their use counts
+func (h *Handlers) GetShareLinks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := h.Shares.ReadShareLinks(ctx, object.PasteKey)
+	if err != nil {
+		http.Error(w, "Error: Cannot read share links", http.StatusInternalServerError)
+		log.Println("Error: Cannot read share links of paste " + object.PasteKey + ": " + err.Error())
+		return
+	}
+	for i := range links {
+		links[i].URL = shareLinkURL(links[i])
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"pastekey": object.PasteKey, "links": links})
+	w.Write(data)
+}
+
+// RevokeShareLink makes a link stop working before it expires
+func (h *Handlers) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	linkID, err := uuid.Parse(mux.Vars(r)["linkId"])
+	if err != nil {
+		http.Error(w, "Bad Request: invalid link id", http.StatusBadRequest)
+		return
+	}
+
+	object, ok := h.readManagedPaste(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Shares.RevokeShareLink(ctx, object.PasteKey, linkID, time.Now()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error: Cannot revoke share link", http.StatusInternalServerError)
+		log.Println("Error: Cannot revoke share link: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedPaste opens a paste with a share link token, no account is needed.
+// Every request counts as one use of the link.
+func (h *Handlers) GetSharedPaste(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	now := time.Now()
+
+	linkID, err := verifyShareLink(mux.Vars(r)["token"], now)
+	if err != nil {
+		http.Error(w, "Share link is invalid or expired", http.StatusNotFound)
+		return
+	}
+
+	pasteKey, err := h.Shares.UseShareLink(ctx, linkID, now)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Error: Cannot use share link: " + err.Error())
+		}
+		http.Error(w, "Share link is invalid or expired", http.StatusNotFound)
+		return
+	}
+
+	object, err := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+	messageId, err := primitive.ObjectIDFromHex(object.MessageID)
+	if err != nil {
+		http.Error(w, "Error", http.StatusInternalServerError)
+		log.Println("Error: Cannot convert from string to primitive.ObjectId")
+		return
+	}
+	message, err := h.Messages.ReadMessage(ctx, messageId)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve paste: " + pasteKey + "!")
+		return
+	}
+
+	if err := h.Objects.IncrementObjectViews(ctx, pasteKey); err != nil {
+		log.Println("Error: Cannot increment views of paste: " + pasteKey + ": " + err.Error())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"PasteKey":   object.PasteKey,
+		"Message":    message.MessageBody,
+		"Language":   object.Language,
+		"Visibility": object.Visibility,
+		"Stars":      object.Stars,
+	})
+	w.Write(data)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"os"
+	"pastebin/models"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareLinkSignature(t *testing.T) {
+	ShareLinkSecret = []byte(strings.Repeat("s", minShareLinkSecretLength))
+	now := time.Now()
+	linkID := uuid.New()
+	token := signShareLink(linkID, now.Add(time.Hour))
+
+	parsed, err := verifyShareLink(token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, linkID, parsed)
+
+	// Expired
+	_, err = verifyShareLink(token, now.Add(2*time.Hour))
+	assert.Error(t, err)
+
+	// Tampered
+	tampered := []byte(token)
+	tampered[0] ^= 1
+	_, err = verifyShareLink(string(tampered), now)
+	assert.Error(t, err)
+	_, err = verifyShareLink("not-a-token", now)
+	assert.Error(t, err)
+
+	// Signed with another secret
+	ShareLinkSecret = []byte(strings.Repeat("o", minShareLinkSecretLength))
+	_, err = verifyShareLink(token, now)
+	assert.Error(t, err)
+}
+
+func TestLoadShareLinkSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+
+	assert.NoError(t, os.WriteFile(path, []byte("short\n"), 0600))
+	assert.Error(t, LoadShareLinkSecret(path))
+
+	secret := strings.Repeat("k", minShareLinkSecretLength)
+	assert.NoError(t, os.WriteFile(path, []byte(secret+"\n"), 0600))
+	assert.NoError(t, LoadShareLinkSecret(path))
+	assert.Equal(t, []byte(secret), ShareLinkSecret)
+
+	assert.NoError(t, LoadShareLinkSecret(""))
+	assert.Len(t, ShareLinkSecret, minShareLinkSecretLength)
+}
+
+func TestPasteAccessWithoutDatabase(t *testing.T) {
+	h := &Handlers{}
+	object := &models.Object{DevKey: "owner_dev_key", PasteKey: "paste"}
+
+	assert.Equal(t, accessNone, h.pasteAccess(context.Background(), nil, object))
+	assert.Equal(t, accessManage, h.pasteAccess(context.Background(), &Principal{DevKey: "owner_dev_key"}, object))
+	assert.Equal(t, accessNone, h.pasteAccess(context.Background(), &Principal{DevKey: "owner_dev_key"}, &models.Object{PasteKey: "paste"}))
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"pastebin/config"
+	"pastebin/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+)
+
+const (
+	ssoLoginLifetime = 10 * time.Minute
+	usernameAttempts = 10
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// OIDCProviderConfig describes a client registered at an OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCProvider is an identity provider users can log in with, using the authorization
+// code flow with PKCE
+type OIDCProvider struct {
+	Name     string
+	verifier *oidc.IDTokenVerifier
+	config   oauth2.Config
+}
+
+// oidcIdentity holds the claims of a verified ID token
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+// NewOIDCProvider reads the discovery document of the issuer and prepares the client
+func NewOIDCProvider(ctx context.Context, cfg OIDCProviderConfig) (*OIDCProvider, error) {
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("sso provider %q: issuer, client id and redirect url are required", cfg.Name)
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("sso provider %s: %w", cfg.Name, err)
+	}
+
+	return &OIDCProvider{
+		Name:     cfg.Name,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+	}, nil
+}
+
+// LoadSSOProviders prepares the provider of the sso section, there is none when its name is empty
+func LoadSSOProviders(ctx context.Context, cfg config.SSO) (map[string]*OIDCProvider, error) {
+	providers := make(map[string]*OIDCProvider)
+	if cfg.Provider == "" {
+		return providers, nil
+	}
+
+	provider, err := NewOIDCProvider(ctx, OIDCProviderConfig{
+		Name:         cfg.Provider,
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	providers[provider.Name] = provider
+	return providers, nil
+}
+
+// AuthCodeURL is where the user is sent to log in, the verifier stays with us and proves
+// at the token endpoint that we started the login
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// exchange redeems the code and checks signature, issuer, audience, expiry and nonce of the ID token
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier, nonce string) (*oidcIdentity, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("Error: no id_token in token response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("Error: id_token nonce does not match")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &oidcIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.PreferredUsername,
+	}, nil
+}
+
+// ssoUsernameBase derives a username from the preferred username or the email, leaving room
+// for a suffix in case the name is taken
+func ssoUsernameBase(identity *oidcIdentity) string {
+	name := identity.Username
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	name = usernameInvalidChars.ReplaceAllString(name, "")
+	if name == "" {
+		name = "user"
+	} else if len(name) < minUsernameLength {
+		name = "user-" + name
+	}
+	if len(name) > maxUsernameLength-5 {
+		name = name[:maxUsernameLength-5]
+	}
+	return name
+}
+
+// freeUsername returns the base name or the base name with a number, whichever is not taken
+func (h *Handlers) freeUsername(ctx context.Context, base string) (string, error) {
+	name := base
+	for i := 0; i < usernameAttempts; i++ {
+		_, err := h.Users.ReadUserByUsername(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		name = base + "-" + strconv.Itoa(1000+rand.Intn(9000))
+	}
+	return "", fmt.Errorf("Error: no free username for %s", base)
+}
+
+// ssoUser finds the user linked to the identity. On first login the identity is linked to the user
+// with the same email if both the provider and we verified it, otherwise a new user is created.
+func (h *Handlers) ssoUser(ctx context.Context, provider string, identity *oidcIdentity) (models.User, error) {
+	linked, err := h.Logins.ReadUserIdentity(ctx, provider, identity.Subject)
+	if err == nil {
+		return h.Users.ReadUserById(ctx, linked.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	email := ""
+	if isValidEmail(identity.Email) {
+		email = identity.Email
+	}
+
+	var user models.User
+	var found bool
+	if email != "" && identity.EmailVerified {
+		users, err := h.Accounts.ReadUsersByEmail(ctx, email)
+		if err != nil {
+			return models.User{}, err
+		}
+		for _, candidate := range users {
+			if candidate.EmailVerified {
+				if found {
+					return models.User{}, fmt.Errorf("Error: several verified users with email %s", email)
+				}
+				user, found = candidate, true
+			}
+		}
+	}
+
+	if !found {
+		user, err = h.createSSOUser(ctx, identity, email)
+		if err != nil {
+			return models.User{}, err
+		}
+	}
+
+	err = h.Logins.CreateUserIdentity(ctx, &models.UserIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserID:   user.UserID,
+		Email:    email,
+	})
+	return user, err
+}
+
+// createSSOUser registers a user for an identity, the random password is never shown, users can
+// set one with a password reset
+func (h *Handlers) createSSOUser(ctx context.Context, identity *oidcIdentity, email string) (models.User, error) {
+	name, err := h.freeUsername(ctx, ssoUsernameBase(identity))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	password, err := newRandomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	devkey, err := h.DevKeys.Check(ctx, "")
+	if err != nil {
+		return models.User{}, fmt.Errorf("Error: Cannot create key for user: %w", err)
+	}
+
+	user := models.User{
+		Name:     name,
+		Password: hash,
+		PasteNum: 0,
+		DevKey:   devkey,
+		Email:    email,
+	}
+	_, err = h.Users.CreateUser(ctx, &user)
+	if email != "" && userConflictField(err) == "email" {
+		// the email belongs to an account that hasn't verified it, the new user goes without
+		user.Email, email = "", ""
+		_, err = h.Users.CreateUser(ctx, &user)
+	}
+	if err != nil {
+		if err := h.DevKeys.Release(ctx, devkey); err != nil {
+			log.Println("Error: Cannot release devkey: " + err.Error())
+		}
+		return models.User{}, err
+	}
+
+	if email != "" && identity.EmailVerified {
+		if err := h.Accounts.VerifyUserEmail(ctx, user.UserID, email); err != nil {
+			return models.User{}, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
+
+// readSSOProvider returns the provider named in the route
+func (h *Handlers) readSSOProvider(w http.ResponseWriter, r *http.Request) (*OIDCProvider, bool) {
+	provider, ok := h.SSOProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		http.Error(w, "Unknown sso provider", http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+// GetSSOProviders lists the identity providers the frontend can offer
+func (h *Handlers) GetSSOProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.SSOProviders))
+	for name := range h.SSOProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"Providers": names})
+	w.Write(data)
+}
+
+// StartSSOLogin remembers state, nonce and PKCE verifier of a new login and returns the url
+// of the identity provider the frontend sends the user to
+func (h *Handlers) StartSSOLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	provider, ok := h.readSSOProvider(w, r)
+	if !ok {
+		return
+	}
+
+	state, errState := newRandomToken()
+	nonce, errNonce := newRandomToken()
+	if errState != nil || errNonce != nil {
+		http.Error(w, "Error: Cannot start login", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	login := models.SsoLogin{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(ssoLoginLifetime),
+	}
+	if err := h.Logins.CreateSsoLogin(ctx, &login); err != nil {
+		log.Println("Error: Cannot save sso login: " + err.Error())
+		http.Error(w, "Error: Cannot start login", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"AuthURL": provider.AuthCodeURL(state, nonce, verifier)})
+	w.Write(data)
+}
+
+// FinishSSOLogin takes code and state the provider redirected back with and logs the user in,
+// the response is the same as for /api/login
+func (h *Handlers) FinishSSOLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	provider, ok := h.readSSOProvider(w, r)
+	if !ok {
+		return
+	}
+
+	var requestData models.SSOCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Code == "" || requestData.State == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	login, err := h.Logins.UseSsoLogin(ctx, hashToken(requestData.State), time.Now())
+	if err != nil || login.Provider != provider.Name {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Error: Cannot read sso login: " + err.Error())
+		}
+		http.Error(w, "Error: invalid or expired login", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := provider.exchange(ctx, requestData.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Println("Error: sso login at " + provider.Name + " failed: " + err.Error())
+		http.Error(w, "Error: login at identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.ssoUser(ctx, provider.Name, identity)
+	if err != nil {
+		log.Println("Error: Cannot find or create user for sso login: " + err.Error())
+		http.Error(w, "Error: Cannot login", http.StatusInternalServerError)
+		return
+	}
+
+	h.loginOrChallenge(w, r, user, requestData.Device)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pastebin/config"
+	"pastebin/db"
+	"pastebin/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const (
+	fakeClientID     = "pastebin"
+	fakeClientSecret = "secret"
+	fakeRedirectURL  = "http://localhost:3000/sso/callback"
+)
+
+// fakeAuthorization is what the fake provider remembers about an issued code
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+// fakeOIDCProvider is an in-process identity provider serving discovery, keys and the token
+// endpoint, it signs ID tokens for the user who "logged in" at authorize
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	keys   *KeyRing
+	claims jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]fakeAuthorization
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	material := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+
+	keys := NewKeyRing()
+	if err := keys.AddKey("idp", "RS256", material); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetActive("idp"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeOIDCProvider{
+		keys:  keys,
+		codes: make(map[string]fakeAuthorization),
+		claims: jwt.MapClaims{
+			"sub":                "248289761001",
+			"email":              "jane@example.com",
+			"email_verified":     true,
+			"preferred_username": "jane",
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                fake.server.URL,
+			"authorization_endpoint":                fake.server.URL + "/authorize",
+			"token_endpoint":                        fake.server.URL + "/token",
+			"jwks_uri":                              fake.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(fake.keys.JWKS())
+	})
+	mux.HandleFunc("/token", fake.token)
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+// authorize plays the user logging in at the provider and returns code and state of the redirect
+func (f *fakeOIDCProvider) authorize(t *testing.T, authURL string) (string, string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := parsed.Query()
+	assert.Equal(t, f.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "code", params.Get("response_type"))
+	assert.Equal(t, fakeClientID, params.Get("client_id"))
+	assert.Equal(t, fakeRedirectURL, params.Get("redirect_uri"))
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+	assert.Contains(t, params.Get("scope"), "openid")
+
+	code, err := newRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.codes[code] = fakeAuthorization{challenge: params.Get("code_challenge"), nonce: params.Get("nonce")}
+	f.mu.Unlock()
+
+	return code, params.Get("state")
+}
+
+func (f *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != fakeClientID || clientSecret != fakeClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	authorization, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   f.server.URL,
+		"aud":   fakeClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for key, value := range f.claims {
+		claims[key] = value
+	}
+	idToken, err := f.keys.Sign(claims)
+	if err != nil {
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func newTestOIDCProvider(t *testing.T, fake *fakeOIDCProvider) *OIDCProvider {
+	providers, err := LoadSSOProviders(context.Background(), config.SSO{
+		Provider:     "corp",
+		Issuer:       fake.server.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: fakeClientSecret,
+		RedirectURL:  fakeRedirectURL,
+		Scopes:       []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return providers["corp"]
+}
+
+func TestLoadSSOProviders(t *testing.T) {
+	providers, err := LoadSSOProviders(context.Background(), config.Default().SSO)
+	assert.NoError(t, err)
+	assert.Empty(t, providers)
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	fake := newFakeOIDCProvider(t)
+	provider := newTestOIDCProvider(t, fake)
+
+	verifier := oauth2.GenerateVerifier()
+	code, state := fake.authorize(t, provider.AuthCodeURL("state", "nonce", verifier))
+	assert.Equal(t, "state", state)
+
+	identity, err := provider.exchange(context.Background(), code, verifier, "nonce")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "248289761001", identity.Subject)
+	assert.Equal(t, "jane@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "jane", identity.Username)
+
+	// codes work only once
+	_, err = provider.exchange(context.Background(), code, verifier, "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCRejectsWrongVerifier(t *testing.T) {
+	fake := newFakeOIDCProvider(t)
+	provider := newTestOIDCProvider(t, fake)
+
+	code, _ := fake.authorize(t, provider.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()))
+
+	_, err := provider.exchange(context.Background(), code, oauth2.GenerateVerifier(), "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCRejectsWrongNonce(t *testing.T) {
+	fake := newFakeOIDCProvider(t)
+	provider := newTestOIDCProvider(t, fake)
+
+	verifier := oauth2.GenerateVerifier()
+	code, _ := fake.authorize(t, provider.AuthCodeURL("state", "nonce", verifier))
+
+	_, err := provider.exchange(context.Background(), code, verifier, "other")
+	assert.Error(t, err)
+}
+
+func TestOIDCRejectsTokenForOtherClient(t *testing.T) {
+	fake := newFakeOIDCProvider(t)
+	fake.claims["aud"] = "other-client"
+	provider := newTestOIDCProvider(t, fake)
+
+	verifier := oauth2.GenerateVerifier()
+	code, _ := fake.authorize(t, provider.AuthCodeURL("state", "nonce", verifier))
+
+	_, err := provider.exchange(context.Background(), code, verifier, "nonce")
+	assert.Error(t, err)
+}
+
+// failingUsers is a UserStore that can't create users
+type failingUsers struct {
+	db.UserStore
+}
+
+func (failingUsers) CreateUser(ctx context.Context, user *models.User) (uuid.UUID, error) {
+	return uuid.Nil, errors.New("users are not created")
+}
+
+func TestCreateSSOUserReleasesDevKey(t *testing.T) {
+	_, h := newStoreHandlers(t)
+	h.Users = failingUsers{h.Users}
+	before, err := h.DevKeys.Stats(context.Background())
+	assert.NoError(t, err)
+
+	_, err = h.createSSOUser(context.Background(), &oidcIdentity{Subject: "1", Username: "jane"}, "jane@example.com")
+	assert.Error(t, err)
+	after, err := h.DevKeys.Stats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, before.Used, after.Used)
+}
+
+func TestSSOUsernameBase(t *testing.T) {
+	assert.Equal(t, "jane", ssoUsernameBase(&oidcIdentity{Username: "jane", Email: "other@example.com"}))
+	assert.Equal(t, "jane.doe", ssoUsernameBase(&oidcIdentity{Email: "jane.doe@example.com"}))
+	assert.Equal(t, "JaneDoe", ssoUsernameBase(&oidcIdentity{Username: "Jane Doe!"}))
+	assert.Equal(t, "user", ssoUsernameBase(&oidcIdentity{Username: "@@@"}))
+	assert.Equal(t, "user-jo", ssoUsernameBase(&oidcIdentity{Username: "jo"}))
+	assert.Len(t, ssoUsernameBase(&oidcIdentity{Username: "averyveryverylongusername"}), maxUsernameLength-5)
+}
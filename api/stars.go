@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"pastebin/models"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// starPaste stars or unstars the paste from the route for the user from the token
+func (h *Handlers) starPaste(w http.ResponseWriter, r *http.Request, star bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	// stars can be removed from pastes that were made private meanwhile
+	object, errObj := h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if errObj != nil || (star && !h.canReadPaste(r, object)) {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	if star {
+		err = h.Library.StarPaste(ctx, principal.UserID, pasteKey)
+	} else {
+		err = h.Library.UnstarPaste(ctx, principal.UserID, pasteKey)
+	}
+	if err != nil {
+		http.Error(w, "Error: Cannot star paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot change star of paste " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	object, errObj = h.Objects.ReadObjectWithoutDevKey(ctx, pasteKey)
+	if errObj != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"PasteKey": pasteKey, "Starred": star, "Stars": object.Stars})
+	w.Write(data)
+}
+
+func (h *Handlers) StarPaste(w http.ResponseWriter, r *http.Request) {
+	h.starPaste(w, r, true)
+}
+
+func (h *Handlers) UnstarPaste(w http.ResponseWriter, r *http.Request) {
+	h.starPaste(w, r, false)
+}
+
+// GetStarredPastes lists pastes the user starred, most recently starred first, ?limit=20&cursor=...
+func (h *Handlers) GetStarredPastes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	limit := defaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	var after *models.ObjectCursor
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		var err error
+		if after, err = decodeCursor(value); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	objects, starredAt, hasMore, err := h.Library.ReadStarredObjectsPage(ctx, principal.UserID, principal.DevKey, limit, after)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve starred pastes", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve starred pastes: " + err.Error())
+		return
+	}
+
+	pastes, err := h.buildPasteSummaries(ctx, objects, true)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve starred pastes", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve starred pastes: " + err.Error())
+		return
+	}
+	hideOwners(pastes)
+
+	nextCursor := ""
+	if hasMore {
+		last := len(objects) - 1
+		nextCursor = encodeCursor(models.ObjectCursor{
+			SortValue: starredAt[last].UTC().Format(time.RFC3339Nano),
+			PasteKey:  objects[last].PasteKey,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"pastes":     pastes,
+		"nextCursor": nextCursor,
+	})
+	w.Write(data)
+}
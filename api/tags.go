@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"pastebin/models"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxTagsPerPaste = 20
+	maxTagLength    = 32
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.+#-]*$`)
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags lowercases and deduplicates tags, it fails on tags that are empty, too long or contain other characters
+func normalizeTags(tags []string) ([]string, bool) {
+	if len(tags) > maxTagsPerPaste {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, true
+}
+
+// SetPasteTags replaces all tags of one of the user's pastes
+func (h *Handlers) SetPasteTags(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+	pasteKey := mux.Vars(r)["pasteKey"]
+
+	var requestData models.TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		log.Println(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	tags, ok := normalizeTags(requestData.Tags)
+	if !ok {
+		log.Println("Bad request for tagging paste " + pasteKey + ": invalid tags")
+		http.Error(w, "Bad Request: invalid tags", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.readPasteWithAccess(ctx, principal, pasteKey, accessManage); err != nil {
+		http.Error(w, "Paste not found", http.StatusNotFound)
+		log.Println("Error: User devkey: " + devkey + " tried to tag paste: " + pasteKey + " but paste doesnt exist or he is not authorized!")
+		return
+	}
+
+	if err := h.Objects.SetPasteTags(ctx, pasteKey, tags); err != nil {
+		http.Error(w, "Error: Cannot tag paste", http.StatusInternalServerError)
+		log.Println("Error: Cannot tag paste: " + pasteKey + ": " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"PasteKey": pasteKey, "Tags": tags})
+	w.Write(data)
+}
+
+// GetTags autocompletes tags from the ones the user already used, ?prefix=go&limit=10
+func (h *Handlers) GetTags(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+	devkey := principal.DevKey
+
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	tags, err := h.Library.ReadTagsByPrefix(ctx, devkey, normalizeTag(r.URL.Query().Get("prefix")), limit)
+	if err != nil {
+		http.Error(w, "Error: Cannot retrieve tags", http.StatusInternalServerError)
+		log.Println("Error: Cannot retrieve tags: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"tags": tags})
+	w.Write(data)
+}
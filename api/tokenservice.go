@@ -1,23 +1,17 @@
 package api
 
 import (
-	"log"
 	//"encoding/json"
 	"net/http"
 	"strings"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"fmt"
 	"time"
 )
 
-var secretKey = []byte("jwt_secret_key")
-
-
 var keyFunc = func(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, fmt.Errorf("Error: wrong authorization method used")
-	}
-	return secretKey, nil
+	return SigningKeys.Keyfunc(token)
 }
 
 type Exception struct {
@@ -30,13 +24,22 @@ type Exception struct {
 // 	jwt.RegisteredClaims
 // }
 
-func CreateNewToken(username, devkey string)(string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// access tokens are short lived, clients get new ones with their refresh token
+const accessTokenLifetime = 15 * time.Minute
+
+// every access token has its own jti so it can be revoked on logout. Requests are resolved to the
+// user in sub, the other claims are informational, e.g. they are authorized with the role stored for the user.
+func CreateNewToken(userID uuid.UUID, username, devkey, role string)(string, error) {
+	now := time.Now()
+	return SigningKeys.Sign(jwt.MapClaims{
+		"sub":		userID.String(),
 		"username": username,
 		"devkey": 	devkey,
-		"exp":      time.Now().Add(time.Hour * time.Duration(1)).Unix(),
+		"role":		role,
+		"jti":		uuid.NewString(),
+		"iat":		now.Unix(),
+		"exp":      now.Add(accessTokenLifetime).Unix(),
 	})
-	return  token.SignedString(secretKey)	
 }
 
 // func ParseAccesToken(accessToken string) *UserClaims {
@@ -46,7 +49,11 @@ func CreateNewToken(username, devkey string)(string, error) {
 // 	return parsedAccessToken.Claims.(*UserClaims)
 // }
 
-func ParseAccesToken(r *http.Request) (jwt.MapClaims, error) {
+// parseAccessToken verifies the bearer token of the request and that it was not revoked
+func (h *Handlers) parseAccessToken(r *http.Request) (jwt.MapClaims, error) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
 	authorizationHeader := r.Header.Get("Authorization")
 	if authorizationHeader == "" {			
 		return nil, fmt.Errorf("Error: You're Unauthorized due to invalid token!")
@@ -62,47 +69,37 @@ func ParseAccesToken(r *http.Request) (jwt.MapClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok && parsedToken.Valid{
-		return claims, nil
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || !parsedToken.Valid {
+		return nil, fmt.Errorf("Error: You're Unauthorized due to invalid token!")
 	}
 
-	return nil, fmt.Errorf("Error: You're Unauthorized due to invalid token!")
-
-}
-
-func ValidateJWTToken(next http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authorizationHeader := r.Header.Get("Authorization")
-		if authorizationHeader != "" {
-			
-			bearerToken := strings.Split(authorizationHeader, " ")
-			if len(bearerToken) == 2 && bearerToken[0] == "Bearer"{
-				token, error := jwt.Parse(bearerToken[1], keyFunc)
-				if error != nil {
-					http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-					log.Println("Unauthorized access: Try to access " + r.URL.String())
-					return
-				}
+	// challenges of the 2FA login are signed with the same keys but are not access tokens
+	if _, ok := claims["purpose"]; ok {
+		return nil, fmt.Errorf("Error: You're Unauthorized due to invalid token!")
+	}
 
-				if token.Valid {
-					next.ServeHTTP(w, r)
-				} else {
-					http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-					log.Println("Unauthorized access: Try to access " + r.URL.String())
-				}
-				
-			} else {
-				http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-				log.Println("Unauthorized access: Try to access " + r.URL.String())
-				//json.NewEncoder(w).Encode(Exception{Message: "Bad authorization header"})
-			}
+	// tokens without jti can't be revoked, so they are not accepted
+	jti, err := tokenID(claims)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := h.Users.IsAccessTokenRevoked(ctx, jti)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("Error: token is revoked!")
+	}
 
-		} else {
+	return claims, nil
+}
 
-			http.Error(w,"You're Unauthorized due to invalid token", http.StatusUnauthorized)
-			// w.WriteHeader(http.StatusUnauthorized)
-			log.Println("Unauthorized access: Try to access " + r.URL.String())
-			// json.NewEncoder(w).Encode(Exception{Message: "Authorization header is required"})
-		}
-	})
-}
\ No newline at end of file
+// tokenID reads the jti claim of a parsed token
+func tokenID(claims jwt.MapClaims) (uuid.UUID, error) {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("Error: token has no jti!")
+	}
+	return uuid.Parse(jti)
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pastebin/models"
+	"pastebin/totp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer                 = "Pastebin"
+	twoFactorChallengeLifetime = 5 * time.Minute
+	twoFactorPurpose           = "2fa"
+	recoveryCodeCount          = 10
+)
+
+// createTwoFactorChallenge signs a token proving the password was checked, it can only be
+// exchanged for a session at /api/login/2fa together with a code
+func createTwoFactorChallenge(user models.User) (string, error) {
+	now := time.Now()
+	return SigningKeys.Sign(jwt.MapClaims{
+		"sub":     user.UserID.String(),
+		"purpose": twoFactorPurpose,
+		"jti":     uuid.NewString(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(twoFactorChallengeLifetime).Unix(),
+	})
+}
+
+// parseTwoFactorChallenge checks the challenge and returns the user it was issued to
+// together with its jti and expiration, used to make it single use
+func parseTwoFactorChallenge(challenge string) (uuid.UUID, uuid.UUID, time.Time, error) {
+	parsed, err := jwt.Parse(challenge, keyFunc)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, err
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid || claims["purpose"] != twoFactorPurpose {
+		return uuid.Nil, uuid.Nil, time.Time{}, fmt.Errorf("Error: invalid challenge token!")
+	}
+
+	subject, _ := claims.GetSubject()
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, err
+	}
+	jti, err := tokenID(claims)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return uuid.Nil, uuid.Nil, time.Time{}, fmt.Errorf("Error: invalid challenge token!")
+	}
+	return userID, jti, expiresAt.Time, nil
+}
+
+// newRecoveryCodes returns codes to show to the user once and their hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(buf)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode lets users type recovery codes in lower case and without the dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// verifySecondFactor accepts a code from the authenticator app or an unused recovery code,
+// both work only once
+func (h *Handlers) verifySecondFactor(ctx context.Context, userTotp *models.UserTotp, code string) (bool, error) {
+	if step, ok := totp.Validate(userTotp.Secret, code, time.Now()); ok {
+		err := h.Logins.UseTotpStep(ctx, userTotp.UserID, step)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err := h.Logins.UseRecoveryCode(ctx, userTotp.UserID, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readEnabledTotp loads the 2FA settings of the principal and checks the code of the request
+func (h *Handlers) readEnabledTotp(w http.ResponseWriter, r *http.Request) (*models.UserTotp, bool) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.TotpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Code == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	userTotp, err := h.Logins.ReadTotp(ctx, principal.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error: Cannot read 2FA settings", http.StatusInternalServerError)
+		log.Println("Error: Cannot read 2FA settings: " + err.Error())
+		return nil, false
+	}
+	if err != nil || !userTotp.Enabled {
+		http.Error(w, "Two factor authentication is not enabled", http.StatusConflict)
+		return nil, false
+	}
+
+	ok, err := h.verifySecondFactor(ctx, userTotp, requestData.Code)
+	if err != nil {
+		http.Error(w, "Error: Cannot check code", http.StatusInternalServerError)
+		log.Println("Error: Cannot check 2FA code: " + err.Error())
+		return nil, false
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return nil, false
+	}
+	return userTotp, true
+}
+
+// GetTwoFactorStatus tells if 2FA is enabled and how many recovery codes are left
+func (h *Handlers) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	enabled := false
+	remaining := 0
+	userTotp, err := h.Logins.ReadTotp(ctx, principal.UserID)
+	if err == nil && userTotp.Enabled {
+		enabled = true
+		remaining, err = h.Logins.CountRecoveryCodes(ctx, principal.UserID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error: Cannot read 2FA status", http.StatusInternalServerError)
+		log.Println("Error: Cannot read 2FA status: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"Enabled": enabled, "RecoveryCodesLeft": remaining})
+	w.Write(data)
+}
+
+// EnrollTotp creates a new secret, 2FA is enabled once the user confirms it with a code
+func (h *Handlers) EnrollTotp(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Error: Cannot enroll 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Logins.SaveTotpSecret(ctx, &models.UserTotp{UserID: principal.UserID, Secret: secret}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Two factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error: Cannot enroll 2FA", http.StatusInternalServerError)
+		log.Println("Error: Cannot save TOTP secret: " + err.Error())
+		return
+	}
+
+	uri := totp.ProvisioningURI(totpIssuer, principal.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, "Error: Cannot enroll 2FA", http.StatusInternalServerError)
+		log.Println("Error: Cannot create QR code: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"Secret": secret,
+		"URI":    uri,
+		"QRCode": "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+	w.Write(data)
+}
+
+// EnableTotp confirms the enrolled secret with a code and returns recovery codes, they are shown only once
+func (h *Handlers) EnableTotp(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	principal := principalFrom(r)
+
+	var requestData models.TotpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Code == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	userTotp, err := h.Logins.ReadTotp(ctx, principal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Enroll two factor authentication first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error: Cannot read 2FA settings", http.StatusInternalServerError)
+		log.Println("Error: Cannot read 2FA settings: " + err.Error())
+		return
+	}
+	if userTotp.Enabled {
+		http.Error(w, "Two factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(userTotp.Secret, requestData.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error: Cannot enable 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Logins.EnableTotp(ctx, principal.UserID, step, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error: Cannot enable 2FA", http.StatusInternalServerError)
+		log.Println("Error: Cannot enable 2FA: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"RecoveryCodes": codes})
+	w.Write(data)
+}
+
+// DisableTotp turns 2FA off, it needs a current code so a stolen session alone can't do it
+func (h *Handlers) DisableTotp(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	userTotp, ok := h.readEnabledTotp(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Logins.DeleteTotp(ctx, userTotp.UserID); err != nil {
+		http.Error(w, "Error: Cannot disable 2FA", http.StatusInternalServerError)
+		log.Println("Error: Cannot disable 2FA: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes with new ones
+func (h *Handlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	userTotp, ok := h.readEnabledTotp(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error: Cannot create recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Logins.ReplaceRecoveryCodes(ctx, userTotp.UserID, hashes); err != nil {
+		http.Error(w, "Error: Cannot create recovery codes", http.StatusInternalServerError)
+		log.Println("Error: Cannot replace recovery codes: " + err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{"RecoveryCodes": codes})
+	w.Write(data)
+}
+
+// TwoFactorLoginHandler exchanges the challenge from LoginHandler and a code for a session
+func (h *Handlers) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+
+	var requestData models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.ChallengeToken == "" || requestData.Code == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	userID, jti, expiresAt, err := parseTwoFactorChallenge(requestData.ChallengeToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+	used, err := h.Users.IsAccessTokenRevoked(ctx, jti)
+	if err != nil || used {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	userTotp, err := h.Logins.ReadTotp(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error: Cannot read 2FA settings", http.StatusInternalServerError)
+		log.Println("Error: Cannot read 2FA settings: " + err.Error())
+		return
+	}
+	if err != nil || !userTotp.Enabled {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.Users.ReadUserById(ctx, userID)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	// wrong codes count as failed logins, so codes can't be guessed within the lifetime of a challenge
+	start := time.Now()
+	userKey, ipKey := loginThrottleKeys(user.Name, clientIP(r))
+	if !h.checkLoginBlocked(w, r, userKey, ipKey) {
+		return
+	}
+
+	ok, err := h.verifySecondFactor(ctx, userTotp, requestData.Code)
+	if err != nil {
+		http.Error(w, "Error: Cannot check code", http.StatusInternalServerError)
+		log.Println("Error: Cannot check 2FA code: " + err.Error())
+		return
+	}
+	if !ok {
+		h.loginFailed(w, r, start, userKey, ipKey, "Invalid code")
+		return
+	}
+	h.clearUserLoginFailures(ctx, user.Name)
+
+	// the challenge is single use, it is revoked like an access token
+	if err := h.Logins.RevokeAccessToken(ctx, jti, expiresAt); err != nil {
+		log.Println("Error: Cannot revoke 2FA challenge: " + err.Error())
+	}
+
+	h.completeLogin(w, r, user, requestData.Device)
+}
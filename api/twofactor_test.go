@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http/httptest"
+	"pastebin/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoFactorChallenge(t *testing.T) {
+	ring := NewKeyRing()
+	assert.NoError(t, ring.AddKey("test", "HS256", []byte("0123456789abcdef0123456789abcdef")))
+	assert.NoError(t, ring.SetActive("test"))
+	SigningKeys = ring
+
+	user := models.User{UserID: uuid.New(), Name: "alice"}
+	challenge, err := createTwoFactorChallenge(user)
+	assert.NoError(t, err)
+
+	userID, jti, _, err := parseTwoFactorChallenge(challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, user.UserID, userID)
+	assert.NotEqual(t, uuid.Nil, jti)
+
+	// the challenge doesn't work as access token
+	r := httptest.NewRequest("GET", "/api/getUserInfo", nil)
+	r.Header.Set("Authorization", "Bearer "+challenge)
+	_, err = (&Handlers{}).parseAccessToken(r)
+	assert.Error(t, err)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, codes[0], 11)
+
+	// codes typed in lower case and without the dash match the stored hash
+	assert.Equal(t, hashes[0], hashToken(normalizeRecoveryCode(codes[0])))
+	lower := normalizeRecoveryCode(" " + strings.ToLower(codes[1][:5]+codes[1][6:]) + " ")
+	assert.Equal(t, hashes[1], hashToken(lower))
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"pastebin/db"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 20
+	minPasswordLength = 8
+	// passphrases at least this long don't need several kinds of characters
+	passphraseLength = 16
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// commonPasswords are refused even though they pass the other rules
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"12345678": true, "123456789": true, "1234567890": true, "11111111": true,
+	"qwertyui": true, "qwerty123": true, "1q2w3e4r": true, "abc12345": true,
+	"iloveyou": true, "letmein1": true, "welcome1": true, "admin123": true,
+}
+
+// userConflictFields maps the unique indexes of Users to the field clients sent
+var userConflictFields = map[string]string{
+	"users_name_lower_idx":  "username",
+	"users_email_lower_idx": "email",
+	"users_dev_key_key":     "devkey",
+	"Users.dev_key":         "devkey",
+}
+
+// isValidUsername accepts 3 to 20 letters, digits, dots, dashes and underscores
+func isValidUsername(name string) bool {
+	return len(name) >= minUsernameLength && len(name) <= maxUsernameLength && usernamePattern.MatchString(name)
+}
+
+// passwordProblem explains why a password can't be used, it is empty for a good password.
+// Username and email may be empty when they are not known.
+func passwordProblem(password, username, email string) string {
+	if len(password) < minPasswordLength {
+		return "password must have at least 8 characters"
+	}
+	if len(password) > maxPasswordLength {
+		return "password must have at most 72 characters"
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return "password is too common"
+	}
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return "password must not contain the username"
+	}
+	if local := strings.SplitN(strings.ToLower(email), "@", 2)[0]; len(local) >= minUsernameLength && strings.Contains(lower, local) {
+		return "password must not contain the email"
+	}
+
+	if len(password) < passphraseLength && characterClasses(password) < 2 {
+		return "password must mix letters, digits or symbols, or have at least 16 characters"
+	}
+	return ""
+}
+
+// characterClasses counts which of letters, digits and other characters the password has
+func characterClasses(password string) int {
+	var letter, digit, other bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			letter = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, has := range []bool{letter, digit, other} {
+		if has {
+			count++
+		}
+	}
+	return count
+}
+
+// userConflictField names the field a unique index of Users refused, it is empty for other errors
+func userConflictField(err error) string {
+	index, ok := db.UniqueViolation(err)
+	if !ok {
+		return ""
+	}
+	return userConflictFields[index]
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidUsername(t *testing.T) {
+	for _, name := range []string{"bob", "jane.doe", "user-1234", "A_b", "abcdefghijklmnopqrst"} {
+		assert.True(t, isValidUsername(name), name)
+	}
+	for _, name := range []string{"", "jo", "jane doe", "jane@example.com", "abcdefghijklmnopqrstu", "ime✓"} {
+		assert.False(t, isValidUsername(name), name)
+	}
+}
+
+func TestPasswordProblem(t *testing.T) {
+	for _, password := range []string{"s3cret-pw", "Tr0ubadour", "correct horse battery", "averylongpassphrase"} {
+		assert.Empty(t, passwordProblem(password, "jane", "jane@example.com"), password)
+	}
+
+	cases := map[string]string{
+		"short1":                           "at least 8",
+		strings.Repeat("abc123", 12) + "x": "at most 72",
+		"Password123":                      "too common",
+		"xJANE2024":                        "username",
+		"janedoe-99":                       "username",
+		"onlyletters":                      "mix",
+		"12345678901":                      "mix",
+	}
+	for password, problem := range cases {
+		assert.Contains(t, passwordProblem(password, "jane", "other@example.com"), problem, password)
+	}
+
+	assert.Contains(t, passwordProblem("mailbox-77", "jane", "mailbox@example.com"), "email")
+	// without username and email only the other rules apply
+	assert.Empty(t, passwordProblem("jane-2024", "", ""))
+}
+
+func TestUserConflictField(t *testing.T) {
+	err := fmt.Errorf("insert user: %w", &pq.Error{Code: "23505", Constraint: "users_email_lower_idx"})
+	assert.Equal(t, "email", userConflictField(err))
+	assert.Equal(t, "username", userConflictField(&pq.Error{Code: "23505", Constraint: "users_name_lower_idx"}))
+	assert.Equal(t, "", userConflictField(&pq.Error{Code: "23502", Constraint: "users_name_lower_idx"}))
+	assert.Equal(t, "", userConflictField(fmt.Errorf("connection refused")))
+}
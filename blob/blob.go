@@ -0,0 +1,92 @@
+// Package blob stores the content of pastes in Mongo, in a local directory or in an S3 compatible
+// object storage, and moves it from one of them to another.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pastebin/config"
+	"regexp"
+)
+
+// backends that content.backend selects
+const (
+	BackendMongo      = config.BackendMongo
+	BackendFilesystem = config.BackendFilesystem
+	BackendS3         = config.BackendS3
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// keys are message ids, they are also used as file names and object keys
+var keyPattern = regexp.MustCompile(`^[0-9A-Za-z_-]{1,128}$`)
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, body []byte) error
+	// Get returns ErrNotFound for keys that were never stored or were deleted
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete succeeds for keys that don't exist
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every stored key until fn returns an error
+	List(ctx context.Context, fn func(key string) error) error
+}
+
+func validateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	return nil
+}
+
+// FromConfig opens the filesystem or S3 backend selected by cfg.Backend, the Mongo backend needs
+// a connection and is created with NewMongoStore instead
+func FromConfig(cfg config.Content) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendFilesystem:
+		log.Println("Paste content is stored in " + cfg.Dir)
+		return NewFileStore(cfg.Dir)
+	case BackendS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("content.s3_endpoint and content.s3_bucket must be set for the s3 content backend")
+		}
+		return NewS3Store(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region, cfg.S3AccessKeyID, cfg.S3SecretAccessKey), nil
+	case BackendMongo:
+		return nil, fmt.Errorf("the mongo content backend needs a connection, use NewMongoStore")
+	default:
+		return nil, fmt.Errorf("unknown content backend: %s", cfg.Backend)
+	}
+}
+
+// Migrate copies every blob of from into to, blobs already in to are overwritten so an interrupted
+// migration can be run again. With deleteSource the copied blobs are removed from from afterwards.
+func Migrate(ctx context.Context, from, to BlobStore, deleteSource bool) (int, error) {
+	var copied []string
+	err := from.List(ctx, func(key string) error {
+		body, err := from.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			// deleted while migrating
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", key, err)
+		}
+		if err := to.Put(ctx, key, body); err != nil {
+			return fmt.Errorf("cannot write %s: %w", key, err)
+		}
+		copied = append(copied, key)
+		return nil
+	})
+	if err != nil || !deleteSource {
+		return len(copied), err
+	}
+
+	// deleting while listing could skip keys, so it's done once everything is copied
+	for _, key := range copied {
+		if err := from.Delete(ctx, key); err != nil {
+			return len(copied), fmt.Errorf("cannot delete %s: %w", key, err)
+		}
+	}
+	return len(copied), nil
+}
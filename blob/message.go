@@ -0,0 +1,105 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"pastebin/db"
+	"pastebin/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MessageDB keeps paste messages in a BlobStore under their hex id, it implements db.MessageStore
+// so the API can use the filesystem and S3 backends like Mongo
+type MessageDB struct {
+	store BlobStore
+}
+
+var _ db.MessageStore = (*MessageDB)(nil)
+
+func NewMessageDB(store BlobStore) *MessageDB {
+	return &MessageDB{store: store}
+}
+
+func (m *MessageDB) CreateMessage(ctx context.Context, messageBody string) (string, error) {
+	id := primitive.NewObjectID()
+	if err := m.store.Put(ctx, id.Hex(), []byte(messageBody)); err != nil {
+		return primitive.NilObjectID.Hex(), err
+	}
+	return id.Hex(), nil
+}
+
+func (m *MessageDB) PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error {
+	return m.store.Put(ctx, id.Hex(), []byte(messageBody))
+}
+
+// ReadMessage returns mongo.ErrNoDocuments for missing messages, like MongoDB does
+func (m *MessageDB) ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
+	body, err := m.store.Get(ctx, id.Hex())
+	if errors.Is(err, ErrNotFound) {
+		return nil, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.Message{ID: id, MessageBody: string(body)}, nil
+}
+
+// ReadMessages skips messages that don't exist, like MongoDB does
+func (m *MessageDB) ReadMessages(ctx context.Context, ids []primitive.ObjectID) ([]models.Message, error) {
+	messages := make([]models.Message, 0, len(ids))
+	for _, id := range ids {
+		message, err := m.ReadMessage(ctx, id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+	return messages, nil
+}
+
+// ReadMessagePreviews reads whole messages and cuts them after previewLength characters
+func (m *MessageDB) ReadMessagePreviews(ctx context.Context, ids []primitive.ObjectID, previewLength int) ([]models.Message, error) {
+	messages, err := m.ReadMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if runes := []rune(messages[i].MessageBody); len(runes) > previewLength {
+			messages[i].MessageBody = string(runes[:previewLength])
+		}
+	}
+	return messages, nil
+}
+
+func (m *MessageDB) UpdateMessage(ctx context.Context, id primitive.ObjectID, updatedMessage models.Message) error {
+	return m.store.Put(ctx, id.Hex(), []byte(updatedMessage.MessageBody))
+}
+
+func (m *MessageDB) DeleteMessage(ctx context.Context, id primitive.ObjectID) error {
+	return m.store.Delete(ctx, id.Hex())
+}
+
+func (m *MessageDB) DeleteMessages(ctx context.Context, ids []primitive.ObjectID) error {
+	for _, id := range ids {
+		if err := m.DeleteMessage(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMessageIDs calls fn with the id of every message, keys that are not message ids are skipped
+func (m *MessageDB) ReadMessageIDs(ctx context.Context, fn func(id primitive.ObjectID) error) error {
+	return m.store.List(ctx, func(key string) error {
+		id, err := primitive.ObjectIDFromHex(key)
+		if err != nil {
+			return nil
+		}
+		return fn(id)
+	})
+}
@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"pastebin/db"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore keeps blobs as messages of the Mongo collection, keys are the hex ids of the messages
+type MongoStore struct {
+	db *db.MongoDB
+}
+
+func NewMongoStore(mongoDB *db.MongoDB) *MongoStore {
+	return &MongoStore{db: mongoDB}
+}
+
+func (s *MongoStore) Put(ctx context.Context, key string, body []byte) error {
+	id, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return err
+	}
+	return s.db.PutMessage(ctx, id, string(body))
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) ([]byte, error) {
+	id, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return nil, err
+	}
+	message, err := s.db.ReadMessage(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(message.MessageBody), nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, key string) error {
+	id, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return err
+	}
+	return s.db.DeleteMessage(ctx, id)
+}
+
+func (s *MongoStore) List(ctx context.Context, fn func(key string) error) error {
+	return s.db.ReadMessageIDs(ctx, func(id primitive.ObjectID) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(id.Hex())
+	})
+}
@@ -0,0 +1,62 @@
+// Command migrate-content moves the content of pastes from one backend to another.
+//
+//	go run ./cmd/migrate-content -from mongo -to fs [-delete]
+//
+// The backends are configured like the server, with -config, the environment or the flags of
+// package config. -from and -to override content.backend.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"pastebin/blob"
+	"pastebin/config"
+	"pastebin/db"
+)
+
+func main() {
+	from := flag.String("from", blob.BackendMongo, "backend to read the content from: mongo, fs or s3")
+	to := flag.String("to", "", "backend to write the content to: mongo, fs or s3")
+	deleteSource := flag.Bool("delete", false, "delete the content from the source backend once it is copied")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *to == "" || *from == *to {
+		log.Fatal("-to must name a backend different from -from")
+	}
+
+	ctx := context.Background()
+	source, closeSource := openBackend(ctx, cfg, *from)
+	defer closeSource()
+	target, closeTarget := openBackend(ctx, cfg, *to)
+	defer closeTarget()
+
+	count, err := blob.Migrate(ctx, source, target, *deleteSource)
+	log.Printf("Copied %d pastes from %s to %s", count, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openBackend(ctx context.Context, cfg *config.Config, backend string) (blob.BlobStore, func()) {
+	if backend != blob.BackendMongo {
+		content := cfg.Content
+		content.Backend = backend
+		store, err := blob.FromConfig(content)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return store, func() {}
+	}
+
+	client, err := db.ConnectToMongoDb(ctx, cfg.Mongo.URI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store := blob.NewMongoStore(db.NewMongoDB(client, cfg.Mongo.Database, cfg.Mongo.Collection))
+	return store, func() { db.DisconnectFromMongoDb(ctx, client) }
+}
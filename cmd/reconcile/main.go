@@ -0,0 +1,88 @@
+// Command reconcile finds pastes whose metadata in Postgres and content in the message store
+// disagree and repairs them, see package reconcile. The server runs it every hour as well, but
+// only this command deletes pastes whose message is missing.
+//
+//	go run ./cmd/reconcile [-dry-run] [-grace 15m] [-max-missing 0.01]
+//
+// The databases and the content backend are configured like the server, with -config, the
+// environment or the flags of package config.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"pastebin/blob"
+	"pastebin/config"
+	"pastebin/db"
+	"pastebin/reconcile"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report what would be repaired")
+	grace := flag.Duration("grace", reconcile.DefaultGrace, "leave alone what was written more recently than this")
+	maxMissing := flag.Float64("max-missing", reconcile.DefaultMaxMissing, "fail instead of deleting pastes without message when more than this fraction of pastes has none")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	objects, messages, closeStores := openStores(ctx, cfg)
+	defer closeStores()
+
+	report, err := reconcile.New(objects, messages, *grace).DeleteDanglingPastes(*maxMissing).Run(ctx, *dryRun)
+	if report != nil {
+		fmt.Print(report)
+	}
+	if err != nil {
+		closeStores()
+		log.Fatal(err)
+	}
+}
+
+func openStores(ctx context.Context, cfg *config.Config) (*db.PostgresDB, db.MessageStore, func()) {
+	backend := cfg.Content.Backend
+
+	if cfg.Embedded() {
+		client, err := db.ConnectToSQLiteDb(cfg.SQLite.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var messages db.MessageStore = db.NewSQLiteMessageDB(client)
+		if backend != blob.BackendMongo {
+			messages = openBlobMessages(cfg.Content)
+		}
+		return db.NewSQLiteDB(client), messages, func() { db.DisconnectFromSQLiteDb(client) }
+	}
+
+	postgresClient, err := db.ConnectToPostgresDb(cfg.Postgres, cfg.Postgres.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	objects := db.NewPostgresDB(postgresClient)
+	if backend != blob.BackendMongo {
+		return objects, openBlobMessages(cfg.Content), func() { db.DisconnectFromPostgresDb(postgresClient) }
+	}
+
+	mongoClient, err := db.ConnectToMongoDb(ctx, cfg.Mongo.URI)
+	if err != nil {
+		db.DisconnectFromPostgresDb(postgresClient)
+		log.Fatal(err)
+	}
+	messages := db.NewMongoDB(mongoClient, cfg.Mongo.Database, cfg.Mongo.Collection)
+	return objects, messages, func() {
+		db.DisconnectFromMongoDb(ctx, mongoClient)
+		db.DisconnectFromPostgresDb(postgresClient)
+	}
+}
+
+func openBlobMessages(cfg config.Content) db.MessageStore {
+	store, err := blob.FromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return blob.NewMessageDB(store)
+}
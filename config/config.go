@@ -0,0 +1,242 @@
+// Package config loads the settings of the server and the commands. Every setting has a default,
+// which a YAML or TOML file, then environment variables and then command line flags override.
+//
+// The fields of a section are tagged with the key used in the file, the environment variable and
+// whether the value is a secret. Secrets are never printed, and can be read from a file instead:
+// POSTGRES_PASSWORD_FILE, password_file in the file or -postgres.password-file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content backends, the mongo backend keeps content in Mongo or, in embedded mode, in the SQLite file
+const (
+	BackendMongo      = "mongo"
+	BackendFilesystem = "fs"
+	BackendS3         = "s3"
+)
+
+type Config struct {
+	Server   Server   `key:"server"`
+	Postgres Postgres `key:"postgres"`
+	Mongo    Mongo    `key:"mongo"`
+	SQLite   SQLite   `key:"sqlite"`
+	Content  Content  `key:"content"`
+	Mail     Mail     `key:"mail"`
+	Auth     Auth     `key:"auth"`
+	SSO      SSO      `key:"sso"`
+}
+
+type Server struct {
+	Addr string `key:"addr" env:"LISTEN_ADDR"`
+	// frontends allowed to call the API from the browser
+	CORSOrigins []string `key:"cors_origins" env:"CORS_ORIGINS"`
+	// address of the frontend, links in emails point to it
+	AppURL string `key:"app_url" env:"APP_URL"`
+	// bounds the database work of one request
+	DBTimeout time.Duration `key:"db_timeout" env:"DB_TIMEOUT"`
+	// how long requests in flight may take to finish when the server stops
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// Postgres holds the connection settings shared by the main database and the two key databases
+type Postgres struct {
+	Host              string `key:"host" env:"POSTGRES_HOST"`
+	Port              int    `key:"port" env:"POSTGRES_PORT"`
+	User              string `key:"user" env:"POSTGRES_USER"`
+	Password          string `key:"password" env:"POSTGRES_PASSWORD" secret:"true"`
+	Database          string `key:"database" env:"POSTGRES_DB"`
+	PasteKeysDatabase string `key:"pastekeys_database" env:"POSTGRES_PASTEKEYS_DB"`
+	DevKeysDatabase   string `key:"devkeys_database" env:"POSTGRES_DEVKEYS_DB"`
+	SSLMode           string `key:"sslmode" env:"POSTGRES_SSLMODE"`
+}
+
+type Mongo struct {
+	// the URI often carries the credentials, so it is a secret
+	URI        string `key:"uri" env:"MONGODB_URI" secret:"true"`
+	Database   string `key:"database" env:"MONGODB_DATABASE"`
+	Collection string `key:"collection" env:"MONGODB_COLLECTION"`
+}
+
+// SQLite selects the embedded mode when Path is set, Postgres and Mongo are not used then
+type SQLite struct {
+	Path string `key:"path" env:"SQLITE_PATH"`
+}
+
+type Content struct {
+	Backend           string `key:"backend" env:"CONTENT_BACKEND"`
+	Dir               string `key:"dir" env:"CONTENT_DIR"`
+	S3Endpoint        string `key:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Bucket          string `key:"s3_bucket" env:"S3_BUCKET"`
+	S3Region          string `key:"s3_region" env:"S3_REGION"`
+	S3AccessKeyID     string `key:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `key:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+}
+
+// Mail sends through SMTP when SMTPHost is set, otherwise emails are written to OutboxDir
+type Mail struct {
+	SMTPHost     string `key:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `key:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `key:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `key:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	From         string `key:"from" env:"MAIL_FROM"`
+	OutboxDir    string `key:"outbox_dir" env:"MAIL_OUTBOX_DIR"`
+}
+
+// Auth points to the keys signing access tokens and share links, they are read from files
+type Auth struct {
+	// kid:algorithm:path entries
+	JWTSigningKeys      []string `key:"jwt_signing_keys" env:"JWT_SIGNING_KEYS"`
+	JWTActiveKey        string   `key:"jwt_active_key" env:"JWT_ACTIVE_KEY"`
+	ShareLinkSecretFile string   `key:"share_link_secret_file" env:"SHARE_LINK_SECRET_FILE"`
+}
+
+// SSO is the OpenID Connect provider users can log in with, there is none when Provider is empty.
+// The redirect url is a page of the frontend that posts code and state to /api/sso/{provider}/callback.
+type SSO struct {
+	// name of the provider in the urls
+	Provider     string `key:"provider" env:"SSO_PROVIDER"`
+	Issuer       string `key:"issuer" env:"SSO_ISSUER"`
+	ClientID     string `key:"client_id" env:"SSO_CLIENT_ID"`
+	ClientSecret string `key:"client_secret" env:"SSO_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string `key:"redirect_url" env:"SSO_REDIRECT_URL"`
+	// requested besides openid
+	Scopes []string `key:"scopes" env:"SSO_SCOPES"`
+}
+
+// Default returns the settings of the docker-compose setup, without the secrets
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:            ":8080",
+			CORSOrigins:     []string{"http://localhost:3000"},
+			AppURL:          "http://localhost:3000",
+			DBTimeout:       10 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Postgres: Postgres{
+			Host:              "db",
+			Port:              5432,
+			User:              "postgres",
+			Database:          "mydb2",
+			PasteKeysDatabase: "pastekeys",
+			DevKeysDatabase:   "devkeys",
+			SSLMode:           "disable",
+		},
+		Mongo: Mongo{
+			Database:   "pastes",
+			Collection: "messages",
+		},
+		Content: Content{
+			Backend:  BackendMongo,
+			Dir:      "content",
+			S3Region: "us-east-1",
+		},
+		Mail: Mail{
+			SMTPPort:  587,
+			OutboxDir: "outbox",
+		},
+		SSO: SSO{
+			Scopes: []string{"email", "profile"},
+		},
+	}
+}
+
+// DSN returns the connection string of one of the Postgres databases
+func (p Postgres) DSN(dbName string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSN(p.Host), p.Port, quoteDSN(p.User), quoteDSN(p.Password), quoteDSN(dbName), quoteDSN(p.SSLMode))
+}
+
+// quoteDSN quotes a value of a key=value connection string, so spaces and quotes in passwords work
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// Embedded reports if everything is kept in the SQLite file
+func (c *Config) Embedded() bool {
+	return c.SQLite.Path != ""
+}
+
+// Validate checks the settings together and returns an error naming every setting that is wrong
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	_, port, err := net.SplitHostPort(c.Server.Addr)
+	check(err == nil && validPort(port), "server.addr", "%q is not a host:port address", c.Server.Addr)
+	for _, origin := range c.Server.CORSOrigins {
+		check(isHTTPURL(origin), "server.cors_origins", "%q is not an http(s) origin", origin)
+	}
+	check(isHTTPURL(c.Server.AppURL), "server.app_url", "%q is not an http(s) url", c.Server.AppURL)
+	check(c.Server.DBTimeout > 0, "server.db_timeout", "must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+
+	if !c.Embedded() {
+		check(c.Postgres.Host != "", "postgres.host", "must be set")
+		check(c.Postgres.Port > 0 && c.Postgres.Port < 65536, "postgres.port", "%d is not a port", c.Postgres.Port)
+		check(c.Postgres.User != "", "postgres.user", "must be set")
+		check(c.Postgres.Database != "", "postgres.database", "must be set")
+		check(c.Postgres.PasteKeysDatabase != "", "postgres.pastekeys_database", "must be set")
+		check(c.Postgres.DevKeysDatabase != "", "postgres.devkeys_database", "must be set")
+		if c.Content.Backend == BackendMongo {
+			check(c.Mongo.URI != "", "mongo.uri", "must be set for the mongo content backend")
+			check(c.Mongo.Database != "" && c.Mongo.Collection != "", "mongo", "database and collection must be set")
+		}
+	}
+
+	switch c.Content.Backend {
+	case BackendMongo:
+	case BackendFilesystem:
+		check(c.Content.Dir != "", "content.dir", "must be set for the fs content backend")
+	case BackendS3:
+		check(c.Content.S3Endpoint != "", "content.s3_endpoint", "must be set for the s3 content backend")
+		check(c.Content.S3Bucket != "", "content.s3_bucket", "must be set for the s3 content backend")
+		check(c.Content.S3Region != "", "content.s3_region", "must be set for the s3 content backend")
+	default:
+		check(false, "content.backend", "%q is not one of mongo, fs or s3", c.Content.Backend)
+	}
+
+	if c.Mail.SMTPHost != "" {
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort < 65536, "mail.smtp_port", "%d is not a port", c.Mail.SMTPPort)
+		check(c.Mail.From != "", "mail.from", "must be set when mail.smtp_host is set")
+	} else {
+		check(c.Mail.OutboxDir != "", "mail.outbox_dir", "must be set when mail.smtp_host is not set")
+	}
+
+	for _, entry := range c.Auth.JWTSigningKeys {
+		check(strings.Count(entry, ":") >= 2, "auth.jwt_signing_keys", "%q is not a kid:algorithm:path entry", entry)
+	}
+	check(len(c.Auth.JWTSigningKeys) == 0 || c.Auth.JWTActiveKey != "", "auth.jwt_active_key", "must be set when auth.jwt_signing_keys is set")
+
+	if c.SSO.Provider != "" {
+		check(!strings.Contains(c.SSO.Provider, "/"), "sso.provider", "%q must not contain /", c.SSO.Provider)
+		check(isHTTPURL(c.SSO.Issuer), "sso.issuer", "%q is not an http(s) url", c.SSO.Issuer)
+		check(c.SSO.ClientID != "", "sso.client_id", "must be set when sso.provider is set")
+		check(isHTTPURL(c.SSO.RedirectURL), "sso.redirect_url", "%q is not an http(s) url", c.SSO.RedirectURL)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
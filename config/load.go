@@ -0,0 +1,308 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets that are set when the configuration is printed
+const redacted = "[redacted]"
+
+// setting is one field of a section, with its tags read
+type setting struct {
+	key    string // section.key, as in the file
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the fields of every section in declaration order, their values point into c
+func (c *Config) settings() []setting {
+	var settings []setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionKey := sections.Type().Field(i).Tag.Get("key")
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			settings = append(settings, setting{
+				key:    sectionKey + "." + field.Tag.Get("key"),
+				env:    field.Tag.Get("env"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// set parses the text form of a value, lists are comma separated
+func (s setting) set(raw string) error {
+	switch v := s.value.Addr().Interface().(type) {
+	case *string:
+		*v = raw
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		*v = n
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 10s or 1m", raw)
+		}
+		*v = d
+	case *[]string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*v = items
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+// setFromFile sets a value decoded from YAML or TOML
+func (s setting) setFromFile(value any) error {
+	switch v := value.(type) {
+	case string:
+		return s.set(v)
+	case int, int64, uint64:
+		return s.set(fmt.Sprint(v))
+	case []any:
+		if _, ok := s.value.Interface().([]string); !ok {
+			return fmt.Errorf("expected a single value, got a list")
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("list items must be strings")
+			}
+			items[i] = text
+		}
+		s.value.Set(reflect.ValueOf(items))
+		return nil
+	default:
+		return fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// readSecret reads a secret kept in a file, without the line break editors add at the end
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Load builds the configuration from the defaults, the file in -config or CONFIG_FILE, the
+// environment and the flags, each overriding the ones before, and validates it. The flags are
+// registered on fs, which can hold flags of its own, and parsed from args.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML file with the settings, also CONFIG_FILE")
+	byFlag := make(map[string]setting)
+	for _, s := range settings {
+		if s.secret {
+			// secrets passed as flags would be visible in the process list
+			fs.String(s.flagName()+"-file", "", "file holding "+s.key+", also "+s.env+"_FILE")
+			byFlag[s.flagName()+"-file"] = s
+			continue
+		}
+		fs.String(s.flagName(), format(s.value), s.key+", also "+s.env)
+		byFlag[s.flagName()] = s
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, settings); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(settings); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := byFlag[f.Name]
+		if !ok {
+			return
+		}
+		raw := f.Value.String()
+		if s.secret {
+			var err error
+			if raw, err = readSecret(raw); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %w", f.Name, err))
+				return
+			}
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("flag -%s: %w", f.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile reads a .yaml, .yml or .toml file of sections, a secret can be given as key_file
+// naming the file holding it
+func loadFile(path string, settings []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	var sections map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &sections)
+	case ".toml":
+		err = toml.Unmarshal(data, &sections)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+
+	var errs []error
+	for sectionKey, section := range sections {
+		values, ok := section.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s must be a section", path, sectionKey))
+			continue
+		}
+		for key, value := range values {
+			fullKey := sectionKey + "." + key
+			s, ok := byKey[fullKey]
+			if secretKey, isFile := strings.CutSuffix(fullKey, "_file"); !ok && isFile && byKey[secretKey].secret {
+				s = byKey[secretKey]
+				secretPath, _ := value.(string)
+				if value, err = readSecret(secretPath); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: %w", path, fullKey, err))
+					continue
+				}
+			} else if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, fullKey))
+				continue
+			}
+			if err := s.setFromFile(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", path, fullKey, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadEnv reads the variables that are set and not empty, a secret can be given as NAME_FILE
+// naming the file holding it
+func loadEnv(settings []setting) error {
+	var errs []error
+	for _, s := range settings {
+		raw := os.Getenv(s.env)
+		if s.secret && os.Getenv(s.env+"_FILE") != "" {
+			if raw != "" {
+				errs = append(errs, fmt.Errorf("env: set either %s or %s_FILE", s.env, s.env))
+				continue
+			}
+			var err error
+			if raw, err = readSecret(os.Getenv(s.env + "_FILE")); err != nil {
+				errs = append(errs, fmt.Errorf("env %s_FILE: %w", s.env, err))
+				continue
+			}
+		}
+		if raw == "" {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", s.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// format returns the text form of a value, as set reads it
+func format(value reflect.Value) string {
+	if items, ok := value.Interface().([]string); ok {
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// Print writes the configuration as YAML, which can be used as config file, with the secrets
+// that are set replaced by [redacted]
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	for _, s := range c.settings() {
+		sectionKey, key, _ := strings.Cut(s.key, ".")
+		if section == nil || root.Content[len(root.Content)-2].Value != sectionKey {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: sectionKey}, section)
+		}
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode(s))
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func valueNode(s setting) *yaml.Node {
+	if s.secret && !s.value.IsZero() {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+	}
+	switch v := s.value.Interface().(type) {
+	case []string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range v {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return list
+	case int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: format(s.value)}
+	}
+}
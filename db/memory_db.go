@@ -0,0 +1,580 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pastebin/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryDB keeps users and paste metadata in memory, it implements UserStore and ObjectStore for
+// tests and for running without Postgres. Folders are not kept, pastes filtered by a folder are never found.
+type MemoryDB struct {
+	mu            sync.Mutex
+	users         map[uuid.UUID]models.User
+	revokedTokens map[uuid.UUID]time.Time
+	apiTokens     map[uuid.UUID]models.ApiToken
+	orgs          map[uuid.UUID]models.Organisation
+	// orgMembers maps organisations to the roles of their members
+	orgMembers map[uuid.UUID]map[uuid.UUID]string
+	objects    map[string]models.Object
+	tags       map[string][]string
+	grants     map[string][]models.PasteGrant
+	outbox     map[uuid.UUID]models.OutboxEntry
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:         make(map[uuid.UUID]models.User),
+		revokedTokens: make(map[uuid.UUID]time.Time),
+		apiTokens:     make(map[uuid.UUID]models.ApiToken),
+		orgs:          make(map[uuid.UUID]models.Organisation),
+		orgMembers:    make(map[uuid.UUID]map[uuid.UUID]string),
+		objects:       make(map[string]models.Object),
+		tags:          make(map[string][]string),
+		grants:        make(map[string][]models.PasteGrant),
+		outbox:        make(map[uuid.UUID]models.OutboxEntry),
+	}
+}
+
+// CREATE, names and devkeys are unique like in Postgres
+func (dbObj *MemoryDB) CreateUser(ctx context.Context, user *models.User) (uuid.UUID, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if user.UserID == uuid.Nil {
+		user.UserID = uuid.New()
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	for _, existing := range dbObj.users {
+		if existing.UserID == user.UserID || strings.EqualFold(existing.Name, user.Name) || existing.DevKey == user.DevKey {
+			return uuid.Nil, fmt.Errorf("user %s already exists", user.Name)
+		}
+	}
+
+	dbObj.users[user.UserID] = *user
+	return user.UserID, nil
+}
+
+// READ
+func (dbObj *MemoryDB) ReadUserById(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	return dbObj.findUser(func(user models.User) bool { return user.UserID == userID })
+}
+
+// READ the user with the username, compared case insensitively
+func (dbObj *MemoryDB) ReadUserByUsername(ctx context.Context, username string) (models.User, error) {
+	return dbObj.findUser(func(user models.User) bool { return strings.EqualFold(user.Name, username) })
+}
+
+func (dbObj *MemoryDB) ReadUserByDevKey(ctx context.Context, devKey string) (models.User, error) {
+	return dbObj.findUser(func(user models.User) bool { return user.DevKey == devKey })
+}
+
+func (dbObj *MemoryDB) findUser(match func(models.User) bool) (models.User, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	for _, user := range dbObj.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+// CREATE
+func (dbObj *MemoryDB) RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	dbObj.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+// READ
+func (dbObj *MemoryDB) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	_, revoked := dbObj.revokedTokens[jti]
+	return revoked, nil
+}
+
+// CREATE
+func (dbObj *MemoryDB) CreateApiToken(ctx context.Context, token *models.ApiToken) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if token.TokenID == uuid.Nil {
+		token.TokenID = uuid.New()
+	}
+	token.CreatedAt = time.Now()
+	dbObj.apiTokens[token.TokenID] = *token
+	return nil
+}
+
+// READ token that was not revoked, by the hash of its value
+func (dbObj *MemoryDB) ReadActiveApiToken(ctx context.Context, tokenHash string) (*models.ApiToken, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	for _, token := range dbObj.apiTokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil {
+			return &token, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// UPDATE last use of the token
+func (dbObj *MemoryDB) TouchApiToken(ctx context.Context, tokenID uuid.UUID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	token, ok := dbObj.apiTokens[tokenID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	token.LastUsedAt = &now
+	dbObj.apiTokens[tokenID] = token
+	return nil
+}
+
+// CREATE the organisation with the user as its owner
+func (dbObj *MemoryDB) CreateOrganisation(ctx context.Context, org *models.Organisation, ownerID uuid.UUID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if org.OrgID == uuid.Nil {
+		org.OrgID = uuid.New()
+	}
+	for _, existing := range dbObj.orgs {
+		if strings.EqualFold(existing.Name, org.Name) || existing.DevKey == org.DevKey {
+			return fmt.Errorf("organisation %s already exists", org.Name)
+		}
+	}
+	org.CreatedAt = time.Now()
+	org.Role = models.OrgRoleOwner
+
+	stored := *org
+	stored.Role = ""
+	dbObj.orgs[org.OrgID] = stored
+	dbObj.orgMembers[org.OrgID] = map[uuid.UUID]string{ownerID: models.OrgRoleOwner}
+	return nil
+}
+
+// READ
+func (dbObj *MemoryDB) ReadOrganisation(ctx context.Context, orgID uuid.UUID) (*models.Organisation, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	org, ok := dbObj.orgs[orgID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &org, nil
+}
+
+// READ the organisation owning the devkey
+func (dbObj *MemoryDB) ReadOrganisationByDevKey(ctx context.Context, devKey string) (*models.Organisation, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	for _, org := range dbObj.orgs {
+		if org.DevKey == devKey {
+			return &org, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// READ organisations the user is a member of, with the user's role
+func (dbObj *MemoryDB) ReadOrganisationsByUser(ctx context.Context, userID uuid.UUID) ([]models.Organisation, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	orgs := make([]models.Organisation, 0)
+	for orgID, members := range dbObj.orgMembers {
+		if role, ok := members[userID]; ok {
+			org := dbObj.orgs[orgID]
+			org.Role = role
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return strings.ToLower(orgs[i].Name) < strings.ToLower(orgs[j].Name) })
+	return orgs, nil
+}
+
+// READ role of the user in the organisation
+func (dbObj *MemoryDB) ReadOrgMemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	role, ok := dbObj.orgMembers[orgID][userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return role, nil
+}
+
+// READ role of the user in the organisation owning the devkey
+func (dbObj *MemoryDB) ReadOrgRoleByDevKey(ctx context.Context, devKey string, userID uuid.UUID) (string, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	for orgID, org := range dbObj.orgs {
+		if org.DevKey != devKey {
+			continue
+		}
+		if role, ok := dbObj.orgMembers[orgID][userID]; ok {
+			return role, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+// CREATE, paste keys are unique
+func (dbObj *MemoryDB) CreateObject(ctx context.Context, obj *models.Object) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if _, exists := dbObj.objects[obj.PasteKey]; exists {
+		return fmt.Errorf("paste %s already exists", obj.PasteKey)
+	}
+	if obj.Language == "" {
+		obj.Language = "text"
+	}
+	if obj.Visibility == "" {
+		obj.Visibility = models.VisibilityPublic
+	}
+	// Postgres keeps microseconds, cursors made from the returned times have to match the stored ones
+	now := time.Now().Truncate(time.Microsecond)
+	obj.Views, obj.Stars, obj.CommentsEnabled = 0, 0, true
+	obj.CreatedAt, obj.UpdatedAt = now, now
+
+	dbObj.objects[obj.PasteKey] = *obj
+	return nil
+}
+
+// READ
+func (dbObj *MemoryDB) ReadObjectWithoutDevKey(ctx context.Context, pasteKey string) (*models.Object, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	obj, ok := dbObj.objects[pasteKey]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &obj, nil
+}
+
+// READ one page of objects owned by any of the devKeys, filtered and sorted like in Postgres
+func (dbObj *MemoryDB) ReadObjectsPageOfDevKeys(ctx context.Context, devKeys []string, q models.ObjectQuery) ([]models.Object, bool, error) {
+	if _, ok := objectSortColumns[q.SortBy]; !ok {
+		return nil, false, fmt.Errorf("unknown sort field: %s", q.SortBy)
+	}
+	var after any
+	if q.After != nil {
+		sortValue, err := parseSortValue(q.SortBy, q.After.SortValue)
+		if err != nil {
+			return nil, false, err
+		}
+		after = sortValue
+	}
+
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	owners := make(map[string]bool)
+	for _, devKey := range devKeys {
+		owners[devKey] = true
+	}
+
+	objects := make([]models.Object, 0)
+	for _, obj := range dbObj.objects {
+		switch {
+		case !owners[obj.DevKey]:
+		case q.Language != "" && obj.Language != q.Language:
+		case q.Visibility != "" && obj.Visibility != q.Visibility:
+		case q.Tag != "" && !containsString(dbObj.tags[obj.PasteKey], q.Tag):
+		case q.FolderID != "":
+		case after != nil && !isAfterCursor(&obj, q, after):
+		default:
+			objects = append(objects, obj)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		c := compareObjects(&objects[i], &objects[j], q.SortBy)
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if len(objects) > q.Limit {
+		return objects[:q.Limit], true, nil
+	}
+	return objects, false, nil
+}
+
+// compareObjects orders objects by the sort field and then by paste key, like the ORDER BY in Postgres
+func compareObjects(a, b *models.Object, sortBy string) int {
+	if c := compareSortValues(sortValueOf(a, sortBy), sortValueOf(b, sortBy)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.PasteKey, b.PasteKey)
+}
+
+// isAfterCursor reports if the object comes after the cursor in the requested order
+func isAfterCursor(obj *models.Object, q models.ObjectQuery, after any) bool {
+	c := compareSortValues(sortValueOf(obj, q.SortBy), after)
+	if c == 0 {
+		c = strings.Compare(obj.PasteKey, q.After.PasteKey)
+	}
+	if q.Desc {
+		return c < 0
+	}
+	return c > 0
+}
+
+func sortValueOf(obj *models.Object, sortBy string) any {
+	switch sortBy {
+	case models.SortByUpdated:
+		return obj.UpdatedAt
+	case models.SortByViews:
+		return obj.Views
+	default:
+		return obj.CreatedAt
+	}
+}
+
+// compareSortValues compares two values of the same sort field, as returned by sortValueOf or parseSortValue
+func compareSortValues(a, b any) int {
+	if views, ok := a.(int64); ok {
+		other := b.(int64)
+		switch {
+		case views < other:
+			return -1
+		case views > other:
+			return 1
+		}
+		return 0
+	}
+	return a.(time.Time).Compare(b.(time.Time))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// UPDATE
+func (dbObj *MemoryDB) UpdateObject(ctx context.Context, obj *models.Object) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	stored, ok := dbObj.objects[obj.PasteKey]
+	if !ok || stored.DevKey != obj.DevKey {
+		return nil
+	}
+	stored.MessageID = obj.MessageID
+	stored.UpdatedAt = time.Now().Truncate(time.Microsecond)
+	dbObj.objects[obj.PasteKey] = stored
+	return nil
+}
+
+// UPDATE view counter of a paste
+func (dbObj *MemoryDB) IncrementObjectViews(ctx context.Context, pasteKey string) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if obj, ok := dbObj.objects[pasteKey]; ok {
+		obj.Views++
+		dbObj.objects[pasteKey] = obj
+	}
+	return nil
+}
+
+// DELETE the paste with its tags and grants
+func (dbObj *MemoryDB) DeleteObject(ctx context.Context, pasteKey, devKey string) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if obj, ok := dbObj.objects[pasteKey]; ok && obj.DevKey == devKey {
+		delete(dbObj.objects, pasteKey)
+		delete(dbObj.tags, pasteKey)
+		delete(dbObj.grants, pasteKey)
+	}
+	return nil
+}
+
+// UPDATE replaces all tags of a paste
+func (dbObj *MemoryDB) SetPasteTags(ctx context.Context, pasteKey string, tags []string) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	sorted := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !containsString(sorted, tag) {
+			sorted = append(sorted, tag)
+		}
+	}
+	sort.Strings(sorted)
+	dbObj.tags[pasteKey] = sorted
+	return nil
+}
+
+// READ tags of several pastes at once, keyed by paste key
+func (dbObj *MemoryDB) ReadTagsForPastes(ctx context.Context, pasteKeys []string) (map[string][]string, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	tags := make(map[string][]string)
+	for _, pasteKey := range pasteKeys {
+		if pasteTags := dbObj.tags[pasteKey]; len(pasteTags) > 0 {
+			tags[pasteKey] = append([]string(nil), pasteTags...)
+		}
+	}
+	return tags, nil
+}
+
+// RecordTrendingView does nothing, the memory store has no trending list
+func (dbObj *MemoryDB) RecordTrendingView(ctx context.Context, pasteKey string, viewedAt time.Time) error {
+	return nil
+}
+
+// CREATE or UPDATE the grant of the grantee on the paste
+func (dbObj *MemoryDB) SetPasteGrant(ctx context.Context, grant *models.PasteGrant) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	grants := dbObj.grants[grant.PasteKey]
+	for i := range grants {
+		if grants[i].GranteeType == grant.GranteeType && grants[i].GranteeID == grant.GranteeID {
+			grants[i].Permission = grant.Permission
+			grant.CreatedAt = grants[i].CreatedAt
+			return nil
+		}
+	}
+	grant.CreatedAt = time.Now()
+	dbObj.grants[grant.PasteKey] = append(grants, *grant)
+	return nil
+}
+
+// READ the strongest permission the user has on the paste, granted directly or to one of its organisations
+func (dbObj *MemoryDB) ReadGrantPermission(ctx context.Context, pasteKey string, userID uuid.UUID) (string, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	permission := ""
+	for _, grant := range dbObj.grants[pasteKey] {
+		applies := grant.GranteeType == models.GranteeUser && grant.GranteeID == userID
+		if grant.GranteeType == models.GranteeOrg {
+			_, applies = dbObj.orgMembers[grant.GranteeID][userID]
+		}
+		if applies && permission != models.PermissionEdit {
+			permission = grant.Permission
+		}
+	}
+	if permission == "" {
+		return "", sql.ErrNoRows
+	}
+	return permission, nil
+}
+
+// READ every object, in the order of paste keys like Postgres
+func (dbObj *MemoryDB) ReadAllObjects(ctx context.Context, fn func(obj models.Object) error) error {
+	dbObj.mu.Lock()
+	objects := make([]models.Object, 0, len(dbObj.objects))
+	for _, obj := range dbObj.objects {
+		objects = append(objects, obj)
+	}
+	dbObj.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].PasteKey < objects[j].PasteKey })
+	for _, obj := range objects {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CREATE a pending entry
+func (dbObj *MemoryDB) CreateOutboxEntry(ctx context.Context, entry *models.OutboxEntry) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	entry.OutboxID = uuid.New()
+	entry.State = models.OutboxPending
+	entry.CreatedAt = time.Now()
+	dbObj.outbox[entry.OutboxID] = *entry
+	return nil
+}
+
+// READ pending entries, oldest first
+func (dbObj *MemoryDB) ReadPendingOutboxEntries(ctx context.Context) ([]models.OutboxEntry, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	var entries []models.OutboxEntry
+	for _, entry := range dbObj.outbox {
+		if entry.State == models.OutboxPending {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// UPDATE marks a pending entry committed
+func (dbObj *MemoryDB) CommitOutboxEntry(ctx context.Context, outboxID uuid.UUID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	entry, ok := dbObj.outbox[outboxID]
+	if !ok || entry.State != models.OutboxPending {
+		return sql.ErrNoRows
+	}
+	entry.State = models.OutboxCommitted
+	dbObj.outbox[outboxID] = entry
+	return nil
+}
+
+// DELETE
+func (dbObj *MemoryDB) DeleteOutboxEntry(ctx context.Context, outboxID uuid.UUID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	delete(dbObj.outbox, outboxID)
+	return nil
+}
+
+// DELETE committed entries created before the given time
+func (dbObj *MemoryDB) DeleteCommittedOutboxEntries(ctx context.Context, before time.Time) (int64, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	var deleted int64
+	for id, entry := range dbObj.outbox {
+		if entry.State == models.OutboxCommitted && entry.CreatedAt.Before(before) {
+			delete(dbObj.outbox, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryMessageDB keeps paste contents in memory, it implements MessageStore for tests and for
+// running without Mongo
+type MemoryMessageDB struct {
+	mu       sync.Mutex
+	messages map[primitive.ObjectID]string
+}
+
+func NewMemoryMessageDB() *MemoryMessageDB {
+	return &MemoryMessageDB{messages: make(map[primitive.ObjectID]string)}
+}
+
+func (dbObj *MemoryMessageDB) CreateMessage(ctx context.Context, messageBody string) (string, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	id := primitive.NewObjectID()
+	dbObj.messages[id] = messageBody
+	return id.Hex(), nil
+}
+
+// PutMessage creates or replaces the message with the id
+func (dbObj *MemoryMessageDB) PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	dbObj.messages[id] = messageBody
+	return nil
+}
+
+// ReadMessages returns the messages that exist, in no particular order like Mongo does
+func (dbObj *MemoryMessageDB) ReadMessages(ctx context.Context, ids []primitive.ObjectID) ([]models.Message, error) {
+	return dbObj.readMessages(ids, -1), nil
+}
+
+func (dbObj *MemoryMessageDB) ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	body, ok := dbObj.messages[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &models.Message{ID: id, MessageBody: body}, nil
+}
+
+func (dbObj *MemoryMessageDB) UpdateMessage(ctx context.Context, id primitive.ObjectID, updatedMessage models.Message) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	if _, ok := dbObj.messages[id]; ok {
+		dbObj.messages[id] = updatedMessage.MessageBody
+	}
+	return nil
+}
+
+func (dbObj *MemoryMessageDB) DeleteMessage(ctx context.Context, id primitive.ObjectID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	delete(dbObj.messages, id)
+	return nil
+}
+
+func (dbObj *MemoryMessageDB) DeleteMessages(ctx context.Context, ids []primitive.ObjectID) error {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	for _, id := range ids {
+		delete(dbObj.messages, id)
+	}
+	return nil
+}
+
+// ReadMessagePreviews reads only the first previewLength characters of every message body
+func (dbObj *MemoryMessageDB) ReadMessagePreviews(ctx context.Context, ids []primitive.ObjectID, previewLength int) ([]models.Message, error) {
+	return dbObj.readMessages(ids, previewLength), nil
+}
+
+// readMessages cuts every body after previewLength characters, negative lengths keep the whole body
+func (dbObj *MemoryMessageDB) readMessages(ids []primitive.ObjectID, previewLength int) []models.Message {
+	dbObj.mu.Lock()
+	defer dbObj.mu.Unlock()
+
+	messages := make([]models.Message, 0, len(ids))
+	for _, id := range ids {
+		body, ok := dbObj.messages[id]
+		if !ok {
+			continue
+		}
+		if runes := []rune(body); previewLength >= 0 && len(runes) > previewLength {
+			body = string(runes[:previewLength])
+		}
+		messages = append(messages, models.Message{ID: id, MessageBody: body})
+	}
+	return messages
+}
+
+// ReadMessageIDs calls fn with the id of every message until fn returns an error
+func (dbObj *MemoryMessageDB) ReadMessageIDs(ctx context.Context, fn func(id primitive.ObjectID) error) error {
+	dbObj.mu.Lock()
+	ids := make([]primitive.ObjectID, 0, len(dbObj.messages))
+	for id := range dbObj.messages {
+		ids = append(ids, id)
+	}
+	dbObj.mu.Unlock()
+
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryDBUsers(t *testing.T) {
+	testUserStore(t, NewMemoryDB())
+}
+
+func TestMemoryDBObjectsPage(t *testing.T) {
+	testObjectsPage(t, NewMemoryDB())
+}
+
+func TestMemoryMessageDB(t *testing.T) {
+	testMessageStore(t, NewMemoryMessageDB())
+}
+
+// testUserStore, testObjectsPage and testMessageStore are run against every implementation of the stores
+
+func testUserStore(t *testing.T, store UserStore) {
+	ctx := context.Background()
+
+	user := models.User{Name: "Alice", DevKey: "alice_dev_key"}
+	userID, err := store.CreateUser(ctx, &user)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleUser, user.Role)
+
+	_, err = store.CreateUser(ctx, &models.User{Name: "alice", DevKey: "other_dev_key"})
+	assert.Error(t, err)
+
+	found, err := store.ReadUserByUsername(ctx, "ALICE")
+	assert.NoError(t, err)
+	assert.Equal(t, userID, found.UserID)
+
+	_, err = store.ReadUserByDevKey(ctx, "missing")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testObjectsPage(t *testing.T, store ObjectStore) {
+	ctx := context.Background()
+
+	for _, pasteKey := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, store.CreateObject(ctx, &models.Object{PasteKey: pasteKey, DevKey: "owner", MessageID: "msg"}))
+	}
+	assert.NoError(t, store.CreateObject(ctx, &models.Object{PasteKey: "e", DevKey: "other", MessageID: "msg"}))
+	assert.NoError(t, store.SetPasteTags(ctx, "c", []string{"go"}))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.IncrementObjectViews(ctx, "b"))
+	}
+
+	q := models.ObjectQuery{SortBy: models.SortByViews, Desc: true, Limit: 2}
+	page, hasMore, err := store.ReadObjectsPageOfDevKeys(ctx, []string{"owner"}, q)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, "b", page[0].PasteKey)
+	// ties are ordered by paste key
+	assert.Equal(t, "d", page[1].PasteKey)
+
+	q.After = &models.ObjectCursor{SortValue: SortValue(&page[1], q.SortBy), PasteKey: page[1].PasteKey}
+	page, hasMore, err = store.ReadObjectsPageOfDevKeys(ctx, []string{"owner"}, q)
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, []string{"c", "a"}, []string{page[0].PasteKey, page[1].PasteKey})
+
+	page, _, err = store.ReadObjectsPageOfDevKeys(ctx, []string{"owner", "other"}, models.ObjectQuery{SortBy: models.SortByCreated, Tag: "go", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "c", page[0].PasteKey)
+}
+
+func testMessageStore(t *testing.T, store MessageStore) {
+	ctx := context.Background()
+	hex, err := store.CreateMessage(ctx, "hello world")
+	assert.NoError(t, err)
+	id, err := primitive.ObjectIDFromHex(hex)
+	assert.NoError(t, err)
+
+	previews, err := store.ReadMessagePreviews(ctx, []primitive.ObjectID{id, primitive.NewObjectID()}, 5)
+	assert.NoError(t, err)
+	assert.Len(t, previews, 1)
+	assert.Equal(t, "hello", previews[0].MessageBody)
+
+	assert.NoError(t, store.UpdateMessage(ctx, id, models.Message{MessageBody: "changed"}))
+	message, err := store.ReadMessage(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "changed", message.MessageBody)
+
+	// messages can be written under an id chosen before
+	put := primitive.NewObjectID()
+	assert.NoError(t, store.PutMessage(ctx, put, "put"))
+	assert.NoError(t, store.PutMessage(ctx, put, "put again"))
+	message, err = store.ReadMessage(ctx, put)
+	assert.NoError(t, err)
+	assert.Equal(t, "put again", message.MessageBody)
+
+	var ids []primitive.ObjectID
+	assert.NoError(t, store.ReadMessageIDs(ctx, func(id primitive.ObjectID) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	assert.ElementsMatch(t, []primitive.ObjectID{id, put}, ids)
+
+	assert.NoError(t, store.DeleteMessage(ctx, id))
+	_, err = store.ReadMessage(ctx, id)
+	assert.Error(t, err)
+}
@@ -0,0 +1,8 @@
+-- postgres.down.sql
+
+-- Drop the UserToken table
+DROP TABLE IF EXISTS UserToken;
+
+-- Drop the verification flag, longer emails don't fit back and are cut
+ALTER TABLE Users DROP COLUMN IF EXISTS email_verified;
+ALTER TABLE Users ALTER COLUMN email TYPE varchar(32) USING left(email, 32);
@@ -0,0 +1,19 @@
+-- postgres.up.sql
+
+-- Emails are verified before they are trusted, real addresses don't fit in 32 characters
+ALTER TABLE Users ALTER COLUMN email TYPE varchar(254);
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+
+-- Create the UserToken table, single use tokens sent by email for verification and password reset
+CREATE TABLE IF NOT EXISTS UserToken (
+    token_hash varchar(64) NOT NULL,
+    user_id uuid NOT NULL,
+    purpose varchar(32) NOT NULL,
+    email varchar(254) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    PRIMARY KEY (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS user_token_user_id_idx ON UserToken (user_id, purpose);
@@ -0,0 +1,20 @@
+-- postgres.up.sql
+
+-- Create the UserTotp table, the secret is pending until the user confirms it with a code
+CREATE TABLE IF NOT EXISTS UserTotp (
+    user_id uuid NOT NULL,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    last_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    enabled_at timestamptz,
+    PRIMARY KEY (user_id)
+);
+
+-- Create the RecoveryCode table, one time codes for users who lost their authenticator
+CREATE TABLE IF NOT EXISTS RecoveryCode (
+    user_id uuid NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,5 @@
+-- postgres.down.sql
+
+-- Drop the single sign-on tables
+DROP TABLE IF EXISTS SsoLogin;
+DROP TABLE IF EXISTS UserIdentity;
@@ -0,0 +1,10 @@
+-- postgres.up.sql
+
+-- Usernames and emails are unique ignoring case, users without email (created by single sign-on) are allowed.
+-- Existing duplicates have to be resolved by hand before this migration can run.
+CREATE UNIQUE INDEX IF NOT EXISTS users_name_lower_idx ON Users (lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON Users (lower(email)) WHERE email <> '';
+
+-- Replace the devkey index with a unique one
+CREATE UNIQUE INDEX IF NOT EXISTS users_dev_key_key ON Users (dev_key);
+DROP INDEX IF EXISTS users_dev_key_idx;
@@ -0,0 +1,9 @@
+-- postgres.down.sql
+
+-- Drop the AuditLog table
+DROP TABLE IF EXISTS AuditLog;
+
+-- Drop role and suspension of users
+ALTER TABLE Users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE Users DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE Users DROP COLUMN IF EXISTS role;
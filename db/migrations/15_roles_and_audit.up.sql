@@ -0,0 +1,21 @@
+-- postgres.up.sql
+
+-- Add the role and suspension of users
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS role varchar(16) NOT NULL DEFAULT 'user';
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS suspended_at timestamptz;
+ALTER TABLE Users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- Create the AuditLog table, every action done through the admin API
+CREATE TABLE IF NOT EXISTS AuditLog (
+    audit_id uuid DEFAULT uuid_generate_v4(),
+    actor_id uuid NOT NULL,
+    action varchar(32) NOT NULL,
+    target_type varchar(16) NOT NULL,
+    target_id varchar(64) NOT NULL DEFAULT '',
+    details text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (audit_id)
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON AuditLog (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON AuditLog (target_type, target_id, created_at);
@@ -0,0 +1,40 @@
+-- postgres.up.sql
+
+-- Create the Organisation table, pastes of an organisation are owned by its devkey
+CREATE TABLE IF NOT EXISTS Organisation (
+    org_id uuid DEFAULT uuid_generate_v4(),
+    name varchar(40) NOT NULL,
+    dev_key varchar(32) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (org_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS organisation_name_lower_idx ON Organisation (lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS organisation_dev_key_key ON Organisation (dev_key);
+
+-- Create the OrgMember table
+CREATE TABLE IF NOT EXISTS OrgMember (
+    org_id uuid NOT NULL REFERENCES Organisation (org_id) ON DELETE CASCADE,
+    user_id uuid NOT NULL,
+    role varchar(16) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS org_member_user_id_idx ON OrgMember (user_id);
+
+-- Create the OrgInvitation table, an invitation is for a user or for whoever verified the email
+CREATE TABLE IF NOT EXISTS OrgInvitation (
+    invitation_id uuid DEFAULT uuid_generate_v4(),
+    org_id uuid NOT NULL REFERENCES Organisation (org_id) ON DELETE CASCADE,
+    user_id uuid,
+    email varchar(254) NOT NULL DEFAULT '',
+    role varchar(16) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    invited_by uuid NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (invitation_id)
+);
+
+CREATE INDEX IF NOT EXISTS org_invitation_user_id_idx ON OrgInvitation (user_id);
+CREATE INDEX IF NOT EXISTS org_invitation_email_idx ON OrgInvitation (lower(email)) WHERE email <> '';
@@ -0,0 +1,5 @@
+-- postgres.down.sql
+
+-- Drop the paste sharing tables
+DROP TABLE IF EXISTS ShareLink;
+DROP TABLE IF EXISTS PasteGrant;
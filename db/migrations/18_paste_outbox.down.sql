@@ -0,0 +1,4 @@
+-- postgres.down.sql
+
+-- Drop the PasteOutbox table
+DROP TABLE IF EXISTS PasteOutbox;
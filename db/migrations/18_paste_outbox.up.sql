@@ -0,0 +1,15 @@
+-- postgres.up.sql
+
+-- Create the PasteOutbox table, pastes being created or deleted are recorded here before Postgres and the
+-- message store are written, so the reconciler can finish or undo what a crash interrupted
+CREATE TABLE IF NOT EXISTS PasteOutbox (
+    outbox_id uuid DEFAULT uuid_generate_v4(),
+    operation varchar(8) NOT NULL CHECK (operation IN ('create', 'delete')),
+    paste_key varchar(20) NOT NULL,
+    message_id varchar(24) NOT NULL,
+    state varchar(10) NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'committed')),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (outbox_id)
+);
+
+CREATE INDEX IF NOT EXISTS paste_outbox_state_idx ON PasteOutbox (state, created_at);
@@ -0,0 +1,4 @@
+-- postgres.down.sql
+
+-- Hashes don't fit in 32 characters, the affected users have to reset their password
+ALTER TABLE Users ALTER COLUMN password TYPE varchar(32) USING left(password, 32);
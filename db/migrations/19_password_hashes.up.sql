@@ -0,0 +1,5 @@
+-- postgres.up.sql
+
+-- Passwords are stored as bcrypt hashes of 60 characters, plain text passwords of older rows are
+-- replaced by their hash on the next login
+ALTER TABLE Users ALTER COLUMN password TYPE varchar(60);
@@ -0,0 +1,13 @@
+-- postgres.down.sql
+
+-- Drop the pagination indexes
+DROP INDEX IF EXISTS object_dev_key_created_idx;
+DROP INDEX IF EXISTS object_dev_key_updated_idx;
+DROP INDEX IF EXISTS object_dev_key_views_idx;
+
+-- Drop the metadata columns
+ALTER TABLE Object DROP COLUMN IF EXISTS language;
+ALTER TABLE Object DROP COLUMN IF EXISTS visibility;
+ALTER TABLE Object DROP COLUMN IF EXISTS views;
+ALTER TABLE Object DROP COLUMN IF EXISTS created_at;
+ALTER TABLE Object DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,13 @@
+-- postgres.up.sql
+
+-- Add metadata columns used for sorting and filtering of pastes
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS language varchar(32) NOT NULL DEFAULT 'text';
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS visibility varchar(16) NOT NULL DEFAULT 'public';
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS views bigint NOT NULL DEFAULT 0;
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+
+-- Indexes for keyset pagination of one user's pastes
+CREATE INDEX IF NOT EXISTS object_dev_key_created_idx ON Object (dev_key, created_at, paste_key);
+CREATE INDEX IF NOT EXISTS object_dev_key_updated_idx ON Object (dev_key, updated_at, paste_key);
+CREATE INDEX IF NOT EXISTS object_dev_key_views_idx ON Object (dev_key, views, paste_key);
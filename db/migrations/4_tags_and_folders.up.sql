@@ -0,0 +1,33 @@
+-- postgres.up.sql
+
+-- Paste keys are unique across users, tables below reference them
+CREATE UNIQUE INDEX IF NOT EXISTS object_paste_key_idx ON Object (paste_key);
+
+-- Create the PasteTag table, tags are removed together with their paste
+CREATE TABLE IF NOT EXISTS PasteTag (
+    paste_key varchar(20) NOT NULL,
+    tag varchar(32) NOT NULL,
+    PRIMARY KEY (paste_key, tag),
+    CONSTRAINT paste_tag_paste_key_fkey FOREIGN KEY (paste_key) REFERENCES Object (paste_key) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS paste_tag_tag_idx ON PasteTag (tag);
+
+-- Create the Folder table
+CREATE TABLE IF NOT EXISTS Folder (
+    folder_id uuid DEFAULT uuid_generate_v4(),
+    dev_key varchar(32) NOT NULL,
+    name varchar(64) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id),
+    UNIQUE (dev_key, name)
+);
+
+-- Create the FolderPaste table, a paste is in at most one folder
+CREATE TABLE IF NOT EXISTS FolderPaste (
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    folder_id uuid NOT NULL REFERENCES Folder (folder_id) ON DELETE CASCADE,
+    PRIMARY KEY (paste_key)
+);
+
+CREATE INDEX IF NOT EXISTS folder_paste_folder_id_idx ON FolderPaste (folder_id);
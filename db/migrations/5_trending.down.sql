@@ -0,0 +1,7 @@
+-- postgres.down.sql
+
+-- Drop the PasteTrend table
+DROP TABLE IF EXISTS PasteTrend;
+
+-- Drop the public archive index
+DROP INDEX IF EXISTS object_visibility_created_idx;
@@ -0,0 +1,7 @@
+-- postgres.down.sql
+
+-- Drop the Comment table
+DROP TABLE IF EXISTS Comment;
+
+-- Drop the comments switch
+ALTER TABLE Object DROP COLUMN IF EXISTS comments_enabled;
@@ -0,0 +1,14 @@
+-- postgres.up.sql
+
+-- Number of users that starred the paste
+ALTER TABLE Object ADD COLUMN IF NOT EXISTS stars bigint NOT NULL DEFAULT 0;
+
+-- Create the Star table
+CREATE TABLE IF NOT EXISTS Star (
+    user_id uuid NOT NULL,
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    starred_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, paste_key)
+);
+
+CREATE INDEX IF NOT EXISTS star_user_id_starred_at_idx ON Star (user_id, starred_at, paste_key);
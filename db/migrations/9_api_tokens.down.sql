@@ -0,0 +1,7 @@
+-- postgres.down.sql
+
+-- Drop the ApiToken table
+DROP TABLE IF EXISTS ApiToken;
+
+-- Drop the devkey index
+DROP INDEX IF EXISTS users_dev_key_idx;
@@ -0,0 +1,20 @@
+-- postgres.up.sql
+
+-- Users are found by their devkey when it is used as API key
+CREATE INDEX IF NOT EXISTS users_dev_key_idx ON Users (dev_key);
+
+-- Create the ApiToken table, named tokens for scripts limited to some scopes
+CREATE TABLE IF NOT EXISTS ApiToken (
+    token_id uuid DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    name varchar(64) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    scopes text[] NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    PRIMARY KEY (token_id),
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS api_token_user_id_idx ON ApiToken (user_id);
@@ -0,0 +1,7 @@
+-- sqlite.down.sql
+
+-- Drop the UserToken table
+DROP TABLE IF EXISTS UserToken;
+
+-- Drop the verification flag
+ALTER TABLE Users DROP COLUMN email_verified;
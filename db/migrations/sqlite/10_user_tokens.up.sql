@@ -0,0 +1,18 @@
+-- sqlite.up.sql
+
+-- Emails are verified before they are trusted, SQLite doesn't limit the length of email
+ALTER TABLE Users ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+
+-- Create the UserToken table, single use tokens sent by email for verification and password reset
+CREATE TABLE IF NOT EXISTS UserToken (
+    token_hash varchar(64) NOT NULL,
+    user_id text NOT NULL,
+    purpose varchar(32) NOT NULL,
+    email varchar(254) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (now()),
+    expires_at timestamp NOT NULL,
+    used_at timestamp,
+    PRIMARY KEY (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS user_token_user_id_idx ON UserToken (user_id, purpose);
@@ -0,0 +1,5 @@
+-- sqlite.down.sql
+
+-- Drop the two factor tables
+DROP TABLE IF EXISTS RecoveryCode;
+DROP TABLE IF EXISTS UserTotp;
@@ -0,0 +1,24 @@
+-- sqlite.up.sql
+
+-- Create the UserIdentity table, accounts at identity providers linked to users
+CREATE TABLE IF NOT EXISTS UserIdentity (
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id text NOT NULL,
+    email varchar(254) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT (now()),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identity_user_id_idx ON UserIdentity (user_id);
+
+-- Create the SsoLogin table, started logins waiting for the provider to redirect back
+CREATE TABLE IF NOT EXISTS SsoLogin (
+    state_hash varchar(64) NOT NULL,
+    provider varchar(64) NOT NULL,
+    code_verifier varchar(128) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (now()),
+    expires_at timestamp NOT NULL,
+    PRIMARY KEY (state_hash)
+);
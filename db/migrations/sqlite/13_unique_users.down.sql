@@ -0,0 +1,9 @@
+-- sqlite.down.sql
+
+-- Bring back the plain devkey index
+CREATE INDEX IF NOT EXISTS users_dev_key_idx ON Users (dev_key);
+DROP INDEX IF EXISTS users_dev_key_key;
+
+-- Drop the unique indexes
+DROP INDEX IF EXISTS users_email_lower_idx;
+DROP INDEX IF EXISTS users_name_lower_idx;
@@ -0,0 +1,4 @@
+-- sqlite.down.sql
+
+-- Drop the LoginFailure table
+DROP TABLE IF EXISTS LoginFailure;
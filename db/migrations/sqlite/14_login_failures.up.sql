@@ -0,0 +1,11 @@
+-- sqlite.up.sql
+
+-- Create the LoginFailure table, failed logins counted per username and per client address.
+-- Keys are hashes, so usernames typed by mistake (or passwords typed into the username field) aren't stored.
+CREATE TABLE IF NOT EXISTS LoginFailure (
+    throttle_key varchar(80) NOT NULL,
+    failures int NOT NULL DEFAULT 0,
+    last_failure_at timestamp NOT NULL,
+    blocked_until timestamp,
+    PRIMARY KEY (throttle_key)
+);
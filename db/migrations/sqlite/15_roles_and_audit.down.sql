@@ -0,0 +1,8 @@
+-- sqlite.down.sql
+
+-- Drop the AuditLog table
+DROP TABLE IF EXISTS AuditLog;
+
+-- Drop role and suspension of users
+ALTER TABLE Users DROP COLUMN suspended_at;
+ALTER TABLE Users DROP COLUMN role;
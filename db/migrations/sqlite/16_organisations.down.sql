@@ -0,0 +1,6 @@
+-- sqlite.down.sql
+
+-- Drop the organisation tables
+DROP TABLE IF EXISTS OrgInvitation;
+DROP TABLE IF EXISTS OrgMember;
+DROP TABLE IF EXISTS Organisation;
@@ -0,0 +1,28 @@
+-- sqlite.up.sql
+
+-- Create the PasteGrant table, read or edit rights on a paste for a user or an organisation
+CREATE TABLE IF NOT EXISTS PasteGrant (
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    grantee_type varchar(8) NOT NULL CHECK (grantee_type IN ('user', 'org')),
+    grantee_id text NOT NULL,
+    permission varchar(8) NOT NULL CHECK (permission IN ('read', 'edit')),
+    created_at timestamp NOT NULL DEFAULT (now()),
+    PRIMARY KEY (paste_key, grantee_type, grantee_id)
+);
+
+CREATE INDEX IF NOT EXISTS paste_grant_grantee_idx ON PasteGrant (grantee_type, grantee_id);
+
+-- Create the ShareLink table, signed links let anyone read a paste until they expire
+CREATE TABLE IF NOT EXISTS ShareLink (
+    link_id text DEFAULT (uuid_generate_v4()),
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    created_by text NOT NULL,
+    expires_at timestamp NOT NULL,
+    max_uses int,
+    uses int NOT NULL DEFAULT 0,
+    revoked_at timestamp,
+    created_at timestamp NOT NULL DEFAULT (now()),
+    PRIMARY KEY (link_id)
+);
+
+CREATE INDEX IF NOT EXISTS share_link_paste_key_idx ON ShareLink (paste_key);
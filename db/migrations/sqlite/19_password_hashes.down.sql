@@ -0,0 +1,4 @@
+-- sqlite.down.sql
+
+-- Nothing to undo, SQLite doesn't limit the length of password
+SELECT 1;
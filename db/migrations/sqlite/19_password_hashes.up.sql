@@ -0,0 +1,5 @@
+-- sqlite.up.sql
+
+-- Passwords are stored as bcrypt hashes, SQLite doesn't limit the length of password so only
+-- the version is recorded
+SELECT 1;
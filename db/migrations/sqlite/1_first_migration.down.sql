@@ -0,0 +1,10 @@
+-- sqlite.down.sql
+
+-- Drop the Message table
+DROP TABLE IF EXISTS Message;
+
+-- Drop the Object table
+DROP TABLE IF EXISTS Object;
+
+-- Drop the Users table
+DROP TABLE IF EXISTS Users;
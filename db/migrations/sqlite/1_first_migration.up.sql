@@ -0,0 +1,29 @@
+-- sqlite.up.sql
+
+-- uuid_generate_v4() and now() are registered by the driver, see db/sqlite_db.go
+
+-- Create the Users table
+CREATE TABLE IF NOT EXISTS Users (
+    user_id text DEFAULT (uuid_generate_v4()),
+    name varchar(20) NOT NULL,
+    password varchar(32) NOT NULL,
+    pasteNum int NOT NULL,
+    dev_key varchar(32) NOT NULL,
+    email varchar(32) NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+-- Create the Object table
+CREATE TABLE IF NOT EXISTS Object (
+    dev_key varchar(32) NOT NULL,
+    paste_key varchar(20) NOT NULL,
+    message_id varchar(32),
+    PRIMARY KEY (dev_key, paste_key)
+);
+
+-- Create the Message table, the content of pastes that Mongo keeps for Postgres
+CREATE TABLE IF NOT EXISTS Message (
+    message_id varchar(24) NOT NULL,
+    body text NOT NULL,
+    PRIMARY KEY (message_id)
+);
@@ -0,0 +1,7 @@
+-- sqlite.down.sql
+
+-- Drop the Keys table
+DROP TABLE IF EXISTS Keys;
+
+-- Drop the Migration table
+DROP TABLE IF EXISTS Migration;
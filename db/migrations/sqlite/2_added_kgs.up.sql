@@ -0,0 +1,17 @@
+-- sqlite.up.sql
+
+-- Create the Keys table, paste keys and devkeys share it in one file
+CREATE TABLE IF NOT EXISTS Keys (
+    id text DEFAULT (uuid_generate_v4()),
+    key varchar(32) NOT NULL,
+    used boolean DEFAULT false,
+    PRIMARY KEY (id)
+);
+
+
+-- Create the Migration table
+CREATE TABLE IF NOT EXISTS Migration (
+    id text DEFAULT (uuid_generate_v4()),
+    migration varchar(32) NOT NULL,
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,13 @@
+-- sqlite.down.sql
+
+-- Drop the pagination indexes
+DROP INDEX IF EXISTS object_dev_key_created_idx;
+DROP INDEX IF EXISTS object_dev_key_updated_idx;
+DROP INDEX IF EXISTS object_dev_key_views_idx;
+
+-- Drop the metadata columns
+ALTER TABLE Object DROP COLUMN language;
+ALTER TABLE Object DROP COLUMN visibility;
+ALTER TABLE Object DROP COLUMN views;
+ALTER TABLE Object DROP COLUMN created_at;
+ALTER TABLE Object DROP COLUMN updated_at;
@@ -0,0 +1,23 @@
+-- sqlite.up.sql
+
+-- Add metadata columns used for sorting and filtering of pastes. Columns with a default
+-- that isn't constant can't be added, so the table is copied into a new one.
+CREATE TABLE Object_new (
+    dev_key varchar(32) NOT NULL,
+    paste_key varchar(20) NOT NULL,
+    message_id varchar(32),
+    language varchar(32) NOT NULL DEFAULT 'text',
+    visibility varchar(16) NOT NULL DEFAULT 'public',
+    views bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT (now()),
+    updated_at timestamp NOT NULL DEFAULT (now()),
+    PRIMARY KEY (dev_key, paste_key)
+);
+INSERT INTO Object_new (dev_key, paste_key, message_id) SELECT dev_key, paste_key, message_id FROM Object;
+DROP TABLE Object;
+ALTER TABLE Object_new RENAME TO Object;
+
+-- Indexes for keyset pagination of one user's pastes
+CREATE INDEX IF NOT EXISTS object_dev_key_created_idx ON Object (dev_key, created_at, paste_key);
+CREATE INDEX IF NOT EXISTS object_dev_key_updated_idx ON Object (dev_key, updated_at, paste_key);
+CREATE INDEX IF NOT EXISTS object_dev_key_views_idx ON Object (dev_key, views, paste_key);
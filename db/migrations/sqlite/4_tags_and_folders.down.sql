@@ -0,0 +1,13 @@
+-- sqlite.down.sql
+
+-- Drop the FolderPaste table
+DROP TABLE IF EXISTS FolderPaste;
+
+-- Drop the Folder table
+DROP TABLE IF EXISTS Folder;
+
+-- Drop the PasteTag table
+DROP TABLE IF EXISTS PasteTag;
+
+-- Drop the unique paste key index
+DROP INDEX IF EXISTS object_paste_key_idx;
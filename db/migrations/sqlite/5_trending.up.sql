@@ -0,0 +1,14 @@
+-- sqlite.up.sql
+
+-- Index for the public archive
+CREATE INDEX IF NOT EXISTS object_visibility_created_idx ON Object (visibility, created_at, paste_key);
+
+-- Create the PasteTrend table, log_score is the natural logarithm of the sum of
+-- exp(rate * seconds since the trending epoch) over all views of the paste
+CREATE TABLE IF NOT EXISTS PasteTrend (
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    log_score real NOT NULL,
+    PRIMARY KEY (paste_key)
+);
+
+CREATE INDEX IF NOT EXISTS paste_trend_log_score_idx ON PasteTrend (log_score DESC);
@@ -0,0 +1,7 @@
+-- sqlite.down.sql
+
+-- Drop the Comment table
+DROP TABLE IF EXISTS Comment;
+
+-- Drop the comments switch
+ALTER TABLE Object DROP COLUMN comments_enabled;
@@ -0,0 +1,23 @@
+-- sqlite.up.sql
+
+-- Paste owners can turn comments off
+ALTER TABLE Object ADD COLUMN comments_enabled boolean NOT NULL DEFAULT true;
+
+-- Create the Comment table, comments without line range are about the whole paste
+CREATE TABLE IF NOT EXISTS Comment (
+    comment_id text DEFAULT (uuid_generate_v4()),
+    paste_key varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+    parent_id text REFERENCES Comment (comment_id) ON DELETE CASCADE,
+    author_id text NOT NULL,
+    body text NOT NULL,
+    line_start int,
+    line_end int,
+    hidden boolean NOT NULL DEFAULT false,
+    deleted boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL DEFAULT (now()),
+    updated_at timestamp NOT NULL DEFAULT (now()),
+    PRIMARY KEY (comment_id),
+    CHECK (line_start IS NULL AND line_end IS NULL OR 1 <= line_start AND line_start <= line_end)
+);
+
+CREATE INDEX IF NOT EXISTS comment_paste_key_idx ON Comment (paste_key, created_at);
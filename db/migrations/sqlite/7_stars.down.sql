@@ -0,0 +1,7 @@
+-- sqlite.down.sql
+
+-- Drop the Star table
+DROP TABLE IF EXISTS Star;
+
+-- Drop the star counter
+ALTER TABLE Object DROP COLUMN stars;
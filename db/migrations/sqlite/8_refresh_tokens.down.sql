@@ -0,0 +1,7 @@
+-- sqlite.down.sql
+
+-- Drop the RevokedToken table
+DROP TABLE IF EXISTS RevokedToken;
+
+-- Drop the RefreshToken table
+DROP TABLE IF EXISTS RefreshToken;
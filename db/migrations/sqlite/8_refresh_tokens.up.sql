@@ -0,0 +1,26 @@
+-- sqlite.up.sql
+
+-- Create the RefreshToken table, tokens issued by rotating one login share its family
+CREATE TABLE IF NOT EXISTS RefreshToken (
+    token_id text DEFAULT (uuid_generate_v4()),
+    family_id text NOT NULL,
+    user_id text NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    device varchar(256) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT (now()),
+    expires_at timestamp NOT NULL,
+    used_at timestamp,
+    revoked_at timestamp,
+    PRIMARY KEY (token_id),
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_token_family_id_idx ON RefreshToken (family_id);
+CREATE INDEX IF NOT EXISTS refresh_token_user_id_idx ON RefreshToken (user_id);
+
+-- Create the RevokedToken table, access tokens are kept until they would expire anyway
+CREATE TABLE IF NOT EXISTS RevokedToken (
+    jti text NOT NULL,
+    expires_at timestamp NOT NULL,
+    PRIMARY KEY (jti)
+);
@@ -1,18 +1,18 @@
 package db
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"pastebin/models"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (dbObj *MongoDB) CreateMessage(messageBody string) (string, error) {
-	result, err := dbObj.db.InsertOne(dbObj.ctx, models.Message{MessageBody: messageBody})
+func (dbObj *MongoDB) CreateMessage(ctx context.Context, messageBody string) (string, error) {
+	result, err := dbObj.db.InsertOne(ctx, models.Message{MessageBody: messageBody})
 	if err != nil {
-		log.Fatal(err)
 		return primitive.NilObjectID.Hex(), err
 	}
 
@@ -24,42 +24,101 @@ func (dbObj *MongoDB) CreateMessage(messageBody string) (string, error) {
 	return insertedID.Hex(), nil
 }
 
-func (dbObj *MongoDB) ReadMessages(ids []primitive.ObjectID) ([]models.Message, error) {
+func (dbObj *MongoDB) ReadMessages(ctx context.Context, ids []primitive.ObjectID) ([]models.Message, error) {
 	filter := bson.M{"_id": bson.M{"$in": ids}}
 
-	cursor, err := dbObj.db.Find(dbObj.ctx, filter)
+	cursor, err := dbObj.db.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(dbObj.ctx)
+	defer cursor.Close(ctx)
 
 	var messages []models.Message
-	if err := cursor.All(dbObj.ctx, &messages); err != nil {
+	if err := cursor.All(ctx, &messages); err != nil {
 		return nil, err
 	}
 
 	return messages, nil
 }
 
-func (dbObj *MongoDB) ReadMessage(id primitive.ObjectID) (*models.Message, error) {
+func (dbObj *MongoDB) ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
 	var message models.Message
-	err := dbObj.db.FindOne(dbObj.ctx, bson.M{"_id": id}).Decode(&message)
+	err := dbObj.db.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-func (dbObj *MongoDB) UpdateMessage(id primitive.ObjectID, updatedMessage models.Message) error {
+func (dbObj *MongoDB) UpdateMessage(ctx context.Context, id primitive.ObjectID, updatedMessage models.Message) error {
 	_, err := dbObj.db.UpdateOne(
-		dbObj.ctx,
+		ctx,
 		bson.M{"_id": id},
 		bson.D{{Key: "$set", Value: updatedMessage}},
 	)
 	return err
 }
 
-func (dbObj *MongoDB) DeleteMessage(id primitive.ObjectID) error {
-	_, err := dbObj.db.DeleteOne(dbObj.ctx, bson.M{"_id": id})
+func (dbObj *MongoDB) DeleteMessage(ctx context.Context, id primitive.ObjectID) error {
+	_, err := dbObj.db.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
+
+func (dbObj *MongoDB) DeleteMessages(ctx context.Context, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := dbObj.db.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// ReadMessagePreviews reads only the first previewLength characters of every message body
+func (dbObj *MongoDB) ReadMessagePreviews(ctx context.Context, ids []primitive.ObjectID, previewLength int) ([]models.Message, error) {
+	filter := bson.M{"_id": bson.M{"$in": ids}}
+	projection := bson.M{"message_body": bson.M{"$substrCP": bson.A{"$message_body", 0, previewLength}}}
+
+	cursor, err := dbObj.db.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// PutMessage creates or replaces the message with the id, used by pastes whose id is recorded in the outbox
+// before the message is written and to move messages between content backends
+func (dbObj *MongoDB) PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error {
+	_, err := dbObj.db.ReplaceOne(
+		ctx,
+		bson.M{"_id": id},
+		models.Message{ID: id, MessageBody: messageBody},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// ReadMessageIDs calls fn with the id of every message until fn returns an error
+func (dbObj *MongoDB) ReadMessageIDs(ctx context.Context, fn func(id primitive.ObjectID) error) error {
+	cursor, err := dbObj.db.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			return err
+		}
+		if err := fn(message.ID); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -9,16 +9,19 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// testMongoURI is the Mongo of docker-compose the integration tests run against
+const testMongoURI = "mongodb://mongodb:27017"
+
 func TestReadMessages(t *testing.T) {
 	// Set up MongoDB client for testing
-	client, err := ConnectToMongoDb(context.Background())
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer DisconnectFromMongoDb(context.Background(), client)
 
 	// Create a test database and collection
-	testDB := NewMongoDB(client, context.Background(), "test_db", "messages")
+	testDB := NewMongoDB(client, "test_db", "messages")
 
 	// Drop the existing collection to start with a clean slate
 	err = testDB.db.Drop(context.Background())
@@ -46,7 +49,7 @@ func TestReadMessages(t *testing.T) {
 	}
 
 	// Call the ReadMessages function with the test IDs
-	messages, err := testDB.ReadMessages(objectIDs)
+	messages, err := testDB.ReadMessages(context.Background(), objectIDs)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,13 +66,13 @@ func TestReadMessages(t *testing.T) {
 }
 
 func TestCreateMessage(t *testing.T) {
-	client, err := ConnectToMongoDb(context.Background())
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer DisconnectFromMongoDb(context.Background(), client)
 
-	testDB := NewMongoDB(client, context.Background(), "test_db", "messages")
+	testDB := NewMongoDB(client, "test_db", "messages")
 
 	err = testDB.db.Drop(context.Background())
 	if err != nil {
@@ -77,26 +80,26 @@ func TestCreateMessage(t *testing.T) {
 	}
 
 	messageBody := "testing"
-	objectID, err := testDB.CreateMessage(messageBody)
+	objectID, err := testDB.CreateMessage(context.Background(), messageBody)
 
 	assert.NoError(t, err, "Expected no error")
 	assert.NotEmpty(t, objectID, "Expected non-empty ObjectID")
 
 	var storedMessage models.Message
-	err = testDB.db.FindOne(testDB.ctx, primitive.M{"message_body": messageBody}).Decode(&storedMessage)
+	err = testDB.db.FindOne(context.Background(), primitive.M{"message_body": messageBody}).Decode(&storedMessage)
 	assert.NoError(t, err, "Error fetching stored message from the database")
 	assert.Equal(t, messageBody, storedMessage.MessageBody, "Stored message body does not match")
 	assert.Equal(t, objectID, storedMessage.ID.Hex(), "Stored ObjectID does not match")
 }
 
 func TestReadMessage(t *testing.T) {
-	client, err := ConnectToMongoDb(context.Background())
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer DisconnectFromMongoDb(context.Background(), client)
 
-	testDB := NewMongoDB(client, context.Background(), "test_db", "messages")
+	testDB := NewMongoDB(client, "test_db", "messages")
 
 	err = testDB.db.Drop(context.Background())
 	if err != nil {
@@ -104,7 +107,7 @@ func TestReadMessage(t *testing.T) {
 	}
 
 	messageBody := "testing"
-	insertedID, err := testDB.CreateMessage(messageBody)
+	insertedID, err := testDB.CreateMessage(context.Background(), messageBody)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -114,7 +117,7 @@ func TestReadMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	readMessage, err := testDB.ReadMessage(objectID)
+	readMessage, err := testDB.ReadMessage(context.Background(), objectID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -125,20 +128,20 @@ func TestReadMessage(t *testing.T) {
 }
 
 func TestUpdateMessage(t *testing.T) {
-	client, err := ConnectToMongoDb(context.Background())
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer DisconnectFromMongoDb(context.Background(), client)
 
-	testDB := NewMongoDB(client, context.Background(), "test_db", "messages")
+	testDB := NewMongoDB(client, "test_db", "messages")
 
 	err = testDB.db.Drop(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 	messageBody := "testing"
-	insertedID, err := testDB.CreateMessage(messageBody)
+	insertedID, err := testDB.CreateMessage(context.Background(), messageBody)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -152,12 +155,12 @@ func TestUpdateMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testDB.UpdateMessage(objectID, updatedMessage)
+	err = testDB.UpdateMessage(context.Background(), objectID, updatedMessage)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	readMessage, err := testDB.ReadMessage(objectID)
+	readMessage, err := testDB.ReadMessage(context.Background(), objectID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -168,13 +171,13 @@ func TestUpdateMessage(t *testing.T) {
 }
 
 func TestDeleteMessage(t *testing.T) {
-	client, err := ConnectToMongoDb(context.Background())
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer DisconnectFromMongoDb(context.Background(), client)
 
-	testDB := NewMongoDB(client, context.Background(), "test_db", "messages")
+	testDB := NewMongoDB(client, "test_db", "messages")
 
 	err = testDB.db.Drop(context.Background())
 	if err != nil {
@@ -182,7 +185,7 @@ func TestDeleteMessage(t *testing.T) {
 	}
 
 	messageBody := "testing"
-	insertedID, err := testDB.CreateMessage(messageBody)
+	insertedID, err := testDB.CreateMessage(context.Background(), messageBody)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,13 +195,106 @@ func TestDeleteMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testDB.DeleteMessage(objectID)
+	err = testDB.DeleteMessage(context.Background(), objectID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	deletedMessage, err := testDB.ReadMessage(objectID)
+	deletedMessage, err := testDB.ReadMessage(context.Background(), objectID)
 
 	assert.Error(t, err, "Expected an error as the message should be deleted")
 	assert.Nil(t, deletedMessage, "Expected a nil message as it should be deleted")
 }
+
+func TestDeleteMessages(t *testing.T) {
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromMongoDb(context.Background(), client)
+
+	testDB := NewMongoDB(client, "test_db", "messages")
+
+	err = testDB.db.Drop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []primitive.ObjectID
+	for _, body := range []string{"first", "second", "kept"} {
+		insertedID, err := testDB.CreateMessage(context.Background(), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objectID, err := primitive.ObjectIDFromHex(insertedID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, objectID)
+	}
+
+	err = testDB.DeleteMessages(context.Background(), ids[:2])
+	assert.NoError(t, err, "Expected no error")
+
+	messages, err := testDB.ReadMessages(context.Background(), ids)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, messages, 1, "Expected only the kept message to remain")
+}
+
+func TestReadMessagePreviews(t *testing.T) {
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromMongoDb(context.Background(), client)
+
+	testDB := NewMongoDB(client, "test_db", "messages")
+
+	err = testDB.db.Drop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertedID, err := testDB.CreateMessage(context.Background(), "a long message body")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(insertedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previews, err := testDB.ReadMessagePreviews(context.Background(), []primitive.ObjectID{objectID}, 6)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, previews, 1, "Expected one preview")
+	assert.Equal(t, "a long", previews[0].MessageBody, "Expected a shortened message body")
+}
+
+func TestPutMessageAndReadMessageIDs(t *testing.T) {
+	client, err := ConnectToMongoDb(context.Background(), testMongoURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromMongoDb(context.Background(), client)
+
+	testDB := NewMongoDB(client, "test_db", "messages")
+	if err := testDB.db.Drop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	id := primitive.NewObjectID()
+	assert.NoError(t, testDB.PutMessage(context.Background(), id, "first"))
+	assert.NoError(t, testDB.PutMessage(context.Background(), id, "second"))
+
+	message, err := testDB.ReadMessage(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", message.MessageBody)
+
+	var ids []primitive.ObjectID
+	assert.NoError(t, testDB.ReadMessageIDs(context.Background(), func(id primitive.ObjectID) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	assert.Equal(t, []primitive.ObjectID{id}, ids)
+}
@@ -3,7 +3,8 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"pastebin/config"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -14,6 +15,8 @@ import (
 
 type PostgresDB struct {
 	db *sql.DB
+	// sqlite is set by NewSQLiteDB
+	sqlite bool
 }
 
 func NewPostgresDB(db *sql.DB) (dbObj *PostgresDB) {
@@ -22,42 +25,67 @@ func NewPostgresDB(db *sql.DB) (dbObj *PostgresDB) {
 	return
 }
 
-func ConnectToPostgresDb(dbName, user, password string) (*sql.DB, error) {
-	connStr := fmt.Sprintf("user=%s password=%s host=db port=5432 dbname=%s sslmode=disable", user, password, dbName)
-
-	dbo, err := sql.Open("postgres", connStr)
+// ConnectToPostgresDb connects to one of the databases on the configured server and migrates it
+func ConnectToPostgresDb(cfg config.Postgres, dbName string) (*sql.DB, error) {
+	dbo, err := sql.Open("postgres", cfg.DSN(dbName))
 	if err != nil {
 		return nil, err
 	}
 
 	err = dbo.Ping()
 	if err != nil {
+		dbo.Close()
 		return nil, err
 	}
 
 	fmt.Println("Successfully connected to Postgres!->", dbName)
 
+	if err := migratePostgres(dbo, dbName); err != nil {
+		dbo.Close()
+		return nil, err
+	}
+	fmt.Println("Success migration!")
+
+	return dbo, nil
+}
+
+func migratePostgres(dbo *sql.DB, dbName string) error {
 	driver, err := postgres.WithInstance(dbo, &postgres.Config{
 		DatabaseName: dbName,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	m, err := migrate.NewWithDatabaseInstance(
 		"file://db/migrations",
 		"postgres", driver)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	if err := m.Up(); err != nil {
-		log.Println(err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
 	}
-	fmt.Println("Success migration!")
-
-	return dbo, nil
+	return nil
 }
 
-func DisconnectFromPostgresDb(client *sql.DB) {
+func DisconnectFromPostgresDb(client *sql.DB) error {
 	fmt.Print("Disconnected from Postgres!\n")
-	client.Close()
+	return client.Close()
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// expectAffected turns an update or delete that matched nothing into sql.ErrNoRows
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
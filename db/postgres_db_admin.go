@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// READ users for the admin API, sorted by name
+func (dbObj *PostgresDB) SearchUsers(ctx context.Context, q models.UserQuery) ([]models.User, error) {
+	var conditions []string
+	var args []any
+	addArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Search != "" {
+		pattern := addArg("%" + escapeLike(q.Search) + "%")
+		conditions = append(conditions, "(lower(name) LIKE lower("+pattern+") ESCAPE '\\' OR lower(email) LIKE lower("+pattern+") ESCAPE '\\')")
+	}
+	if q.Role != "" {
+		conditions = append(conditions, "role = "+addArg(q.Role))
+	}
+	if q.Suspended != nil {
+		if *q.Suspended {
+			conditions = append(conditions, "suspended_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "suspended_at IS NULL")
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM Users
+		` + where + `
+		ORDER BY lower(name)
+		LIMIT ` + addArg(q.Limit) + ` OFFSET ` + addArg(q.Offset)
+
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UPDATE
+func (dbObj *PostgresDB) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE Users SET role = $1 WHERE user_id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE suspends the user at the given time, nil lifts the suspension
+func (dbObj *PostgresDB) SetUserSuspended(ctx context.Context, userID uuid.UUID, suspendedAt *time.Time) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE Users SET suspended_at = $1 WHERE user_id = $2", suspendedAt, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	if entry.AuditID == uuid.Nil {
+		entry.AuditID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO AuditLog (audit_id, actor_id, action, target_type, target_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, entry.AuditID, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, entry.Details).
+		Scan(&entry.CreatedAt)
+}
+
+// READ audit entries, newest first
+func (dbObj *PostgresDB) ReadAuditEntries(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	conditions := []string{"TRUE"}
+	var args []any
+	addArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.ActorID != uuid.Nil {
+		conditions = append(conditions, "a.actor_id = "+addArg(q.ActorID))
+	}
+	if q.TargetType != "" {
+		conditions = append(conditions, "a.target_type = "+addArg(q.TargetType))
+	}
+	if q.TargetID != "" {
+		conditions = append(conditions, "a.target_id = "+addArg(q.TargetID))
+	}
+	if q.Before != nil {
+		conditions = append(conditions, "a.created_at < "+addArg(*q.Before))
+	}
+
+	query := `
+		SELECT a.audit_id, a.actor_id, COALESCE(u.name, ''), a.action, a.target_type, a.target_id, a.details, a.created_at
+		FROM AuditLog a
+		LEFT JOIN Users u ON u.user_id = a.actor_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY a.created_at DESC, a.audit_id
+		LIMIT ` + addArg(q.Limit)
+
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(&entry.AuditID, &entry.ActorID, &entry.ActorName, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareAuditTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the AuditLog table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS AuditLog;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the AuditLog table with your specified schema
+	createScript := `
+		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+		CREATE TABLE AuditLog (
+			audit_id    UUID DEFAULT uuid_generate_v4(),
+			actor_id    UUID NOT NULL,
+			action      VARCHAR(32) NOT NULL,
+			target_type VARCHAR(16) NOT NULL,
+			target_id   VARCHAR(64) NOT NULL DEFAULT '',
+			details     TEXT NOT NULL DEFAULT '',
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (audit_id)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("AuditLog table created successfully!")
+}
+
+func TestSearchUsers(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+
+	users := []models.User{
+		{Name: "alice", Password: "pw", DevKey: "devkey1", Email: "alice@example.com"},
+		{Name: "bob", Password: "pw", DevKey: "devkey2", Email: "bob@corp.com", Role: models.RoleModerator},
+		{Name: "carol_x", Password: "pw", DevKey: "devkey3", Email: "carol@corp.com"},
+	}
+	for i := range users {
+		if _, err := testDB.CreateUser(context.Background(), &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	if err := testDB.SetUserSuspended(context.Background(), users[2].UserID, &now); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := testDB.SearchUsers(context.Background(), models.UserQuery{Search: "CORP", Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, found, 2)
+	assert.Equal(t, "bob", found[0].Name)
+	assert.Equal(t, "carol_x", found[1].Name)
+
+	// wildcards in the search are matched literally
+	found, err = testDB.SearchUsers(context.Background(), models.UserQuery{Search: "_", Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, found, 1)
+
+	found, err = testDB.SearchUsers(context.Background(), models.UserQuery{Role: models.RoleModerator, Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, found, 1)
+	assert.Equal(t, "bob", found[0].Name)
+
+	suspended := true
+	found, err = testDB.SearchUsers(context.Background(), models.UserQuery{Suspended: &suspended, Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, found, 1)
+	assert.Equal(t, "carol_x", found[0].Name)
+	assert.NotNil(t, found[0].SuspendedAt)
+
+	found, err = testDB.SearchUsers(context.Background(), models.UserQuery{Limit: 2, Offset: 1})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, found, 2)
+	assert.Equal(t, "bob", found[0].Name)
+}
+
+func TestSetUserRole(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+
+	testUser := models.User{Name: "alice", Password: "pw", DevKey: "devkey1"}
+	if _, err := testDB.CreateUser(context.Background(), &testUser); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, models.RoleUser, testUser.Role)
+
+	err = testDB.SetUserRole(context.Background(), testUser.UserID, models.RoleAdmin)
+	assert.NoError(t, err, "Expected no error")
+
+	user, err := testDB.ReadUserById(context.Background(), testUser.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, models.RoleAdmin, user.Role)
+
+	err = testDB.SetUserRole(context.Background(), uuid.New(), models.RoleAdmin)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSetUserSuspended(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+
+	testUser := models.User{Name: "alice", Password: "pw", DevKey: "devkey1"}
+	if _, err := testDB.CreateUser(context.Background(), &testUser); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = testDB.SetUserSuspended(context.Background(), testUser.UserID, &now)
+	assert.NoError(t, err, "Expected no error")
+
+	user, err := testDB.ReadUserById(context.Background(), testUser.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.NotNil(t, user.SuspendedAt)
+
+	err = testDB.SetUserSuspended(context.Background(), testUser.UserID, nil)
+	assert.NoError(t, err, "Expected no error")
+
+	user, err = testDB.ReadUserById(context.Background(), testUser.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Nil(t, user.SuspendedAt)
+}
+
+func TestAuditEntries(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareAuditTable(t, testDB)
+
+	admin := models.User{Name: "admin", Password: "pw", DevKey: "devkey1", Role: models.RoleAdmin}
+	if _, err := testDB.CreateUser(context.Background(), &admin); err != nil {
+		t.Fatal(err)
+	}
+
+	first := models.AuditEntry{ActorID: admin.UserID, Action: models.AuditReadPaste, TargetType: "paste", TargetID: "key1"}
+	err = testDB.CreateAuditEntry(context.Background(), &first)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, first.CreatedAt.IsZero())
+
+	second := models.AuditEntry{ActorID: admin.UserID, Action: models.AuditDeletePaste, TargetType: "paste", TargetID: "key1", Details: "owner devkey2"}
+	if err := testDB.CreateAuditEntry(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+	other := models.AuditEntry{ActorID: uuid.New(), Action: models.AuditReadKgs, TargetType: "kgs"}
+	if err := testDB.CreateAuditEntry(context.Background(), &other); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := testDB.ReadAuditEntries(context.Background(), models.AuditQuery{TargetType: "paste", TargetID: "key1", Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, models.AuditDeletePaste, entries[0].Action)
+	assert.Equal(t, "admin", entries[0].ActorName)
+	assert.Equal(t, "owner devkey2", entries[0].Details)
+
+	// entries of deleted actors are kept
+	entries, err = testDB.ReadAuditEntries(context.Background(), models.AuditQuery{ActorID: other.ActorID, Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "", entries[0].ActorName)
+
+	entries, err = testDB.ReadAuditEntries(context.Background(), models.AuditQuery{Before: &second.CreatedAt, Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, first.AuditID, entries[0].AuditID)
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const apiTokenColumns = "token_id, user_id, name, token_hash, scopes, created_at, last_used_at, revoked_at"
+
+func scanApiToken(row rowScanner, token *models.ApiToken) error {
+	return row.Scan(&token.TokenID, &token.UserID, &token.Name, &token.TokenHash, pq.Array(&token.Scopes),
+		&token.CreatedAt, &token.LastUsedAt, &token.RevokedAt)
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateApiToken(ctx context.Context, token *models.ApiToken) error {
+	if token.TokenID == uuid.Nil {
+		token.TokenID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO ApiToken (token_id, user_id, name, token_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, token.TokenID, token.UserID, token.Name, token.TokenHash, pq.Array(token.Scopes)).
+		Scan(&token.CreatedAt)
+}
+
+// READ token that was not revoked, by the hash of its value
+func (dbObj *PostgresDB) ReadActiveApiToken(ctx context.Context, tokenHash string) (*models.ApiToken, error) {
+	var token models.ApiToken
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM ApiToken
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`
+
+	if err := scanApiToken(dbObj.db.QueryRowContext(ctx, query, tokenHash), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// READ all tokens of a user, newest first
+func (dbObj *PostgresDB) ReadApiTokensByUser(ctx context.Context, userID uuid.UUID) ([]models.ApiToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM ApiToken
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]models.ApiToken, 0)
+	for rows.Next() {
+		var token models.ApiToken
+		if err := scanApiToken(rows, &token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// UPDATE
+func (dbObj *PostgresDB) TouchApiToken(ctx context.Context, tokenID uuid.UUID) error {
+	_, err := dbObj.db.ExecContext(ctx, "UPDATE ApiToken SET last_used_at = now() WHERE token_id = $1", tokenID)
+	return err
+}
+
+// UPDATE revokes a token of the user
+func (dbObj *PostgresDB) RevokeApiToken(ctx context.Context, tokenID, userID uuid.UUID) error {
+	query := `
+		UPDATE ApiToken
+		SET revoked_at = now()
+		WHERE token_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE revokes all tokens of the user, after the password changed
+func (dbObj *PostgresDB) RevokeUserApiTokens(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE ApiToken
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, userID)
+	return err
+}
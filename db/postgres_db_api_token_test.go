@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareApiTokenTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the ApiToken table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS ApiToken;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the ApiToken table with your specified schema
+	createScript := `
+		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+		CREATE TABLE ApiToken (
+			token_id       uuid DEFAULT uuid_generate_v4(),
+			user_id        uuid NOT NULL,
+			name           varchar(64) NOT NULL,
+			token_hash     varchar(64) NOT NULL,
+			scopes         text[] NOT NULL,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			last_used_at   timestamptz,
+			revoked_at     timestamptz,
+			PRIMARY KEY (token_id),
+			UNIQUE (token_hash)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("ApiToken table created successfully!")
+}
+
+func TestCreateAndReadApiToken(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareApiTokenTable(t, testDB)
+
+	userID := uuid.New()
+	token := models.ApiToken{
+		UserID:    userID,
+		Name:      "ci",
+		TokenHash: "hash1",
+		Scopes:    []string{models.ScopePasteRead},
+	}
+	err = testDB.CreateApiToken(context.Background(), &token)
+	assert.NoError(t, err, "Expected no error")
+
+	read, err := testDB.ReadActiveApiToken(context.Background(), "hash1")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, token.TokenID, read.TokenID)
+	assert.Equal(t, []string{models.ScopePasteRead}, read.Scopes)
+	assert.Nil(t, read.LastUsedAt)
+
+	assert.NoError(t, testDB.TouchApiToken(context.Background(), token.TokenID))
+	read, err = testDB.ReadActiveApiToken(context.Background(), "hash1")
+	assert.NoError(t, err, "Expected no error")
+	assert.NotNil(t, read.LastUsedAt, "Expected last use to be recorded")
+
+	tokens, err := testDB.ReadApiTokensByUser(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, tokens, 1)
+}
+
+func TestRevokeApiToken(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareApiTokenTable(t, testDB)
+
+	userID := uuid.New()
+	token := models.ApiToken{UserID: userID, Name: "ci", TokenHash: "hash1", Scopes: []string{models.ScopePasteWrite}}
+	if err := testDB.CreateApiToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+
+	// other users can't revoke the token
+	err = testDB.RevokeApiToken(context.Background(), token.TokenID, uuid.New())
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	err = testDB.RevokeApiToken(context.Background(), token.TokenID, userID)
+	assert.NoError(t, err, "Expected no error")
+
+	_, err = testDB.ReadActiveApiToken(context.Background(), "hash1")
+	assert.Equal(t, sql.ErrNoRows, err, "Expected revoked token to stop working")
+
+	tokens, err := testDB.ReadApiTokensByUser(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	assert.NotNil(t, tokens[0].RevokedAt, "Expected revoked token to stay listed")
+
+	other := models.ApiToken{UserID: userID, Name: "deploy", TokenHash: "hash2", Scopes: []string{models.ScopePasteRead}}
+	if err := testDB.CreateApiToken(context.Background(), &other); err != nil {
+		t.Fatal(err)
+	}
+	err = testDB.RevokeUserApiTokens(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	_, err = testDB.ReadActiveApiToken(context.Background(), "hash2")
+	assert.Equal(t, sql.ErrNoRows, err, "Expected all tokens of the user to stop working")
+}
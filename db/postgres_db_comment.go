@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+
+	"github.com/google/uuid"
+)
+
+const commentColumns = "c.comment_id, c.paste_key, c.parent_id, c.author_id, COALESCE(u.name, ''), c.body, c.line_start, c.line_end, c.hidden, c.deleted, c.created_at, c.updated_at"
+
+func scanComment(row rowScanner, comment *models.Comment) error {
+	return row.Scan(&comment.CommentID, &comment.PasteKey, &comment.ParentID, &comment.AuthorID, &comment.AuthorName, &comment.Body,
+		&comment.LineStart, &comment.LineEnd, &comment.Hidden, &comment.Deleted, &comment.CreatedAt, &comment.UpdatedAt)
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateComment(ctx context.Context, comment *models.Comment) error {
+	if comment.CommentID == uuid.Nil {
+		comment.CommentID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO Comment (comment_id, paste_key, parent_id, author_id, body, line_start, line_end)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, comment.CommentID, comment.PasteKey, comment.ParentID, comment.AuthorID,
+		comment.Body, comment.LineStart, comment.LineEnd).Scan(&comment.CreatedAt, &comment.UpdatedAt)
+}
+
+// READ
+func (dbObj *PostgresDB) ReadComment(ctx context.Context, commentID uuid.UUID) (*models.Comment, error) {
+	var comment models.Comment
+	query := `
+		SELECT ` + commentColumns + `
+		FROM Comment c
+		LEFT JOIN Users u ON u.user_id = c.author_id
+		WHERE c.comment_id = $1
+	`
+
+	if err := scanComment(dbObj.db.QueryRowContext(ctx, query, commentID), &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// READ all comments of a paste, oldest first
+func (dbObj *PostgresDB) ReadCommentsByPaste(ctx context.Context, pasteKey string) ([]models.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM Comment c
+		LEFT JOIN Users u ON u.user_id = c.author_id
+		WHERE c.paste_key = $1
+		ORDER BY c.created_at, c.comment_id
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, pasteKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]models.Comment, 0)
+	for rows.Next() {
+		var comment models.Comment
+		if err := scanComment(rows, &comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// UPDATE body of a comment, only its author can do it
+func (dbObj *PostgresDB) UpdateCommentBody(ctx context.Context, commentID, authorID uuid.UUID, body string) error {
+	query := `
+		UPDATE Comment
+		SET body = $1, updated_at = now()
+		WHERE comment_id = $2 AND author_id = $3 AND NOT deleted
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, body, commentID, authorID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE hides or shows a comment, used by paste owners to moderate
+func (dbObj *PostgresDB) SetCommentHidden(ctx context.Context, commentID uuid.UUID, hidden bool) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE Comment SET hidden = $1 WHERE comment_id = $2", hidden, commentID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DELETE clears the comment but keeps its place in the thread, so replies to it stay readable
+func (dbObj *PostgresDB) DeleteComment(ctx context.Context, commentID uuid.UUID) error {
+	query := `
+		UPDATE Comment
+		SET body = '', deleted = true, updated_at = now()
+		WHERE comment_id = $1
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareCommentTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the Comment table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS Comment;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the Comment table, Object table has to exist
+	createScript := `
+		CREATE TABLE Comment (
+			comment_id     uuid DEFAULT uuid_generate_v4(),
+			paste_key      varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			parent_id      uuid REFERENCES Comment (comment_id) ON DELETE CASCADE,
+			author_id      uuid NOT NULL,
+			body           text NOT NULL,
+			line_start     int,
+			line_end       int,
+			hidden         boolean NOT NULL DEFAULT false,
+			deleted        boolean NOT NULL DEFAULT false,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			updated_at     timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (comment_id)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Comment table created successfully!")
+}
+
+func TestCreateAndReadComments(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareCommentTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key")
+
+	author := models.User{Name: "reviewer", Password: "test_password", DevKey: "reviewer_dev_key", Email: "reviewer@example.com"}
+	author.UserID, err = testDB.CreateUser(context.Background(), &author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lineStart, lineEnd := 2, 4
+	annotation := models.Comment{PasteKey: "test_paste_key", AuthorID: author.UserID, Body: "rename this", LineStart: &lineStart, LineEnd: &lineEnd}
+	err = testDB.CreateComment(context.Background(), &annotation)
+	assert.NoError(t, err, "Expected no error")
+
+	reply := models.Comment{PasteKey: "test_paste_key", ParentID: &annotation.CommentID, AuthorID: author.UserID, Body: "done"}
+	err = testDB.CreateComment(context.Background(), &reply)
+	assert.NoError(t, err, "Expected no error")
+
+	comments, err := testDB.ReadCommentsByPaste(context.Background(), "test_paste_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, comments, 2, "Expected two comments")
+	assert.Equal(t, "reviewer", comments[0].AuthorName, "Expected the author name")
+	assert.Equal(t, 2, *comments[0].LineStart)
+	assert.Equal(t, 4, *comments[0].LineEnd)
+	assert.Equal(t, annotation.CommentID, *comments[1].ParentID, "Expected the reply to point to its parent")
+}
+
+func TestUpdateAndDeleteComment(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareCommentTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key")
+
+	author := models.User{Name: "reviewer", Password: "test_password", DevKey: "reviewer_dev_key", Email: "reviewer@example.com"}
+	author.UserID, err = testDB.CreateUser(context.Background(), &author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := models.Comment{PasteKey: "test_paste_key", AuthorID: author.UserID, Body: "first"}
+	if err := testDB.CreateComment(context.Background(), &comment); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the author can edit
+	err = testDB.UpdateCommentBody(context.Background(), comment.CommentID, comment.CommentID, "stolen")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "Expected no rows for another author")
+
+	err = testDB.UpdateCommentBody(context.Background(), comment.CommentID, author.UserID, "edited")
+	assert.NoError(t, err, "Expected no error")
+
+	err = testDB.SetCommentHidden(context.Background(), comment.CommentID, true)
+	assert.NoError(t, err, "Expected no error")
+
+	resultComment, err := testDB.ReadComment(context.Background(), comment.CommentID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "edited", resultComment.Body)
+	assert.True(t, resultComment.Hidden, "Expected the comment to be hidden")
+
+	err = testDB.DeleteComment(context.Background(), comment.CommentID)
+	assert.NoError(t, err, "Expected no error")
+
+	resultComment, err = testDB.ReadComment(context.Background(), comment.CommentID)
+	assert.NoError(t, err, "Expected the deleted comment to keep its place")
+	assert.True(t, resultComment.Deleted, "Expected the comment to be deleted")
+	assert.Empty(t, resultComment.Body, "Expected the body to be cleared")
+
+	// Deleted comments can't be edited
+	err = testDB.UpdateCommentBody(context.Background(), comment.CommentID, author.UserID, "again")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+
+	"github.com/google/uuid"
+)
+
+// CREATE
+func (dbObj *PostgresDB) CreateFolder(ctx context.Context, folder *models.Folder) error {
+	if folder.FolderID == uuid.Nil {
+		folder.FolderID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO Folder (folder_id, dev_key, name)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, folder.FolderID, folder.DevKey, folder.Name).Scan(&folder.CreatedAt)
+}
+
+// READ all folders of one user with the number of pastes in each
+func (dbObj *PostgresDB) ReadFoldersByDevKey(ctx context.Context, devKey string) ([]models.Folder, error) {
+	query := `
+		SELECT f.folder_id, f.dev_key, f.name, f.created_at, COUNT(fp.paste_key)
+		FROM Folder f
+		LEFT JOIN FolderPaste fp ON fp.folder_id = f.folder_id
+		WHERE f.dev_key = $1
+		GROUP BY f.folder_id
+		ORDER BY f.name
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, devKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := make([]models.Folder, 0)
+	for rows.Next() {
+		var folder models.Folder
+		if err := rows.Scan(&folder.FolderID, &folder.DevKey, &folder.Name, &folder.CreatedAt, &folder.PasteNum); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// READ
+func (dbObj *PostgresDB) ReadFolder(ctx context.Context, folderID uuid.UUID, devKey string) (*models.Folder, error) {
+	var folder models.Folder
+	query := `
+		SELECT folder_id, dev_key, name, created_at
+		FROM Folder
+		WHERE folder_id = $1 AND dev_key = $2
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, folderID, devKey).Scan(&folder.FolderID, &folder.DevKey, &folder.Name, &folder.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// UPDATE
+func (dbObj *PostgresDB) RenameFolder(ctx context.Context, folderID uuid.UUID, devKey, name string) error {
+	query := `
+		UPDATE Folder
+		SET name = $1
+		WHERE folder_id = $2 AND dev_key = $3
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, name, folderID, devKey)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DELETE folder, pastes in it stay but no longer belong to any folder
+func (dbObj *PostgresDB) DeleteFolder(ctx context.Context, folderID uuid.UUID, devKey string) error {
+	query := `
+		DELETE FROM Folder
+		WHERE folder_id = $1 AND dev_key = $2
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, folderID, devKey)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE puts the paste into a folder, replacing its previous folder
+func (dbObj *PostgresDB) MovePasteToFolder(ctx context.Context, pasteKey string, folderID uuid.UUID) error {
+	query := `
+		INSERT INTO FolderPaste (paste_key, folder_id)
+		VALUES ($1, $2)
+		ON CONFLICT (paste_key) DO UPDATE SET folder_id = EXCLUDED.folder_id
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, pasteKey, folderID)
+	return err
+}
+
+// DELETE takes the paste out of its folder
+func (dbObj *PostgresDB) RemovePasteFromFolder(ctx context.Context, pasteKey string) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM FolderPaste WHERE paste_key = $1", pasteKey)
+	return err
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareFolderTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the Folder tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS FolderPaste;
+		DROP TABLE IF EXISTS Folder;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the Folder tables, Object table has to exist
+	createScript := `
+		CREATE TABLE Folder (
+			folder_id      uuid DEFAULT uuid_generate_v4(),
+			dev_key        varchar(32) NOT NULL,
+			name           varchar(64) NOT NULL,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (folder_id),
+			UNIQUE (dev_key, name)
+		);
+		CREATE TABLE FolderPaste (
+			paste_key      varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			folder_id      uuid NOT NULL REFERENCES Folder (folder_id) ON DELETE CASCADE,
+			PRIMARY KEY (paste_key)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Folder tables created successfully!")
+}
+
+func TestCreateAndRenameFolder(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareFolderTables(t, testDB)
+
+	folder := models.Folder{DevKey: "test_dev_key", Name: "snippets"}
+	err = testDB.CreateFolder(context.Background(), &folder)
+	assert.NoError(t, err, "Expected no error")
+
+	// Names are unique per user
+	duplicate := models.Folder{DevKey: "test_dev_key", Name: "snippets"}
+	err = testDB.CreateFolder(context.Background(), &duplicate)
+	assert.Error(t, err, "Expected an error for a duplicate folder name")
+
+	err = testDB.RenameFolder(context.Background(), folder.FolderID, "test_dev_key", "work")
+	assert.NoError(t, err, "Expected no error")
+
+	// Other users can't rename the folder
+	err = testDB.RenameFolder(context.Background(), folder.FolderID, "other_dev_key", "mine")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "Expected no rows for a folder of another user")
+
+	resultFolder, err := testDB.ReadFolder(context.Background(), folder.FolderID, "test_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "work", resultFolder.Name, "Expected the folder to be renamed")
+}
+
+func TestMovePasteToFolder(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareFolderTables(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key1", "test_paste_key2")
+
+	first := models.Folder{DevKey: "test_dev_key", Name: "first"}
+	second := models.Folder{DevKey: "test_dev_key", Name: "second"}
+	if err := testDB.CreateFolder(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.CreateFolder(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, testDB.MovePasteToFolder(context.Background(), "test_paste_key1", first.FolderID))
+	assert.NoError(t, testDB.MovePasteToFolder(context.Background(), "test_paste_key2", first.FolderID))
+	assert.NoError(t, testDB.MovePasteToFolder(context.Background(), "test_paste_key2", second.FolderID))
+
+	folders, err := testDB.ReadFoldersByDevKey(context.Background(), "test_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, folders, 2, "Expected two folders")
+	assert.Equal(t, 1, folders[0].PasteNum, "Expected one paste in the first folder")
+	assert.Equal(t, 1, folders[1].PasteNum, "Expected one paste in the second folder")
+
+	objects, _, err := testDB.ReadObjectsPage(context.Background(), "test_dev_key", models.ObjectQuery{SortBy: models.SortByCreated, FolderID: second.FolderID.String(), Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, objects, 1, "Expected one paste in the second folder")
+	assert.Equal(t, "test_paste_key2", objects[0].PasteKey)
+
+	// Deleting the folder keeps the pastes
+	err = testDB.DeleteFolder(context.Background(), first.FolderID, "test_dev_key")
+	assert.NoError(t, err, "Expected no error")
+
+	_, err = testDB.ReadObject(context.Background(), "test_paste_key1", "test_dev_key")
+	assert.NoError(t, err, "Expected the paste to outlive its folder")
+}
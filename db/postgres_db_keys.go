@@ -14,6 +14,18 @@ func (dbObj *PostgresDB) MarkKeyAsUsed(ctx context.Context, key string) error {
 	return err
 }
 
+// Function to mark a key as unused again, so it can be handed out once more
+func (dbObj *PostgresDB) MarkKeyAsUnused(ctx context.Context, key string) error {
+	query := `
+        UPDATE Keys
+        SET used = false
+        WHERE key = $1
+    `
+
+	_, err := dbObj.db.ExecContext(ctx, query, key)
+	return err
+}
+
 // Function to check if a key is marked as used
 func (dbObj *PostgresDB) IsKeyUsed(ctx context.Context, key string) (bool, error) {
 	query := `
@@ -31,6 +43,22 @@ func (dbObj *PostgresDB) IsKeyUsed(ctx context.Context, key string) (bool, error
 	return isUsed, nil
 }
 
+// Function to count used and unused keys, shows how full the key pool is
+func (dbObj *PostgresDB) CountKeys(ctx context.Context) (int, int, error) {
+	query := `
+        SELECT count(*) FILTER (WHERE used), count(*) FILTER (WHERE NOT used)
+        FROM Keys
+    `
+
+	var used, unused int
+	err := dbObj.db.QueryRowContext(ctx, query).Scan(&used, &unused)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return used, unused, nil
+}
+
 // Function to get the first unused key
 func (dbObj *PostgresDB) GetFirstUnusedKey(ctx context.Context) (string, error) {
 	query := `
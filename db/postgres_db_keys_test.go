@@ -39,7 +39,7 @@ func prepareKeysTable(t *testing.T, testDB *PostgresDB) {
 }
 
 func TestMarkKeyAsUsed(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -65,8 +65,35 @@ func TestMarkKeyAsUsed(t *testing.T) {
 	assert.True(t, isUsed, "Expected the key to be marked as used")
 }
 
+func TestMarkKeyAsUnused(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareKeysTable(t, testDB)
+
+	testKey := "test_key"
+	if err := testDB.InsertKeyIntoKeys(context.Background(), testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.MarkKeyAsUsed(context.Background(), testKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// Release the key again
+	err = testDB.MarkKeyAsUnused(context.Background(), testKey)
+	assert.NoError(t, err, "Expected no error")
+
+	isUsed, err := testDB.IsKeyUsed(context.Background(), testKey)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, isUsed, "Expected the key to be unused again")
+}
+
 func TestIsKeyUsed(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,7 +125,7 @@ func TestIsKeyUsed(t *testing.T) {
 }
 
 func TestGetFirstUnusedKey(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -123,7 +150,7 @@ func TestGetFirstUnusedKey(t *testing.T) {
 }
 
 func TestGetAndMarkFirstUnusedKey(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -153,7 +180,7 @@ func TestGetAndMarkFirstUnusedKey(t *testing.T) {
 }
 
 func TestInsertKeyIntoKeys(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -174,7 +201,7 @@ func TestInsertKeyIntoKeys(t *testing.T) {
 }
 
 func TestFillKeysTable(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -206,3 +233,28 @@ func TestFillKeysTable(t *testing.T) {
 		}
 	}
 }
+
+func TestCountKeys(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareKeysTable(t, testDB)
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		if err := testDB.InsertKeyIntoKeys(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.MarkKeyAsUsed(context.Background(), "key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	used, unused, err := testDB.CountKeys(context.Background())
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, 1, used)
+	assert.Equal(t, 2, unused)
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UPDATE counts a failed login for the key and returns the number of failures, failures older
+// than windowStart are forgotten and counting starts again
+func (dbObj *PostgresDB) RecordLoginFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	query := `
+		INSERT INTO LoginFailure (throttle_key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failures = CASE WHEN LoginFailure.last_failure_at < $3 THEN 1 ELSE LoginFailure.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures
+	`
+
+	var failures int
+	err := dbObj.db.QueryRowContext(ctx, query, key, now, windowStart).Scan(&failures)
+	return failures, err
+}
+
+// UPDATE refuses logins for the key until the given time
+func (dbObj *PostgresDB) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := dbObj.db.ExecContext(ctx, "UPDATE LoginFailure SET blocked_until = $1 WHERE throttle_key = $2", until, key)
+	return err
+}
+
+// READ the latest time until which any of the keys is blocked, zero when none is blocked
+func (dbObj *PostgresDB) ReadLoginBlockedUntil(ctx context.Context, keys []string, now time.Time) (time.Time, error) {
+	anyKey, keysArg := dbObj.anyOf("throttle_key", "$1", keys)
+	query := `
+		SELECT blocked_until
+		FROM LoginFailure
+		WHERE ` + anyKey + ` AND blocked_until > $2
+		ORDER BY blocked_until DESC
+		LIMIT 1
+	`
+
+	var until time.Time
+	err := dbObj.db.QueryRowContext(ctx, query, keysArg, now).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+// DELETE failures of the key, after a successful login or password reset
+func (dbObj *PostgresDB) ClearLoginFailures(ctx context.Context, key string) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM LoginFailure WHERE throttle_key = $1", key)
+	return err
+}
+
+// DELETE counters without recent failures that don't block anymore
+func (dbObj *PostgresDB) DeleteStaleLoginFailures(ctx context.Context, before time.Time) error {
+	query := `
+		DELETE FROM LoginFailure
+		WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < $1)
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, before)
+	return err
+}
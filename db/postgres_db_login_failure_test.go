@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareLoginFailureTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the LoginFailure table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS LoginFailure;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the LoginFailure table with your specified schema
+	createScript := `
+		CREATE TABLE LoginFailure (
+			throttle_key     varchar(80) NOT NULL,
+			failures         int NOT NULL DEFAULT 0,
+			last_failure_at  timestamptz NOT NULL,
+			blocked_until    timestamptz,
+			PRIMARY KEY (throttle_key)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("LoginFailure table created successfully!")
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareLoginFailureTable(t, testDB)
+
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		failures, err := testDB.RecordLoginFailure(context.Background(), "user:a", now, now.Add(-time.Hour))
+		assert.NoError(t, err, "Expected no error")
+		assert.Equal(t, i, failures)
+	}
+
+	// failures before the window are forgotten
+	later := now.Add(2 * time.Hour)
+	failures, err := testDB.RecordLoginFailure(context.Background(), "user:a", later, later.Add(-time.Hour))
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, 1, failures)
+
+	err = testDB.ClearLoginFailures(context.Background(), "user:a")
+	assert.NoError(t, err, "Expected no error")
+	failures, err = testDB.RecordLoginFailure(context.Background(), "user:a", later, later.Add(-time.Hour))
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, 1, failures, "Expected counting to start again after clearing")
+}
+
+func TestReadLoginBlockedUntil(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareLoginFailureTable(t, testDB)
+
+	now := time.Now().Truncate(time.Second)
+	for _, key := range []string{"user:a", "ip:b", "ip:c"} {
+		if _, err := testDB.RecordLoginFailure(context.Background(), key, now, now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	until, err := testDB.ReadLoginBlockedUntil(context.Background(), []string{"user:a", "ip:b"}, now)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, until.IsZero(), "Expected no block before BlockLogin")
+
+	assert.NoError(t, testDB.BlockLogin(context.Background(), "user:a", now.Add(time.Minute)))
+	assert.NoError(t, testDB.BlockLogin(context.Background(), "ip:b", now.Add(time.Hour)))
+	assert.NoError(t, testDB.BlockLogin(context.Background(), "ip:c", now.Add(2*time.Hour)))
+
+	until, err = testDB.ReadLoginBlockedUntil(context.Background(), []string{"user:a", "ip:b"}, now)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, now.Add(time.Hour).Equal(until), "Expected the longest block of the keys")
+
+	// blocks in the past don't count
+	until, err = testDB.ReadLoginBlockedUntil(context.Background(), []string{"user:a"}, now.Add(30*time.Minute))
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, until.IsZero())
+
+	err = testDB.DeleteStaleLoginFailures(context.Background(), now.Add(90*time.Minute))
+	assert.NoError(t, err, "Expected no error")
+	until, err = testDB.ReadLoginBlockedUntil(context.Background(), []string{"ip:c"}, now)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, until.IsZero(), "Expected keys that still block to stay")
+}
@@ -38,7 +38,7 @@ func prepareMigrationTable(t *testing.T, testDB *PostgresDB) {
 }
 
 func TestInsertMigration(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,7 +59,7 @@ func TestInsertMigration(t *testing.T) {
 }
 
 func TestDeleteMigration(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -85,7 +85,7 @@ func TestDeleteMigration(t *testing.T) {
 }
 
 func TestCheckMigration(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
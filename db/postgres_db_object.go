@@ -2,30 +2,197 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"pastebin/models"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const objectColumns = "paste_key, dev_key, message_id, language, visibility, views, created_at, updated_at, comments_enabled, stars"
+
+// columns that ObjectQuery.SortBy maps to
+var objectSortColumns = map[string]string{
+	models.SortByCreated: "created_at",
+	models.SortByUpdated: "updated_at",
+	models.SortByViews:   "views",
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// objectColumnsOf qualifies objectColumns with a table alias, for queries joining Object with other tables
+func objectColumnsOf(alias string) string {
+	return alias + "." + strings.ReplaceAll(objectColumns, ", ", ", "+alias+".")
+}
+
+// objectFields returns scan destinations in the order of objectColumns
+func objectFields(obj *models.Object) []any {
+	return []any{&obj.PasteKey, &obj.DevKey, &obj.MessageID, &obj.Language, &obj.Visibility, &obj.Views, &obj.CreatedAt, &obj.UpdatedAt, &obj.CommentsEnabled, &obj.Stars}
+}
+
+func scanObject(row rowScanner, obj *models.Object) error {
+	return row.Scan(objectFields(obj)...)
+}
+
 // CREATE
 func (dbObj *PostgresDB) CreateObject(ctx context.Context, obj *models.Object) error {
+	if obj.Language == "" {
+		obj.Language = "text"
+	}
+	if obj.Visibility == "" {
+		obj.Visibility = models.VisibilityPublic
+	}
+
 	query := `
-		INSERT INTO Object (paste_key, dev_key, message_id)
-		VALUES ($1, $2, $3)
+		INSERT INTO Object (paste_key, dev_key, message_id, language, visibility)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING views, created_at, updated_at, comments_enabled, stars
 	`
 
-	_, err := dbObj.db.ExecContext(ctx, query, obj.PasteKey, obj.DevKey, obj.MessageID)
-	return err
+	return dbObj.db.QueryRowContext(ctx, query, obj.PasteKey, obj.DevKey, obj.MessageID, obj.Language, obj.Visibility).
+		Scan(&obj.Views, &obj.CreatedAt, &obj.UpdatedAt, &obj.CommentsEnabled, &obj.Stars)
 }
 
 // READ all objects with a certain devKey
 func (dbObj *PostgresDB) ReadObjectsByDevKey(ctx context.Context, devKey string) ([]models.Object, error) {
-	var objects []models.Object
 	query := `
-		SELECT paste_key, dev_key, message_id
+		SELECT ` + objectColumns + `
 		FROM Object
 		WHERE dev_key = $1
 	`
 
-	rows, err := dbObj.db.QueryContext(ctx, query, devKey)
+	return dbObj.queryObjects(ctx, query, devKey)
+}
+
+// READ every object one by one without keeping them in memory, used by the reconciler
+func (dbObj *PostgresDB) ReadAllObjects(ctx context.Context, fn func(obj models.Object) error) error {
+	rows, err := dbObj.db.QueryContext(ctx, "SELECT "+objectColumns+" FROM Object ORDER BY paste_key")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var obj models.Object
+		if err := scanObject(rows, &obj); err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// READ one page of objects with a certain devKey, filtered and sorted as requested.
+// One row more than the limit is read so the caller knows if there is a next page.
+func (dbObj *PostgresDB) ReadObjectsPage(ctx context.Context, devKey string, q models.ObjectQuery) ([]models.Object, bool, error) {
+	return dbObj.readObjectsPage(ctx, "dev_key = $1", []any{devKey}, q)
+}
+
+// READ one page of objects owned by any of the devKeys, used to list a user's pastes together
+// with the pastes of the user's organisations
+func (dbObj *PostgresDB) ReadObjectsPageOfDevKeys(ctx context.Context, devKeys []string, q models.ObjectQuery) ([]models.Object, bool, error) {
+	anyDevKey, devKeysArg := dbObj.anyOf("dev_key", "$1", devKeys)
+	return dbObj.readObjectsPage(ctx, anyDevKey, []any{devKeysArg}, q)
+}
+
+// READ one page of public objects of all users, used for the public archive
+func (dbObj *PostgresDB) ReadPublicObjectsPage(ctx context.Context, q models.ObjectQuery) ([]models.Object, bool, error) {
+	q.Visibility = ""
+	return dbObj.readObjectsPage(ctx, "visibility = '"+models.VisibilityPublic+"'", nil, q)
+}
+
+func (dbObj *PostgresDB) readObjectsPage(ctx context.Context, baseCondition string, args []any, q models.ObjectQuery) ([]models.Object, bool, error) {
+	column, ok := objectSortColumns[q.SortBy]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown sort field: %s", q.SortBy)
+	}
+
+	conditions := []string{baseCondition}
+	addArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Language != "" {
+		conditions = append(conditions, "language = "+addArg(q.Language))
+	}
+	if q.Visibility != "" {
+		conditions = append(conditions, "visibility = "+addArg(q.Visibility))
+	}
+	if q.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM PasteTag t WHERE t.paste_key = Object.paste_key AND t.tag = "+addArg(q.Tag)+")")
+	}
+	if q.FolderID != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM FolderPaste f WHERE f.paste_key = Object.paste_key AND f.folder_id = "+addArg(q.FolderID)+")")
+	}
+
+	direction, comparison := "ASC", ">"
+	if q.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.After != nil {
+		sortValue, err := parseSortValue(q.SortBy, q.After.SortValue)
+		if err != nil {
+			return nil, false, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, paste_key) %s (%s, %s)", column, comparison, addArg(sortValue), addArg(q.After.PasteKey)))
+	}
+
+	query := `
+		SELECT ` + objectColumns + `
+		FROM Object
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + column + ` ` + direction + `, paste_key ` + direction + `
+		LIMIT ` + addArg(q.Limit+1)
+
+	objects, err := dbObj.queryObjects(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(objects) > q.Limit {
+		return objects[:q.Limit], true, nil
+	}
+	return objects, false, nil
+}
+
+// SortValue returns the value of the column the object list is sorted by, in the form stored in a cursor
+func SortValue(obj *models.Object, sortBy string) string {
+	switch sortBy {
+	case models.SortByUpdated:
+		return obj.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortByViews:
+		return strconv.FormatInt(obj.Views, 10)
+	default:
+		return obj.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func parseSortValue(sortBy, value string) (any, error) {
+	if sortBy == models.SortByViews {
+		views, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		return views, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return t, nil
+}
+
+func (dbObj *PostgresDB) queryObjects(ctx context.Context, query string, args ...any) ([]models.Object, error) {
+	var objects []models.Object
+
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +200,7 @@ func (dbObj *PostgresDB) ReadObjectsByDevKey(ctx context.Context, devKey string)
 
 	for rows.Next() {
 		var obj models.Object
-		if err := rows.Scan(&obj.PasteKey, &obj.DevKey, &obj.MessageID); err != nil {
+		if err := scanObject(rows, &obj); err != nil {
 			return nil, err
 		}
 		objects = append(objects, obj)
@@ -50,12 +217,12 @@ func (dbObj *PostgresDB) ReadObjectsByDevKey(ctx context.Context, devKey string)
 func (dbObj *PostgresDB) ReadObject(ctx context.Context, pasteKey, devKey string) (*models.Object, error) {
 	var obj models.Object
 	query := `
-		SELECT paste_key, dev_key, message_id
+		SELECT ` + objectColumns + `
 		FROM Object
 		WHERE paste_key = $1 AND dev_key = $2
 	`
 
-	err := dbObj.db.QueryRowContext(ctx, query, pasteKey, devKey).Scan(&obj.PasteKey, &obj.DevKey, &obj.MessageID)
+	err := scanObject(dbObj.db.QueryRowContext(ctx, query, pasteKey, devKey), &obj)
 	if err != nil {
 		return nil, err
 	}
@@ -66,12 +233,12 @@ func (dbObj *PostgresDB) ReadObject(ctx context.Context, pasteKey, devKey string
 func (dbObj *PostgresDB) ReadObjectWithoutDevKey(ctx context.Context, pasteKey string) (*models.Object, error) {
 	var obj models.Object
 	query := `
-		SELECT paste_key, dev_key, message_id
+		SELECT ` + objectColumns + `
 		FROM Object
 		WHERE paste_key = $1
 	`
 
-	err := dbObj.db.QueryRowContext(ctx, query, pasteKey).Scan(&obj.PasteKey, &obj.DevKey, &obj.MessageID)
+	err := scanObject(dbObj.db.QueryRowContext(ctx, query, pasteKey), &obj)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +249,7 @@ func (dbObj *PostgresDB) ReadObjectWithoutDevKey(ctx context.Context, pasteKey s
 func (dbObj *PostgresDB) UpdateObject(ctx context.Context, obj *models.Object) error {
 	query := `
 		UPDATE Object
-		SET message_id = $1
+		SET message_id = $1, updated_at = now()
 		WHERE paste_key = $2 AND dev_key = $3
 	`
 
@@ -90,6 +257,33 @@ func (dbObj *PostgresDB) UpdateObject(ctx context.Context, obj *models.Object) e
 	return err
 }
 
+// UPDATE view counter of a paste
+func (dbObj *PostgresDB) IncrementObjectViews(ctx context.Context, pasteKey string) error {
+	query := `
+		UPDATE Object
+		SET views = views + 1
+		WHERE paste_key = $1
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, pasteKey)
+	return err
+}
+
+// UPDATE turns comments on a paste on or off
+func (dbObj *PostgresDB) SetCommentsEnabled(ctx context.Context, pasteKey, devKey string, enabled bool) error {
+	query := `
+		UPDATE Object
+		SET comments_enabled = $1
+		WHERE paste_key = $2 AND dev_key = $3
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, enabled, pasteKey, devKey)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
 // DELETE
 func (dbObj *PostgresDB) DeleteObject(ctx context.Context, pasteKey, devKey string) error {
 	query := `
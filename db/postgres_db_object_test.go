@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"pastebin/models"
 	"testing"
@@ -14,7 +15,8 @@ import (
 func prepareObjectTable(t *testing.T, testDB *PostgresDB) {
 	// Drop the Object table if it exists
 	dropScript := `
-		DROP TABLE IF EXISTS Object;
+		DROP TABLE IF EXISTS PasteTag;
+		DROP TABLE IF EXISTS Object CASCADE;
 	`
 
 	_, err := testDB.db.ExecContext(context.Background(), dropScript)
@@ -29,7 +31,20 @@ func prepareObjectTable(t *testing.T, testDB *PostgresDB) {
 			dev_key        varchar(32) NOT NULL,
 			paste_key      varchar(20) NOT NULL,
 			message_id     varchar(32),
-			PRIMARY KEY (dev_key, paste_key)
+			language       varchar(32) NOT NULL DEFAULT 'text',
+			visibility     varchar(16) NOT NULL DEFAULT 'public',
+			views          bigint NOT NULL DEFAULT 0,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			updated_at     timestamptz NOT NULL DEFAULT now(),
+			comments_enabled boolean NOT NULL DEFAULT true,
+			stars          bigint NOT NULL DEFAULT 0,
+			PRIMARY KEY (dev_key, paste_key),
+			UNIQUE (paste_key)
+		);
+		CREATE TABLE PasteTag (
+			paste_key      varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			tag            varchar(32) NOT NULL,
+			PRIMARY KEY (paste_key, tag)
 		);
 	`
 
@@ -42,7 +57,7 @@ func prepareObjectTable(t *testing.T, testDB *PostgresDB) {
 }
 
 func TestCreateObject(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,7 +81,7 @@ func TestCreateObject(t *testing.T) {
 }
 
 func TestReadObjectsByDevKey(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,7 +127,7 @@ func TestReadObjectsByDevKey(t *testing.T) {
 }
 
 func TestReadObject(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -148,7 +163,7 @@ func TestReadObject(t *testing.T) {
 }
 
 func TestReadObjectWithoutDevKey(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -183,7 +198,7 @@ func TestReadObjectWithoutDevKey(t *testing.T) {
 }
 
 func TestUpdateObject(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -222,7 +237,7 @@ func TestUpdateObject(t *testing.T) {
 }
 
 func TestDeleteObject(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -253,3 +268,108 @@ func TestDeleteObject(t *testing.T) {
 	assert.Error(t, err, "Expected an error as the object should be deleted")
 	assert.Nil(t, deletedObject, "Expected a nil object for a deleted object")
 }
+
+func TestReadObjectsPage(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+
+	devKey := "test_dev_key"
+	for i, language := range []string{"go", "text", "go", "go", "python"} {
+		testObject := models.Object{
+			PasteKey:  fmt.Sprintf("test_paste_key%d", i),
+			DevKey:    devKey,
+			MessageID: fmt.Sprintf("test_message_id%d", i),
+			Language:  language,
+		}
+		if err := testDB.CreateObject(context.Background(), &testObject); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.db.ExecContext(context.Background(), "INSERT INTO PasteTag (paste_key, tag) VALUES ('test_paste_key2', 'work')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Page through the go pastes two by two
+	query := models.ObjectQuery{SortBy: models.SortByCreated, Desc: true, Language: "go", Limit: 2}
+	firstPage, hasMore, err := testDB.ReadObjectsPage(context.Background(), devKey, query)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, hasMore, "Expected another page")
+	assert.Len(t, firstPage, 2, "Expected a full first page")
+
+	last := &firstPage[len(firstPage)-1]
+	query.After = &models.ObjectCursor{SortValue: SortValue(last, query.SortBy), PasteKey: last.PasteKey}
+	secondPage, hasMore, err := testDB.ReadObjectsPage(context.Background(), devKey, query)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, hasMore, "Expected no more pages")
+	assert.Len(t, secondPage, 1, "Expected the rest of the go pastes")
+	assert.NotContains(t, firstPage, secondPage[0], "Expected pages not to overlap")
+
+	// Filter by tag
+	tagged, _, err := testDB.ReadObjectsPage(context.Background(), devKey, models.ObjectQuery{SortBy: models.SortByViews, Tag: "work", Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, tagged, 1, "Expected only the tagged paste")
+	assert.Equal(t, "test_paste_key2", tagged[0].PasteKey)
+}
+
+func TestReadObjectsPageOfDevKeys(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+
+	for _, obj := range []models.Object{
+		{PasteKey: "user_paste", DevKey: "user_dev_key", MessageID: "m1"},
+		{PasteKey: "org_paste", DevKey: "org_dev_key", MessageID: "m2"},
+		{PasteKey: "other_paste", DevKey: "other_dev_key", MessageID: "m3"},
+	} {
+		if err := testDB.CreateObject(context.Background(), &obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects, hasMore, err := testDB.ReadObjectsPageOfDevKeys(context.Background(), []string{"user_dev_key", "org_dev_key"},
+		models.ObjectQuery{SortBy: models.SortByCreated, Limit: 10})
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, hasMore, "Expected no more pages")
+	assert.Len(t, objects, 2, "Expected pastes of the user and the organisation")
+	for _, obj := range objects {
+		assert.NotEqual(t, "other_paste", obj.PasteKey)
+	}
+}
+
+func TestIncrementObjectViews(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+
+	testObject := models.Object{
+		PasteKey:  "test_paste_key",
+		DevKey:    "test_dev_key",
+		MessageID: "test_message_id",
+	}
+	if err := testDB.CreateObject(context.Background(), &testObject); err != nil {
+		t.Fatal(err)
+	}
+
+	err = testDB.IncrementObjectViews(context.Background(), testObject.PasteKey)
+	assert.NoError(t, err, "Expected no error")
+
+	resultObject, err := testDB.ReadObject(context.Background(), testObject.PasteKey, testObject.DevKey)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, int64(1), resultObject.Views, "Expected one view")
+}
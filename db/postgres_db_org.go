@@ -0,0 +1,424 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrLastOwner is returned when a change would leave an organisation without owner
+var ErrLastOwner = errors.New("organisation needs an owner")
+
+const invitationColumns = "i.invitation_id, i.org_id, o.name, i.user_id, i.email, i.role, i.invited_by, i.created_at, i.expires_at"
+
+func scanInvitation(row rowScanner, invitation *models.OrgInvitation) error {
+	return row.Scan(&invitation.InvitationID, &invitation.OrgID, &invitation.OrgName, &invitation.UserID, &invitation.Email,
+		&invitation.Role, &invitation.InvitedBy, &invitation.CreatedAt, &invitation.ExpiresAt)
+}
+
+// CREATE organisation with the user as its first owner
+func (dbObj *PostgresDB) CreateOrganisation(ctx context.Context, org *models.Organisation, ownerID uuid.UUID) error {
+	if org.OrgID == uuid.Nil {
+		org.OrgID = uuid.New()
+	}
+
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO Organisation (org_id, name, dev_key)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+	if err := tx.QueryRowContext(ctx, query, org.OrgID, org.Name, org.DevKey).Scan(&org.CreatedAt); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO OrgMember (org_id, user_id, role) VALUES ($1, $2, $3)"
+	if _, err := tx.ExecContext(ctx, query, org.OrgID, ownerID, models.OrgRoleOwner); err != nil {
+		return err
+	}
+	org.Role = models.OrgRoleOwner
+
+	return tx.Commit()
+}
+
+// READ
+func (dbObj *PostgresDB) ReadOrganisation(ctx context.Context, orgID uuid.UUID) (*models.Organisation, error) {
+	var org models.Organisation
+	query := `
+		SELECT org_id, name, dev_key, created_at
+		FROM Organisation
+		WHERE org_id = $1
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, orgID).Scan(&org.OrgID, &org.Name, &org.DevKey, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// READ the organisation owning the devkey
+func (dbObj *PostgresDB) ReadOrganisationByDevKey(ctx context.Context, devKey string) (*models.Organisation, error) {
+	var org models.Organisation
+	query := `
+		SELECT org_id, name, dev_key, created_at
+		FROM Organisation
+		WHERE dev_key = $1
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, devKey).Scan(&org.OrgID, &org.Name, &org.DevKey, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// READ organisations the user is a member of, with the user's role
+func (dbObj *PostgresDB) ReadOrganisationsByUser(ctx context.Context, userID uuid.UUID) ([]models.Organisation, error) {
+	query := `
+		SELECT o.org_id, o.name, o.dev_key, m.role, o.created_at
+		FROM Organisation o
+		JOIN OrgMember m ON m.org_id = o.org_id
+		WHERE m.user_id = $1
+		ORDER BY lower(o.name)
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Organisation, 0)
+	for rows.Next() {
+		var org models.Organisation
+		if err := rows.Scan(&org.OrgID, &org.Name, &org.DevKey, &org.Role, &org.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// DELETE organisation with its members, invitations and the grants it got, it must not own pastes anymore.
+// Returns sql.ErrNoRows when the organisation doesn't exist or still has pastes.
+func (dbObj *PostgresDB) DeleteOrganisation(ctx context.Context, orgID uuid.UUID) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM Organisation o
+		WHERE o.org_id = $1 AND NOT EXISTS (SELECT 1 FROM Object WHERE dev_key = o.dev_key)
+	`
+
+	result, err := tx.ExecContext(ctx, query, orgID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM PasteGrant WHERE grantee_type = 'org' AND grantee_id = $1", orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// READ role of the user in the organisation
+func (dbObj *PostgresDB) ReadOrgMemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
+	var role string
+	query := "SELECT role FROM OrgMember WHERE org_id = $1 AND user_id = $2"
+
+	err := dbObj.db.QueryRowContext(ctx, query, orgID, userID).Scan(&role)
+	return role, err
+}
+
+// READ role of the user in the organisation owning the devkey, sql.ErrNoRows when the devkey
+// is not one of an organisation the user is a member of
+func (dbObj *PostgresDB) ReadOrgRoleByDevKey(ctx context.Context, devKey string, userID uuid.UUID) (string, error) {
+	var role string
+	query := `
+		SELECT m.role
+		FROM Organisation o
+		JOIN OrgMember m ON m.org_id = o.org_id
+		WHERE o.dev_key = $1 AND m.user_id = $2
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, devKey, userID).Scan(&role)
+	return role, err
+}
+
+// READ members of the organisation, owners first
+func (dbObj *PostgresDB) ReadOrgMembers(ctx context.Context, orgID uuid.UUID) ([]models.OrgMember, error) {
+	query := `
+		SELECT m.user_id, u.name, m.role, m.created_at
+		FROM OrgMember m
+		JOIN Users u ON u.user_id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.role = 'owner' DESC, lower(u.name)
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]models.OrgMember, 0)
+	for rows.Next() {
+		var member models.OrgMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// lockOwners locks the owner rows of the organisation until the transaction ends and
+// reports if the user is the only owner. SQLite has no row locks, it lets one transaction
+// write at a time and fails the others if what they read has changed.
+func (dbObj *PostgresDB) lockOwners(ctx context.Context, tx *sql.Tx, orgID, userID uuid.UUID) (bool, error) {
+	lock := " FOR UPDATE"
+	if dbObj.sqlite {
+		lock = ""
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT user_id FROM OrgMember WHERE org_id = $1 AND role = $2"+lock, orgID, models.OrgRoleOwner)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var owners []uuid.UUID
+	for rows.Next() {
+		var owner uuid.UUID
+		if err := rows.Scan(&owner); err != nil {
+			return false, err
+		}
+		owners = append(owners, owner)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	return len(owners) == 1 && owners[0] == userID, nil
+}
+
+// UPDATE role of a member, the last owner can't be demoted
+func (dbObj *PostgresDB) SetOrgMemberRole(ctx context.Context, orgID, userID uuid.UUID, role string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lastOwner, err := dbObj.lockOwners(ctx, tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if lastOwner && role != models.OrgRoleOwner {
+		return ErrLastOwner
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE OrgMember SET role = $1 WHERE org_id = $2 AND user_id = $3", role, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DELETE member, the last owner can't leave
+func (dbObj *PostgresDB) RemoveOrgMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lastOwner, err := dbObj.lockOwners(ctx, tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if lastOwner {
+		return ErrLastOwner
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM OrgMember WHERE org_id = $1 AND user_id = $2", orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// READ number of organisations the user is the only owner of, they would be left without owner
+// if the user went away
+func (dbObj *PostgresDB) CountSoleOwnedOrganisations(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM OrgMember m
+		WHERE m.user_id = $1 AND m.role = $2 AND NOT EXISTS (
+			SELECT 1 FROM OrgMember o WHERE o.org_id = m.org_id AND o.role = $2 AND o.user_id <> $1
+		)
+	`
+
+	var count int
+	err := dbObj.db.QueryRowContext(ctx, query, userID, models.OrgRoleOwner).Scan(&count)
+	return count, err
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateOrgInvitation(ctx context.Context, invitation *models.OrgInvitation) error {
+	if invitation.InvitationID == uuid.Nil {
+		invitation.InvitationID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO OrgInvitation (invitation_id, org_id, user_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, invitation.InvitationID, invitation.OrgID, invitation.UserID, invitation.Email,
+		invitation.Role, invitation.InvitedBy, invitation.ExpiresAt).Scan(&invitation.CreatedAt)
+}
+
+func (dbObj *PostgresDB) queryInvitations(ctx context.Context, query string, args ...any) ([]models.OrgInvitation, error) {
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]models.OrgInvitation, 0)
+	for rows.Next() {
+		var invitation models.OrgInvitation
+		if err := scanInvitation(rows, &invitation); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// READ open invitations of the organisation
+func (dbObj *PostgresDB) ReadOrgInvitations(ctx context.Context, orgID uuid.UUID, now time.Time) ([]models.OrgInvitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM OrgInvitation i
+		JOIN Organisation o ON o.org_id = i.org_id
+		WHERE i.org_id = $1 AND i.expires_at > $2
+		ORDER BY i.created_at DESC
+	`
+
+	return dbObj.queryInvitations(ctx, query, orgID, now)
+}
+
+// READ open invitations for the user, or for its email when the user has verified it.
+// Pass an empty email for users without verified email.
+func (dbObj *PostgresDB) ReadInvitationsForUser(ctx context.Context, userID uuid.UUID, email string, now time.Time) ([]models.OrgInvitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM OrgInvitation i
+		JOIN Organisation o ON o.org_id = i.org_id
+		WHERE (i.user_id = $1 OR ($2 <> '' AND lower(i.email) = lower($2))) AND i.expires_at > $3
+		ORDER BY i.created_at DESC
+	`
+
+	return dbObj.queryInvitations(ctx, query, userID, email, now)
+}
+
+// DELETE invitation and add its user as member. A user who is already a member keeps the role it has.
+// Returns sql.ErrNoRows when the invitation doesn't exist, expired or is for someone else.
+func (dbObj *PostgresDB) AcceptOrgInvitation(ctx context.Context, invitationID, userID uuid.UUID, email string, now time.Time) (uuid.UUID, error) {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM OrgInvitation
+		WHERE invitation_id = $1 AND (user_id = $2 OR ($3 <> '' AND lower(email) = lower($3))) AND expires_at > $4
+		RETURNING org_id, role
+	`
+
+	var orgID uuid.UUID
+	var role string
+	if err := tx.QueryRowContext(ctx, query, invitationID, userID, email, now).Scan(&orgID, &role); err != nil {
+		return uuid.Nil, err
+	}
+
+	query = `
+		INSERT INTO OrgMember (org_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, query, orgID, userID, role); err != nil {
+		return uuid.Nil, err
+	}
+
+	return orgID, tx.Commit()
+}
+
+// DELETE invitation declined by the user it is for
+func (dbObj *PostgresDB) DeclineOrgInvitation(ctx context.Context, invitationID, userID uuid.UUID, email string) error {
+	query := `
+		DELETE FROM OrgInvitation
+		WHERE invitation_id = $1 AND (user_id = $2 OR ($3 <> '' AND lower(email) = lower($3)))
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, invitationID, userID, email)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DELETE invitation revoked by an owner of the organisation
+func (dbObj *PostgresDB) RevokeOrgInvitation(ctx context.Context, orgID, invitationID uuid.UUID) error {
+	result, err := dbObj.db.ExecContext(ctx, "DELETE FROM OrgInvitation WHERE invitation_id = $1 AND org_id = $2", invitationID, orgID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DELETE invitations nobody accepted in time
+func (dbObj *PostgresDB) DeleteExpiredOrgInvitations(ctx context.Context, now time.Time) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM OrgInvitation WHERE expires_at <= $1", now)
+	return err
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareOrgTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the organisation tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS OrgInvitation;
+		DROP TABLE IF EXISTS OrgMember;
+		DROP TABLE IF EXISTS Organisation;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the organisation tables with your specified schema
+	createScript := `
+		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+		CREATE TABLE Organisation (
+			org_id     UUID DEFAULT uuid_generate_v4(),
+			name       VARCHAR(40) NOT NULL,
+			dev_key    VARCHAR(32) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (org_id)
+		);
+		CREATE UNIQUE INDEX organisation_name_lower_idx ON Organisation (lower(name));
+		CREATE UNIQUE INDEX organisation_dev_key_key ON Organisation (dev_key);
+		CREATE TABLE OrgMember (
+			org_id     UUID NOT NULL REFERENCES Organisation (org_id) ON DELETE CASCADE,
+			user_id    UUID NOT NULL,
+			role       VARCHAR(16) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (org_id, user_id)
+		);
+		CREATE TABLE OrgInvitation (
+			invitation_id UUID DEFAULT uuid_generate_v4(),
+			org_id        UUID NOT NULL REFERENCES Organisation (org_id) ON DELETE CASCADE,
+			user_id       UUID,
+			email         VARCHAR(254) NOT NULL DEFAULT '',
+			role          VARCHAR(16) NOT NULL,
+			invited_by    UUID NOT NULL,
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at    TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (invitation_id)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Organisation tables created successfully!")
+}
+
+// createOrgTestUsers creates an owner and a second user for organisation tests
+func createOrgTestUsers(t *testing.T, testDB *PostgresDB) (models.User, models.User) {
+	owner := models.User{Name: "owner", Password: "pw", DevKey: "owner_dev_key", Email: "owner@example.com"}
+	member := models.User{Name: "member", Password: "pw", DevKey: "member_dev_key", Email: "member@example.com"}
+	for _, user := range []*models.User{&owner, &member} {
+		if _, err := testDB.CreateUser(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return owner, member
+}
+
+func TestCreateOrganisation(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareOrgTables(t, testDB)
+	owner, member := createOrgTestUsers(t, testDB)
+
+	org := models.Organisation{Name: "Team", DevKey: "org_dev_key"}
+	err = testDB.CreateOrganisation(context.Background(), &org, owner.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, models.OrgRoleOwner, org.Role)
+
+	read, err := testDB.ReadOrganisation(context.Background(), org.OrgID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "Team", read.Name)
+	assert.Equal(t, "org_dev_key", read.DevKey)
+
+	read, err = testDB.ReadOrganisationByDevKey(context.Background(), "org_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, org.OrgID, read.OrgID)
+
+	orgs, err := testDB.ReadOrganisationsByUser(context.Background(), owner.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, orgs, 1)
+	assert.Equal(t, models.OrgRoleOwner, orgs[0].Role)
+
+	orgs, err = testDB.ReadOrganisationsByUser(context.Background(), member.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, orgs, 0)
+
+	role, err := testDB.ReadOrgRoleByDevKey(context.Background(), "org_dev_key", owner.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, models.OrgRoleOwner, role)
+
+	_, err = testDB.ReadOrgRoleByDevKey(context.Background(), "org_dev_key", member.UserID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// names are unique ignoring case
+	err = testDB.CreateOrganisation(context.Background(), &models.Organisation{Name: "team", DevKey: "other_dev_key"}, member.UserID)
+	assert.Error(t, err)
+}
+
+func TestOrgInvitations(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareOrgTables(t, testDB)
+	owner, member := createOrgTestUsers(t, testDB)
+
+	org := models.Organisation{Name: "Team", DevKey: "org_dev_key"}
+	if err := testDB.CreateOrganisation(context.Background(), &org, owner.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	byName := models.OrgInvitation{OrgID: org.OrgID, UserID: &member.UserID, Role: models.OrgRoleEditor, InvitedBy: owner.UserID, ExpiresAt: now.Add(time.Hour)}
+	byEmail := models.OrgInvitation{OrgID: org.OrgID, Email: "Member@Example.com", Role: models.OrgRoleViewer, InvitedBy: owner.UserID, ExpiresAt: now.Add(time.Hour)}
+	expired := models.OrgInvitation{OrgID: org.OrgID, UserID: &member.UserID, Role: models.OrgRoleOwner, InvitedBy: owner.UserID, ExpiresAt: now.Add(-time.Hour)}
+	for _, invitation := range []*models.OrgInvitation{&byName, &byEmail, &expired} {
+		if err := testDB.CreateOrgInvitation(context.Background(), invitation); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the email invitation is only visible with the verified email
+	invitations, err := testDB.ReadInvitationsForUser(context.Background(), member.UserID, "", now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, invitations, 1)
+	assert.Equal(t, "Team", invitations[0].OrgName)
+
+	invitations, err = testDB.ReadInvitationsForUser(context.Background(), member.UserID, member.Email, now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, invitations, 2)
+
+	_, err = testDB.AcceptOrgInvitation(context.Background(), expired.InvitationID, member.UserID, "", now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testDB.AcceptOrgInvitation(context.Background(), byName.InvitationID, owner.UserID, owner.Email, now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	orgID, err := testDB.AcceptOrgInvitation(context.Background(), byName.InvitationID, member.UserID, "", now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, org.OrgID, orgID)
+
+	// a second invitation doesn't change the role of a member
+	_, err = testDB.AcceptOrgInvitation(context.Background(), byEmail.InvitationID, member.UserID, member.Email, now)
+	assert.NoError(t, err, "Expected no error")
+
+	role, err := testDB.ReadOrgMemberRole(context.Background(), org.OrgID, member.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, models.OrgRoleEditor, role)
+
+	members, err := testDB.ReadOrgMembers(context.Background(), org.OrgID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, members, 2)
+	assert.Equal(t, "owner", members[0].Username)
+
+	err = testDB.DeleteExpiredOrgInvitations(context.Background(), now)
+	assert.NoError(t, err, "Expected no error")
+	invitations, err = testDB.ReadOrgInvitations(context.Background(), org.OrgID, now.Add(-2*time.Hour))
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, invitations, 0)
+}
+
+func TestOrgLastOwner(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareOrgTables(t, testDB)
+	owner, member := createOrgTestUsers(t, testDB)
+
+	org := models.Organisation{Name: "Team", DevKey: "org_dev_key"}
+	if err := testDB.CreateOrganisation(context.Background(), &org, owner.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := testDB.CountSoleOwnedOrganisations(context.Background(), owner.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, 1, count)
+
+	assert.ErrorIs(t, testDB.SetOrgMemberRole(context.Background(), org.OrgID, owner.UserID, models.OrgRoleEditor), ErrLastOwner)
+	assert.ErrorIs(t, testDB.RemoveOrgMember(context.Background(), org.OrgID, owner.UserID), ErrLastOwner)
+
+	invitation := models.OrgInvitation{OrgID: org.OrgID, UserID: &member.UserID, Role: models.OrgRoleOwner, InvitedBy: owner.UserID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := testDB.CreateOrgInvitation(context.Background(), &invitation); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.AcceptOrgInvitation(context.Background(), invitation.InvitationID, member.UserID, "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// with a second owner the first one can leave
+	err = testDB.RemoveOrgMember(context.Background(), org.OrgID, owner.UserID)
+	assert.NoError(t, err, "Expected no error")
+
+	err = testDB.SetOrgMemberRole(context.Background(), org.OrgID, uuid.New(), models.OrgRoleViewer)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteOrganisation(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareOrgTables(t, testDB)
+	prepareShareTables(t, testDB)
+	owner, _ := createOrgTestUsers(t, testDB)
+
+	org := models.Organisation{Name: "Team", DevKey: "org_dev_key"}
+	if err := testDB.CreateOrganisation(context.Background(), &org, owner.UserID); err != nil {
+		t.Fatal(err)
+	}
+	object := models.Object{PasteKey: "org_paste", DevKey: org.DevKey, MessageID: "message"}
+	if err := testDB.CreateObject(context.Background(), &object); err != nil {
+		t.Fatal(err)
+	}
+
+	// organisations with pastes are not deleted
+	err = testDB.DeleteOrganisation(context.Background(), org.OrgID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	if err := testDB.DeleteObject(context.Background(), object.PasteKey, org.DevKey); err != nil {
+		t.Fatal(err)
+	}
+	err = testDB.DeleteOrganisation(context.Background(), org.OrgID)
+	assert.NoError(t, err, "Expected no error")
+
+	_, err = testDB.ReadOrgMemberRole(context.Background(), org.OrgID, owner.UserID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
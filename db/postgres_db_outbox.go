@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const outboxColumns = "outbox_id, operation, paste_key, message_id, state, created_at"
+
+func scanOutboxEntry(row rowScanner, entry *models.OutboxEntry) error {
+	return row.Scan(&entry.OutboxID, &entry.Operation, &entry.PasteKey, &entry.MessageID, &entry.State, &entry.CreatedAt)
+}
+
+// CREATE a pending entry, before the paste is written to Postgres and to the message store
+func (dbObj *PostgresDB) CreateOutboxEntry(ctx context.Context, entry *models.OutboxEntry) error {
+	query := `
+		INSERT INTO PasteOutbox (operation, paste_key, message_id)
+		VALUES ($1, $2, $3)
+		RETURNING outbox_id, state, created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, entry.Operation, entry.PasteKey, entry.MessageID).
+		Scan(&entry.OutboxID, &entry.State, &entry.CreatedAt)
+}
+
+// READ pending entries, oldest first
+func (dbObj *PostgresDB) ReadPendingOutboxEntries(ctx context.Context) ([]models.OutboxEntry, error) {
+	query := "SELECT " + outboxColumns + " FROM PasteOutbox WHERE state = $1 ORDER BY created_at"
+
+	rows, err := dbObj.db.QueryContext(ctx, query, models.OutboxPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.OutboxEntry
+	for rows.Next() {
+		var entry models.OutboxEntry
+		if err := scanOutboxEntry(rows, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// UPDATE marks a pending entry committed, once both stores are written
+func (dbObj *PostgresDB) CommitOutboxEntry(ctx context.Context, outboxID uuid.UUID) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE PasteOutbox SET state = $1 WHERE outbox_id = $2 AND state = $3",
+		models.OutboxCommitted, outboxID, models.OutboxPending)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// DELETE an entry whose operation was given up, nothing is left to repair
+func (dbObj *PostgresDB) DeleteOutboxEntry(ctx context.Context, outboxID uuid.UUID) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM PasteOutbox WHERE outbox_id = $1", outboxID)
+	return err
+}
+
+// DELETE committed entries created before the given time and return how many were deleted
+func (dbObj *PostgresDB) DeleteCommittedOutboxEntries(ctx context.Context, before time.Time) (int64, error) {
+	result, err := dbObj.db.ExecContext(ctx, "DELETE FROM PasteOutbox WHERE state = $1 AND created_at < $2", models.OutboxCommitted, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareOutboxTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the PasteOutbox table if it exists
+	_, err := testDB.db.ExecContext(context.Background(), "DROP TABLE IF EXISTS PasteOutbox;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the PasteOutbox table
+	createScript := `
+		CREATE TABLE PasteOutbox (
+			outbox_id  uuid DEFAULT uuid_generate_v4(),
+			operation  varchar(8) NOT NULL CHECK (operation IN ('create', 'delete')),
+			paste_key  varchar(20) NOT NULL,
+			message_id varchar(24) NOT NULL,
+			state      varchar(10) NOT NULL DEFAULT 'pending',
+			created_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (outbox_id)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("PasteOutbox table created successfully!")
+}
+
+func TestPasteOutbox(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareOutboxTable(t, testDB)
+	testOutbox(t, testDB)
+}
+
+// testOutbox runs the outbox checks on Postgres and on SQLite
+func testOutbox(t *testing.T, testDB *PostgresDB) {
+	ctx := context.Background()
+
+	created := models.OutboxEntry{Operation: models.OutboxCreate, PasteKey: "created", MessageID: "000000000000000000000001"}
+	assert.NoError(t, testDB.CreateOutboxEntry(ctx, &created))
+	assert.Equal(t, models.OutboxPending, created.State)
+	deleted := models.OutboxEntry{Operation: models.OutboxDelete, PasteKey: "deleted", MessageID: "000000000000000000000002"}
+	assert.NoError(t, testDB.CreateOutboxEntry(ctx, &deleted))
+	assert.Error(t, testDB.CreateOutboxEntry(ctx, &models.OutboxEntry{Operation: "update", PasteKey: "x", MessageID: "x"}))
+
+	entries, err := testDB.ReadPendingOutboxEntries(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"created", "deleted"}, []string{entries[0].PasteKey, entries[1].PasteKey})
+	assert.Equal(t, created.OutboxID, entries[0].OutboxID)
+
+	// committed entries are no longer pending and are committed once
+	assert.NoError(t, testDB.CommitOutboxEntry(ctx, created.OutboxID))
+	assert.ErrorIs(t, testDB.CommitOutboxEntry(ctx, created.OutboxID), sql.ErrNoRows)
+	assert.NoError(t, testDB.DeleteOutboxEntry(ctx, deleted.OutboxID))
+	entries, err = testDB.ReadPendingOutboxEntries(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	purged, err := testDB.DeleteCommittedOutboxEntries(ctx, created.CreatedAt)
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = testDB.DeleteCommittedOutboxEntries(ctx, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	// every object is read, in the order of paste keys
+	for _, pasteKey := range []string{"b", "a"} {
+		assert.NoError(t, testDB.CreateObject(ctx, &models.Object{PasteKey: pasteKey, DevKey: "owner", MessageID: "msg_" + pasteKey}))
+	}
+	var messageIDs []string
+	assert.NoError(t, testDB.ReadAllObjects(ctx, func(obj models.Object) error {
+		messageIDs = append(messageIDs, obj.MessageID)
+		return nil
+	}))
+	assert.Equal(t, []string{"msg_a", "msg_b"}, messageIDs)
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const shareLinkColumns = "link_id, paste_key, created_by, expires_at, max_uses, uses, revoked_at, created_at"
+
+func scanShareLink(row rowScanner, link *models.ShareLink) error {
+	return row.Scan(&link.LinkID, &link.PasteKey, &link.CreatedBy, &link.ExpiresAt, &link.MaxUses, &link.Uses, &link.RevokedAt, &link.CreatedAt)
+}
+
+// CREATE or UPDATE the grant of the grantee on the paste
+func (dbObj *PostgresDB) SetPasteGrant(ctx context.Context, grant *models.PasteGrant) error {
+	query := `
+		INSERT INTO PasteGrant (paste_key, grantee_type, grantee_id, permission)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (paste_key, grantee_type, grantee_id) DO UPDATE SET permission = EXCLUDED.permission
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, grant.PasteKey, grant.GranteeType, grant.GranteeID, grant.Permission).Scan(&grant.CreatedAt)
+}
+
+// READ grants of the paste with the names of users and organisations
+func (dbObj *PostgresDB) ReadPasteGrants(ctx context.Context, pasteKey string) ([]models.PasteGrant, error) {
+	query := `
+		SELECT g.paste_key, g.grantee_type, g.grantee_id, COALESCE(u.name, o.name, ''), g.permission, g.created_at
+		FROM PasteGrant g
+		LEFT JOIN Users u ON g.grantee_type = 'user' AND u.user_id = g.grantee_id
+		LEFT JOIN Organisation o ON g.grantee_type = 'org' AND o.org_id = g.grantee_id
+		WHERE g.paste_key = $1
+		ORDER BY g.created_at
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, pasteKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make([]models.PasteGrant, 0)
+	for rows.Next() {
+		var grant models.PasteGrant
+		err := rows.Scan(&grant.PasteKey, &grant.GranteeType, &grant.GranteeID, &grant.GranteeName, &grant.Permission, &grant.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// DELETE
+func (dbObj *PostgresDB) DeletePasteGrant(ctx context.Context, pasteKey, granteeType string, granteeID uuid.UUID) error {
+	query := "DELETE FROM PasteGrant WHERE paste_key = $1 AND grantee_type = $2 AND grantee_id = $3"
+
+	result, err := dbObj.db.ExecContext(ctx, query, pasteKey, granteeType, granteeID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// READ the strongest permission the user has on the paste, granted directly or to one of its
+// organisations. Returns sql.ErrNoRows when nothing is granted.
+func (dbObj *PostgresDB) ReadGrantPermission(ctx context.Context, pasteKey string, userID uuid.UUID) (string, error) {
+	query := `
+		SELECT g.permission
+		FROM PasteGrant g
+		WHERE g.paste_key = $1 AND (
+			(g.grantee_type = 'user' AND g.grantee_id = $2) OR
+			(g.grantee_type = 'org' AND g.grantee_id IN (SELECT org_id FROM OrgMember WHERE user_id = $2))
+		)
+		ORDER BY g.permission = 'edit' DESC
+		LIMIT 1
+	`
+
+	var permission string
+	err := dbObj.db.QueryRowContext(ctx, query, pasteKey, userID).Scan(&permission)
+	return permission, err
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	if link.LinkID == uuid.Nil {
+		link.LinkID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO ShareLink (link_id, paste_key, created_by, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING uses, created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, link.LinkID, link.PasteKey, link.CreatedBy, link.ExpiresAt, link.MaxUses).
+		Scan(&link.Uses, &link.CreatedAt)
+}
+
+// READ links of the paste, newest first
+func (dbObj *PostgresDB) ReadShareLinks(ctx context.Context, pasteKey string) ([]models.ShareLink, error) {
+	query := `
+		SELECT ` + shareLinkColumns + `
+		FROM ShareLink
+		WHERE paste_key = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, pasteKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]models.ShareLink, 0)
+	for rows.Next() {
+		var link models.ShareLink
+		if err := scanShareLink(rows, &link); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// UPDATE revokes a link that was not revoked yet
+func (dbObj *PostgresDB) RevokeShareLink(ctx context.Context, pasteKey string, linkID uuid.UUID, now time.Time) error {
+	query := `
+		UPDATE ShareLink
+		SET revoked_at = $1
+		WHERE link_id = $2 AND paste_key = $3 AND revoked_at IS NULL
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, now, linkID, pasteKey)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE counts one use of the link and returns its paste. Returns sql.ErrNoRows when the link
+// doesn't exist, was revoked, expired or has no uses left.
+func (dbObj *PostgresDB) UseShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (string, error) {
+	query := `
+		UPDATE ShareLink
+		SET uses = uses + 1
+		WHERE link_id = $1 AND revoked_at IS NULL AND expires_at > $2 AND (max_uses IS NULL OR uses < max_uses)
+		RETURNING paste_key
+	`
+
+	var pasteKey string
+	err := dbObj.db.QueryRowContext(ctx, query, linkID, now).Scan(&pasteKey)
+	return pasteKey, err
+}
+
+// DELETE links that expired before the given time
+func (dbObj *PostgresDB) DeleteExpiredShareLinks(ctx context.Context, before time.Time) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM ShareLink WHERE expires_at <= $1", before)
+	return err
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareShareTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the sharing tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS ShareLink;
+		DROP TABLE IF EXISTS PasteGrant;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the sharing tables, Object table has to exist
+	createScript := `
+		CREATE TABLE PasteGrant (
+			paste_key    varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			grantee_type varchar(8) NOT NULL,
+			grantee_id   uuid NOT NULL,
+			permission   varchar(8) NOT NULL,
+			created_at   timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (paste_key, grantee_type, grantee_id)
+		);
+		CREATE TABLE ShareLink (
+			link_id    uuid DEFAULT uuid_generate_v4(),
+			paste_key  varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			created_by uuid NOT NULL,
+			expires_at timestamptz NOT NULL,
+			max_uses   int,
+			uses       int NOT NULL DEFAULT 0,
+			revoked_at timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (link_id)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Sharing tables created successfully!")
+}
+
+func TestPasteGrants(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareOrgTables(t, testDB)
+	prepareShareTables(t, testDB)
+	owner, member := createOrgTestUsers(t, testDB)
+
+	ctx := context.Background()
+	paste := models.Object{DevKey: owner.DevKey, PasteKey: "shared_paste", MessageID: "msg"}
+	assert.NoError(t, testDB.CreateObject(ctx, &paste))
+
+	// Nothing granted yet
+	_, err = testDB.ReadGrantPermission(ctx, paste.PasteKey, member.UserID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	grant := models.PasteGrant{PasteKey: paste.PasteKey, GranteeType: models.GranteeUser, GranteeID: member.UserID, Permission: models.PermissionRead}
+	assert.NoError(t, testDB.SetPasteGrant(ctx, &grant))
+	permission, err := testDB.ReadGrantPermission(ctx, paste.PasteKey, member.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PermissionRead, permission)
+
+	// Setting the grant again replaces the permission
+	grant.Permission = models.PermissionEdit
+	assert.NoError(t, testDB.SetPasteGrant(ctx, &grant))
+	grants, err := testDB.ReadPasteGrants(ctx, paste.PasteKey)
+	assert.NoError(t, err)
+	assert.Len(t, grants, 1)
+	assert.Equal(t, models.PermissionEdit, grants[0].Permission)
+	assert.Equal(t, member.Name, grants[0].GranteeName)
+
+	assert.NoError(t, testDB.DeletePasteGrant(ctx, paste.PasteKey, models.GranteeUser, member.UserID))
+	assert.ErrorIs(t, testDB.DeletePasteGrant(ctx, paste.PasteKey, models.GranteeUser, member.UserID), sql.ErrNoRows)
+
+	// Grants to an organisation apply to its members
+	org := models.Organisation{Name: "Readers", DevKey: "readers_dev_key"}
+	assert.NoError(t, testDB.CreateOrganisation(ctx, &org, member.UserID))
+	orgGrant := models.PasteGrant{PasteKey: paste.PasteKey, GranteeType: models.GranteeOrg, GranteeID: org.OrgID, Permission: models.PermissionRead}
+	assert.NoError(t, testDB.SetPasteGrant(ctx, &orgGrant))
+	permission, err = testDB.ReadGrantPermission(ctx, paste.PasteKey, member.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PermissionRead, permission)
+
+	// The strongest permission wins
+	grant.Permission = models.PermissionEdit
+	assert.NoError(t, testDB.SetPasteGrant(ctx, &grant))
+	permission, err = testDB.ReadGrantPermission(ctx, paste.PasteKey, member.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PermissionEdit, permission)
+}
+
+func TestShareLinks(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareShareTables(t, testDB)
+
+	ctx := context.Background()
+	now := time.Now()
+	paste := models.Object{DevKey: "owner_dev_key", PasteKey: "linked_paste", MessageID: "msg"}
+	assert.NoError(t, testDB.CreateObject(ctx, &paste))
+
+	maxUses := 2
+	limited := models.ShareLink{PasteKey: paste.PasteKey, CreatedBy: uuid.New(), ExpiresAt: now.Add(time.Hour), MaxUses: &maxUses}
+	assert.NoError(t, testDB.CreateShareLink(ctx, &limited))
+
+	for i := 0; i < maxUses; i++ {
+		pasteKey, err := testDB.UseShareLink(ctx, limited.LinkID, now)
+		assert.NoError(t, err)
+		assert.Equal(t, paste.PasteKey, pasteKey)
+	}
+	_, err = testDB.UseShareLink(ctx, limited.LinkID, now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Expired links cannot be used
+	unlimited := models.ShareLink{PasteKey: paste.PasteKey, CreatedBy: uuid.New(), ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, testDB.CreateShareLink(ctx, &unlimited))
+	_, err = testDB.UseShareLink(ctx, unlimited.LinkID, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Revoked links cannot be used
+	assert.NoError(t, testDB.RevokeShareLink(ctx, paste.PasteKey, unlimited.LinkID, now))
+	assert.ErrorIs(t, testDB.RevokeShareLink(ctx, paste.PasteKey, unlimited.LinkID, now), sql.ErrNoRows)
+	_, err = testDB.UseShareLink(ctx, unlimited.LinkID, now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	links, err := testDB.ReadShareLinks(ctx, paste.PasteKey)
+	assert.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	assert.NoError(t, testDB.DeleteExpiredShareLinks(ctx, now.Add(2*time.Hour)))
+	links, err = testDB.ReadShareLinks(ctx, paste.PasteKey)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"time"
+)
+
+// CREATE
+func (dbObj *PostgresDB) CreateSsoLogin(ctx context.Context, login *models.SsoLogin) error {
+	query := `
+		INSERT INTO SsoLogin (state_hash, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, login.StateHash, login.Provider, login.CodeVerifier, login.Nonce, login.ExpiresAt).
+		Scan(&login.CreatedAt)
+}
+
+// DELETE returns the started login and removes it so the state works once,
+// sql.ErrNoRows means the state is unknown, used or expired
+func (dbObj *PostgresDB) UseSsoLogin(ctx context.Context, stateHash string, now time.Time) (*models.SsoLogin, error) {
+	var login models.SsoLogin
+	query := `
+		DELETE FROM SsoLogin
+		WHERE state_hash = $1 AND expires_at > $2
+		RETURNING state_hash, provider, code_verifier, nonce, created_at, expires_at
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, stateHash, now).
+		Scan(&login.StateHash, &login.Provider, &login.CodeVerifier, &login.Nonce, &login.CreatedAt, &login.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+// DELETE logins that were never finished
+func (dbObj *PostgresDB) DeleteExpiredSsoLogins(ctx context.Context, now time.Time) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM SsoLogin WHERE expires_at < $1", now)
+	return err
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO UserIdentity (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).
+		Scan(&identity.CreatedAt)
+}
+
+// READ
+func (dbObj *PostgresDB) ReadUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM UserIdentity
+		WHERE provider = $1 AND subject = $2
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, provider, subject).
+		Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
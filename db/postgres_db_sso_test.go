@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareSsoTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the single sign-on tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS SsoLogin;
+		DROP TABLE IF EXISTS UserIdentity;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the single sign-on tables with your specified schema
+	createScript := `
+		CREATE TABLE UserIdentity (
+			provider       varchar(64) NOT NULL,
+			subject        varchar(255) NOT NULL,
+			user_id        uuid NOT NULL,
+			email          varchar(254) NOT NULL DEFAULT '',
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (provider, subject)
+		);
+		CREATE TABLE SsoLogin (
+			state_hash     varchar(64) NOT NULL,
+			provider       varchar(64) NOT NULL,
+			code_verifier  varchar(128) NOT NULL,
+			nonce          varchar(64) NOT NULL,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			expires_at     timestamptz NOT NULL,
+			PRIMARY KEY (state_hash)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Single sign-on tables created successfully!")
+}
+
+func TestUseSsoLogin(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareSsoTables(t, testDB)
+
+	now := time.Now()
+	login := models.SsoLogin{StateHash: "state", Provider: "corp", CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: now.Add(time.Minute)}
+	err = testDB.CreateSsoLogin(context.Background(), &login)
+	assert.NoError(t, err, "Expected no error")
+
+	used, err := testDB.UseSsoLogin(context.Background(), "state", now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "verifier", used.CodeVerifier)
+
+	// state works only once
+	_, err = testDB.UseSsoLogin(context.Background(), "state", now)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	expired := models.SsoLogin{StateHash: "old", Provider: "corp", CodeVerifier: "v", Nonce: "n", ExpiresAt: now.Add(-time.Minute)}
+	if err := testDB.CreateSsoLogin(context.Background(), &expired); err != nil {
+		t.Fatal(err)
+	}
+	_, err = testDB.UseSsoLogin(context.Background(), "old", now)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestUserIdentity(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareSsoTables(t, testDB)
+
+	identity := models.UserIdentity{Provider: "corp", Subject: "12345", UserID: uuid.New(), Email: "a@example.com"}
+	err = testDB.CreateUserIdentity(context.Background(), &identity)
+	assert.NoError(t, err, "Expected no error")
+
+	read, err := testDB.ReadUserIdentity(context.Background(), "corp", "12345")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, identity.UserID, read.UserID)
+
+	// subjects are unique per provider only
+	_, err = testDB.ReadUserIdentity(context.Background(), "other", "12345")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
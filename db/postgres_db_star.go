@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CREATE star of a user on a paste and count it, starring twice changes nothing
+func (dbObj *PostgresDB) StarPaste(ctx context.Context, userID uuid.UUID, pasteKey string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO Star (user_id, paste_key)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID, pasteKey)
+	if err != nil {
+		return err
+	}
+	// already starred, nothing to count
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE Object SET stars = stars + 1 WHERE paste_key = $1", pasteKey); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DELETE star of a user on a paste
+func (dbObj *PostgresDB) UnstarPaste(ctx context.Context, userID uuid.UUID, pasteKey string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM Star WHERE user_id = $1 AND paste_key = $2", userID, pasteKey)
+	if err != nil {
+		return err
+	}
+	// not starred, nothing to count
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE Object SET stars = stars - 1 WHERE paste_key = $1", pasteKey); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// READ one page of pastes starred by a user, most recently starred first, with the time each was starred.
+// Stars of deleted pastes are gone with them, private pastes of other users are skipped.
+func (dbObj *PostgresDB) ReadStarredObjectsPage(ctx context.Context, userID uuid.UUID, devKey string, limit int, after *models.ObjectCursor) ([]models.Object, []time.Time, bool, error) {
+	args := []any{userID, devKey, models.VisibilityPrivate, limit + 1}
+	keyset := ""
+	if after != nil {
+		starredAt, err := time.Parse(time.RFC3339Nano, after.SortValue)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("invalid cursor: %w", err)
+		}
+		args = append(args, starredAt, after.PasteKey)
+		keyset = "AND (s.starred_at, s.paste_key) < ($5, $6)"
+	}
+
+	query := `
+		SELECT ` + objectColumnsOf("o") + `, s.starred_at
+		FROM Star s
+		JOIN Object o ON o.paste_key = s.paste_key
+		WHERE s.user_id = $1 AND (o.visibility <> $3 OR o.dev_key = $2) ` + keyset + `
+		ORDER BY s.starred_at DESC, s.paste_key DESC
+		LIMIT $4
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rows.Close()
+
+	var objects []models.Object
+	var starredAt []time.Time
+	for rows.Next() {
+		var obj models.Object
+		var starred time.Time
+		if err := rows.Scan(append(objectFields(&obj), &starred)...); err != nil {
+			return nil, nil, false, err
+		}
+		objects = append(objects, obj)
+		starredAt = append(starredAt, starred)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, false, err
+	}
+
+	if len(objects) > limit {
+		return objects[:limit], starredAt[:limit], true, nil
+	}
+	return objects, starredAt, false, nil
+}
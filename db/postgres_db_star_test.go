@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareStarTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the Star table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS Star;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the Star table, Object table has to exist
+	createScript := `
+		CREATE TABLE Star (
+			user_id        uuid NOT NULL,
+			paste_key      varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			starred_at     timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (user_id, paste_key)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Star table created successfully!")
+}
+
+func TestStarPaste(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareStarTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key")
+
+	userID := uuid.New()
+
+	// Starring twice counts once
+	assert.NoError(t, testDB.StarPaste(context.Background(), userID, "test_paste_key"))
+	assert.NoError(t, testDB.StarPaste(context.Background(), userID, "test_paste_key"))
+	assert.NoError(t, testDB.StarPaste(context.Background(), uuid.New(), "test_paste_key"))
+
+	resultObject, err := testDB.ReadObjectWithoutDevKey(context.Background(), "test_paste_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, int64(2), resultObject.Stars, "Expected two stars")
+
+	assert.NoError(t, testDB.UnstarPaste(context.Background(), userID, "test_paste_key"))
+	assert.NoError(t, testDB.UnstarPaste(context.Background(), userID, "test_paste_key"))
+
+	resultObject, err = testDB.ReadObjectWithoutDevKey(context.Background(), "test_paste_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, int64(1), resultObject.Stars, "Expected one star left")
+}
+
+func TestReadStarredObjectsPage(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareStarTable(t, testDB)
+	createTestObjects(t, testDB, "other_dev_key", "paste1", "paste2", "paste3", "deleted_paste")
+
+	hidden := models.Object{PasteKey: "private_paste", DevKey: "other_dev_key", MessageID: "test_message_id", Visibility: models.VisibilityPrivate}
+	if err := testDB.CreateObject(context.Background(), &hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	for _, pasteKey := range []string{"paste1", "paste2", "paste3", "deleted_paste", "private_paste"} {
+		if err := testDB.StarPaste(context.Background(), userID, pasteKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.DeleteObject(context.Background(), "deleted_paste", "other_dev_key"); err != nil {
+		t.Fatal(err)
+	}
+
+	firstPage, starredAt, hasMore, err := testDB.ReadStarredObjectsPage(context.Background(), userID, "test_dev_key", 2, nil)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, hasMore, "Expected another page")
+	assert.Len(t, firstPage, 2)
+
+	last := len(firstPage) - 1
+	after := &models.ObjectCursor{SortValue: starredAt[last].UTC().Format(time.RFC3339Nano), PasteKey: firstPage[last].PasteKey}
+	secondPage, _, hasMore, err := testDB.ReadStarredObjectsPage(context.Background(), userID, "test_dev_key", 2, after)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, hasMore, "Expected no more pages")
+	assert.Len(t, secondPage, 1, "Expected deleted and private pastes to be left out")
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+)
+
+// UPDATE replaces all tags of a paste
+func (dbObj *PostgresDB) SetPasteTags(ctx context.Context, pasteKey string, tags []string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM PasteTag WHERE paste_key = $1", pasteKey); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		query := `
+			INSERT INTO PasteTag (paste_key, tag)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, pasteKey, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// READ tags of a paste
+func (dbObj *PostgresDB) ReadPasteTags(ctx context.Context, pasteKey string) ([]string, error) {
+	tagsByPaste, err := dbObj.ReadTagsForPastes(ctx, []string{pasteKey})
+	if err != nil {
+		return nil, err
+	}
+	return tagsByPaste[pasteKey], nil
+}
+
+// READ tags of several pastes at once, keyed by paste key
+func (dbObj *PostgresDB) ReadTagsForPastes(ctx context.Context, pasteKeys []string) (map[string][]string, error) {
+	anyKey, keysArg := dbObj.anyOf("paste_key", "$1", pasteKeys)
+	query := `
+		SELECT paste_key, tag
+		FROM PasteTag
+		WHERE ` + anyKey + `
+		ORDER BY tag
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, keysArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var pasteKey, tag string
+		if err := rows.Scan(&pasteKey, &tag); err != nil {
+			return nil, err
+		}
+		tags[pasteKey] = append(tags[pasteKey], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// READ tags of one user starting with prefix, most used first
+func (dbObj *PostgresDB) ReadTagsByPrefix(ctx context.Context, devKey, prefix string, limit int) ([]models.TagCount, error) {
+	query := `
+		SELECT t.tag, COUNT(*)
+		FROM PasteTag t
+		JOIN Object o ON o.paste_key = t.paste_key
+		WHERE o.dev_key = $1 AND t.tag LIKE $2 || '%' ESCAPE '\'
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag
+		LIMIT $3
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, devKey, escapeLike(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]models.TagCount, 0)
+	for rows.Next() {
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
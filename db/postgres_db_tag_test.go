@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestObjects(t *testing.T, testDB *PostgresDB, devKey string, pasteKeys ...string) {
+	for _, pasteKey := range pasteKeys {
+		testObject := models.Object{
+			PasteKey:  pasteKey,
+			DevKey:    devKey,
+			MessageID: "test_message_id",
+		}
+		if err := testDB.CreateObject(context.Background(), &testObject); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSetPasteTags(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key")
+
+	err = testDB.SetPasteTags(context.Background(), "test_paste_key", []string{"go", "work"})
+	assert.NoError(t, err, "Expected no error")
+
+	// Setting tags again replaces the old ones
+	err = testDB.SetPasteTags(context.Background(), "test_paste_key", []string{"go", "snippet"})
+	assert.NoError(t, err, "Expected no error")
+
+	tags, err := testDB.ReadPasteTags(context.Background(), "test_paste_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, []string{"go", "snippet"}, tags, "Expected the tags to be replaced")
+
+	// Tags are removed together with the paste
+	err = testDB.DeleteObject(context.Background(), "test_paste_key", "test_dev_key")
+	assert.NoError(t, err, "Expected no error")
+
+	tags, err = testDB.ReadPasteTags(context.Background(), "test_paste_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Empty(t, tags, "Expected no tags for a deleted paste")
+}
+
+func TestReadTagsByPrefix(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "test_paste_key1", "test_paste_key2")
+	createTestObjects(t, testDB, "other_dev_key", "test_paste_key3")
+
+	if err := testDB.SetPasteTags(context.Background(), "test_paste_key1", []string{"golang", "work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.SetPasteTags(context.Background(), "test_paste_key2", []string{"golang", "go_snippet"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.SetPasteTags(context.Background(), "test_paste_key3", []string{"gossip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := testDB.ReadTagsByPrefix(context.Background(), "test_dev_key", "go", 10)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, []models.TagCount{{Tag: "golang", Count: 2}, {Tag: "go_snippet", Count: 1}}, tags, "Expected only the user's tags, most used first")
+
+	// Underscore is matched literally, not as a wildcard
+	tags, err = testDB.ReadTagsByPrefix(context.Background(), "test_dev_key", "go_", 10)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, []models.TagCount{{Tag: "go_snippet", Count: 1}}, tags)
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that was already rotated is presented again
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+const refreshTokenColumns = "token_id, family_id, user_id, token_hash, device, created_at, expires_at, used_at, revoked_at"
+
+func scanRefreshToken(row rowScanner, token *models.RefreshToken) error {
+	return row.Scan(&token.TokenID, &token.FamilyID, &token.UserID, &token.TokenHash, &token.Device,
+		&token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+}
+
+// CREATE
+func (dbObj *PostgresDB) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if token.TokenID == uuid.Nil {
+		token.TokenID = uuid.New()
+	}
+	if token.FamilyID == uuid.Nil {
+		token.FamilyID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO RefreshToken (token_id, family_id, user_id, token_hash, device, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+
+	return dbObj.db.QueryRowContext(ctx, query, token.TokenID, token.FamilyID, token.UserID, token.TokenHash, token.Device, token.ExpiresAt).
+		Scan(&token.CreatedAt)
+}
+
+// READ
+func (dbObj *PostgresDB) ReadRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM RefreshToken
+		WHERE token_hash = $1
+	`
+
+	if err := scanRefreshToken(dbObj.db.QueryRowContext(ctx, query, tokenHash), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UPDATE marks the refresh token as used so it can be rotated exactly once.
+// Presenting a token that was already used means it was stolen or replayed, so its whole
+// family is revoked and ErrRefreshTokenReused returned. Unknown, expired and revoked tokens
+// give sql.ErrNoRows.
+func (dbObj *PostgresDB) UseRefreshToken(ctx context.Context, tokenHash string, now time.Time) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	query := `
+		UPDATE RefreshToken
+		SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+		RETURNING ` + refreshTokenColumns
+
+	err := scanRefreshToken(dbObj.db.QueryRowContext(ctx, query, tokenHash, now), &token)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	stored, errRead := dbObj.ReadRefreshToken(ctx, tokenHash)
+	if errRead != nil {
+		return nil, errRead
+	}
+	if stored.UsedAt != nil {
+		if err := dbObj.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return nil, sql.ErrNoRows
+}
+
+// UPDATE revokes every refresh token issued from the same login
+func (dbObj *PostgresDB) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `
+		UPDATE RefreshToken
+		SET revoked_at = now()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// UPDATE revokes every refresh token of a user, logging them out from all devices
+func (dbObj *PostgresDB) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE RefreshToken
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// CREATE revocation of an access token, kept until the token expires
+func (dbObj *PostgresDB) RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	query := `
+		INSERT INTO RevokedToken (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, jti, expiresAt)
+	return err
+}
+
+// READ
+func (dbObj *PostgresDB) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	var revoked bool
+	err := dbObj.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM RevokedToken WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// DELETE revocations and refresh tokens that expired, they can't be used anymore anyway
+func (dbObj *PostgresDB) DeleteExpiredTokens(ctx context.Context, now time.Time) error {
+	if _, err := dbObj.db.ExecContext(ctx, "DELETE FROM RevokedToken WHERE expires_at < $1", now); err != nil {
+		return err
+	}
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM RefreshToken WHERE expires_at < $1", now)
+	return err
+}
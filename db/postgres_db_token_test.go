@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareTokenTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the token tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS RefreshToken;
+		DROP TABLE IF EXISTS RevokedToken;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the token tables with your specified schema
+	createScript := `
+		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+		CREATE TABLE RefreshToken (
+			token_id       uuid DEFAULT uuid_generate_v4(),
+			family_id      uuid NOT NULL,
+			user_id        uuid NOT NULL,
+			token_hash     varchar(64) NOT NULL,
+			device         varchar(256) NOT NULL DEFAULT '',
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			expires_at     timestamptz NOT NULL,
+			used_at        timestamptz,
+			revoked_at     timestamptz,
+			PRIMARY KEY (token_id),
+			UNIQUE (token_hash)
+		);
+		CREATE TABLE RevokedToken (
+			jti            uuid NOT NULL,
+			expires_at     timestamptz NOT NULL,
+			PRIMARY KEY (jti)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Token tables created successfully!")
+}
+
+func TestUseRefreshToken(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareTokenTables(t, testDB)
+
+	now := time.Now()
+	first := models.RefreshToken{UserID: uuid.New(), TokenHash: "first_hash", Device: "test", ExpiresAt: now.Add(time.Hour)}
+	if err := testDB.CreateRefreshToken(context.Background(), &first); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := testDB.UseRefreshToken(context.Background(), "first_hash", now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, first.FamilyID, used.FamilyID)
+
+	// Rotated token in the same family
+	second := models.RefreshToken{FamilyID: first.FamilyID, UserID: first.UserID, TokenHash: "second_hash", ExpiresAt: now.Add(time.Hour)}
+	if err := testDB.CreateRefreshToken(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Using the first token again revokes the whole family
+	_, err = testDB.UseRefreshToken(context.Background(), "first_hash", now)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused, "Expected reuse to be detected")
+
+	_, err = testDB.UseRefreshToken(context.Background(), "second_hash", now)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "Expected the rotated token to be revoked too")
+
+	// Unknown and expired tokens
+	_, err = testDB.UseRefreshToken(context.Background(), "unknown_hash", now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	expired := models.RefreshToken{UserID: first.UserID, TokenHash: "expired_hash", ExpiresAt: now.Add(-time.Minute)}
+	if err := testDB.CreateRefreshToken(context.Background(), &expired); err != nil {
+		t.Fatal(err)
+	}
+	_, err = testDB.UseRefreshToken(context.Background(), "expired_hash", now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareTokenTables(t, testDB)
+
+	jti := uuid.New()
+	revoked, err := testDB.IsAccessTokenRevoked(context.Background(), jti)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, revoked, "Expected the token not to be revoked")
+
+	err = testDB.RevokeAccessToken(context.Background(), jti, time.Now().Add(time.Minute))
+	assert.NoError(t, err, "Expected no error")
+
+	revoked, err = testDB.IsAccessTokenRevoked(context.Background(), jti)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, revoked, "Expected the token to be revoked")
+
+	// Expired revocations are cleaned up
+	err = testDB.DeleteExpiredTokens(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err, "Expected no error")
+
+	revoked, err = testDB.IsAccessTokenRevoked(context.Background(), jti)
+	assert.NoError(t, err, "Expected no error")
+	assert.False(t, revoked, "Expected the expired revocation to be deleted")
+}
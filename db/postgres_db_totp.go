@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"pastebin/models"
+
+	"github.com/google/uuid"
+)
+
+// CREATE or replace the pending TOTP secret of the user, sql.ErrNoRows means 2FA is already enabled
+func (dbObj *PostgresDB) SaveTotpSecret(ctx context.Context, totp *models.UserTotp) error {
+	query := `
+		INSERT INTO UserTotp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = now()
+		WHERE UserTotp.enabled = false
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, totp.UserID, totp.Secret)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// READ
+func (dbObj *PostgresDB) ReadTotp(ctx context.Context, userID uuid.UUID) (*models.UserTotp, error) {
+	var totp models.UserTotp
+	query := `
+		SELECT user_id, secret, enabled, last_step, created_at, enabled_at
+		FROM UserTotp
+		WHERE user_id = $1
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastStep, &totp.CreatedAt, &totp.EnabledAt)
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// UPDATE enables the pending secret with the step of the code that confirmed it and
+// replaces the recovery codes of the user
+func (dbObj *PostgresDB) EnableTotp(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE UserTotp
+		SET enabled = true, enabled_at = now(), last_step = $2
+		WHERE user_id = $1 AND enabled = false AND last_step < $2
+	`
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UPDATE replaces the recovery codes of a user who has 2FA enabled
+func (dbObj *PostgresDB) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM RecoveryCode WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO RecoveryCode (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UPDATE records the step of an accepted code, sql.ErrNoRows means a code of this or a later
+// step was already used
+func (dbObj *PostgresDB) UseTotpStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `
+		UPDATE UserTotp
+		SET last_step = $2
+		WHERE user_id = $1 AND enabled = true AND last_step < $2
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE marks a recovery code as used, sql.ErrNoRows means it is unknown or was used before
+func (dbObj *PostgresDB) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE RecoveryCode
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := dbObj.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// READ number of recovery codes the user can still use
+func (dbObj *PostgresDB) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := dbObj.db.QueryRowContext(ctx, "SELECT count(*) FROM RecoveryCode WHERE user_id = $1 AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// DELETE turns 2FA off for the user
+func (dbObj *PostgresDB) DeleteTotp(ctx context.Context, userID uuid.UUID) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM RecoveryCode WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM UserTotp WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareTotpTables(t *testing.T, testDB *PostgresDB) {
+	// Drop the two factor tables if they exist
+	dropScript := `
+		DROP TABLE IF EXISTS RecoveryCode;
+		DROP TABLE IF EXISTS UserTotp;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the two factor tables with your specified schema
+	createScript := `
+		CREATE TABLE UserTotp (
+			user_id        uuid NOT NULL,
+			secret         varchar(64) NOT NULL,
+			enabled        boolean NOT NULL DEFAULT false,
+			last_step      bigint NOT NULL DEFAULT 0,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			enabled_at     timestamptz,
+			PRIMARY KEY (user_id)
+		);
+		CREATE TABLE RecoveryCode (
+			user_id        uuid NOT NULL,
+			code_hash      varchar(64) NOT NULL,
+			used_at        timestamptz,
+			PRIMARY KEY (user_id, code_hash)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("Two factor tables created successfully!")
+}
+
+func TestEnableTotp(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareTotpTables(t, testDB)
+
+	userID := uuid.New()
+	err = testDB.SaveTotpSecret(context.Background(), &models.UserTotp{UserID: userID, Secret: "SECRET1"})
+	assert.NoError(t, err, "Expected no error")
+
+	// enrolling again before confirming replaces the pending secret
+	err = testDB.SaveTotpSecret(context.Background(), &models.UserTotp{UserID: userID, Secret: "SECRET2"})
+	assert.NoError(t, err, "Expected no error")
+
+	totp, err := testDB.ReadTotp(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "SECRET2", totp.Secret)
+	assert.False(t, totp.Enabled)
+
+	err = testDB.EnableTotp(context.Background(), userID, 100, []string{"code1", "code2"})
+	assert.NoError(t, err, "Expected no error")
+
+	totp, err = testDB.ReadTotp(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, totp.Enabled)
+	assert.Equal(t, int64(100), totp.LastStep)
+
+	// enabled secret can't be replaced
+	err = testDB.SaveTotpSecret(context.Background(), &models.UserTotp{UserID: userID, Secret: "SECRET3"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	count, err := testDB.CountRecoveryCodes(context.Background(), userID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, 2, count)
+}
+
+func TestUseTotpStepAndRecoveryCode(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareTotpTables(t, testDB)
+
+	userID := uuid.New()
+	if err := testDB.SaveTotpSecret(context.Background(), &models.UserTotp{UserID: userID, Secret: "SECRET"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.EnableTotp(context.Background(), userID, 100, []string{"code1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// codes of used steps are rejected
+	assert.Equal(t, sql.ErrNoRows, testDB.UseTotpStep(context.Background(), userID, 100))
+	assert.NoError(t, testDB.UseTotpStep(context.Background(), userID, 101))
+	assert.Equal(t, sql.ErrNoRows, testDB.UseTotpStep(context.Background(), userID, 101))
+
+	assert.NoError(t, testDB.UseRecoveryCode(context.Background(), userID, "code1"))
+	assert.Equal(t, sql.ErrNoRows, testDB.UseRecoveryCode(context.Background(), userID, "code1"))
+	assert.Equal(t, sql.ErrNoRows, testDB.UseRecoveryCode(context.Background(), userID, "unknown"))
+
+	assert.NoError(t, testDB.DeleteTotp(context.Background(), userID))
+	_, err = testDB.ReadTotp(context.Background(), userID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
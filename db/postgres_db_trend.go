@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"math"
+	"pastebin/models"
+	"time"
+)
+
+// Trending score of a paste is the sum of its views, each worth 1 at the moment it happened
+// and halving every TrendingHalfLife. Instead of decaying all scores as time passes, every
+// new view is worth exp(rate * t) where t is the time since trendingEpoch, which keeps the
+// order of pastes the same and lets a view update only its own row. The sums are kept as
+// logarithms so they don't overflow.
+const TrendingHalfLife = 24 * time.Hour
+
+var trendingEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var trendingRate = math.Ln2 / TrendingHalfLife.Seconds()
+
+// logWeight is the logarithm of the weight of a view that happens at time t
+func logWeight(t time.Time) float64 {
+	return trendingRate * t.Sub(trendingEpoch).Seconds()
+}
+
+// TrendingScore converts a stored log score into the decayed number of views at time now
+func TrendingScore(logScore float64, now time.Time) float64 {
+	return math.Exp(logScore - logWeight(now))
+}
+
+// CREATE or UPDATE trending score of a paste with one view that happened at viewedAt
+func (dbObj *PostgresDB) RecordTrendingView(ctx context.Context, pasteKey string, viewedAt time.Time) error {
+	// log(a + b) = max + log(1 + exp(min - max)) keeps the sum in log space
+	query := `
+		INSERT INTO PasteTrend (paste_key, log_score)
+		VALUES ($1, $2)
+		ON CONFLICT (paste_key) DO UPDATE SET log_score =
+			GREATEST(PasteTrend.log_score, EXCLUDED.log_score) +
+			LN(1 + EXP(LEAST(PasteTrend.log_score, EXCLUDED.log_score) - GREATEST(PasteTrend.log_score, EXCLUDED.log_score)))
+	`
+
+	_, err := dbObj.db.ExecContext(ctx, query, pasteKey, logWeight(viewedAt))
+	return err
+}
+
+// READ public objects with the highest trending score at time now, together with their scores.
+// Pastes whose score decayed below minScore are left out.
+func (dbObj *PostgresDB) ReadTrendingObjects(ctx context.Context, now time.Time, minScore float64, limit int) ([]models.Object, []float64, error) {
+	query := `
+		SELECT ` + objectColumnsOf("o") + `, t.log_score
+		FROM PasteTrend t
+		JOIN Object o ON o.paste_key = t.paste_key
+		WHERE o.visibility = $1 AND t.log_score >= $2
+		ORDER BY t.log_score DESC, o.paste_key
+		LIMIT $3
+	`
+
+	rows, err := dbObj.db.QueryContext(ctx, query, models.VisibilityPublic, logWeight(now)+math.Log(minScore), limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var objects []models.Object
+	var scores []float64
+	for rows.Next() {
+		var obj models.Object
+		var logScore float64
+		if err := rows.Scan(append(objectFields(&obj), &logScore)...); err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, obj)
+		scores = append(scores, TrendingScore(logScore, now))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return objects, scores, nil
+}
+
+// DELETE trending rows whose score decayed below minScore, they can't get back into the feed without new views
+func (dbObj *PostgresDB) PruneTrending(ctx context.Context, now time.Time, minScore float64) (int64, error) {
+	result, err := dbObj.db.ExecContext(ctx, "DELETE FROM PasteTrend WHERE log_score < $1", logWeight(now)+math.Log(minScore))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
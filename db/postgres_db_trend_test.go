@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareTrendTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the PasteTrend table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS PasteTrend;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the PasteTrend table, Object table has to exist
+	createScript := `
+		CREATE TABLE PasteTrend (
+			paste_key      varchar(20) NOT NULL REFERENCES Object (paste_key) ON DELETE CASCADE,
+			log_score      double precision NOT NULL,
+			PRIMARY KEY (paste_key)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("PasteTrend table created successfully!")
+}
+
+func TestTrendingScore(t *testing.T) {
+	viewedAt := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, 1.0, TrendingScore(logWeight(viewedAt), viewedAt), 1e-9, "Expected a fresh view to be worth 1")
+	assert.InDelta(t, 0.5, TrendingScore(logWeight(viewedAt), viewedAt.Add(TrendingHalfLife)), 1e-9, "Expected a view to be worth half after one half-life")
+}
+
+func TestReadTrendingObjects(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareObjectTable(t, testDB)
+	prepareTrendTable(t, testDB)
+	createTestObjects(t, testDB, "test_dev_key", "old_paste", "new_paste")
+
+	hidden := models.Object{PasteKey: "private_paste", DevKey: "test_dev_key", MessageID: "test_message_id", Visibility: models.VisibilityPrivate}
+	if err := testDB.CreateObject(context.Background(), &hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// Three views two days ago are worth less than two views now
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, testDB.RecordTrendingView(context.Background(), "old_paste", now.Add(-2*TrendingHalfLife)))
+	}
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, testDB.RecordTrendingView(context.Background(), "new_paste", now))
+	}
+	assert.NoError(t, testDB.RecordTrendingView(context.Background(), "private_paste", now))
+
+	objects, scores, err := testDB.ReadTrendingObjects(context.Background(), now, 0.01, 10)
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, objects, 2, "Expected only public pastes")
+	assert.Equal(t, "new_paste", objects[0].PasteKey, "Expected recent views to rank higher")
+	assert.InDelta(t, 2.0, scores[0], 1e-6)
+	assert.InDelta(t, 0.75, scores[1], 1e-6)
+
+	// Raising the minimum score drops the old paste
+	pruned, err := testDB.PruneTrending(context.Background(), now, 1)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, int64(1), pruned, "Expected the old paste to be pruned")
+}
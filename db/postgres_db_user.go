@@ -8,20 +8,30 @@ import (
 	"github.com/google/uuid"
 )
 
+const userColumns = "user_id, name, password, pasteNum, dev_key, email, email_verified, role, suspended_at"
+
+func scanUser(row rowScanner, user *models.User) error {
+	return row.Scan(&user.UserID, &user.Name, &user.Password, &user.PasteNum, &user.DevKey, &user.Email, &user.EmailVerified,
+		&user.Role, &user.SuspendedAt)
+}
+
 // CREATE
 func (dbObj *PostgresDB) CreateUser(ctx context.Context, user *models.User) (uuid.UUID, error) {
 	if user.UserID == uuid.Nil {
 		user.UserID = uuid.New()
 	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
 
 	query := `
-		INSERT INTO Users (user_id, name, password, pasteNum, dev_key, email)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO Users (user_id, name, password, pasteNum, dev_key, email, role)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING user_id
 	`
 
 	var createdUserID uuid.UUID
-	err := dbObj.db.QueryRowContext(ctx, query, user.UserID, user.Name, user.Password, user.PasteNum, user.DevKey, user.Email).Scan(&createdUserID)
+	err := dbObj.db.QueryRowContext(ctx, query, user.UserID, user.Name, user.Password, user.PasteNum, user.DevKey, user.Email, user.Role).Scan(&createdUserID)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -32,24 +42,88 @@ func (dbObj *PostgresDB) CreateUser(ctx context.Context, user *models.User) (uui
 // READ
 func (dbObj *PostgresDB) ReadUserById(ctx context.Context, userID uuid.UUID) (models.User, error) {
 	var user models.User
-	err := dbObj.db.QueryRowContext(ctx, "SELECT user_id, name, password, pasteNum, dev_key, email FROM Users WHERE user_id = $1", userID).
-		Scan(&user.UserID, &user.Name, &user.Password, &user.PasteNum, &user.DevKey, &user.Email)
+	err := scanUser(dbObj.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM Users WHERE user_id = $1", userID), &user)
 	if err != nil {
 		return models.User{}, err
 	}
 	return user, nil
 }
 
+// READ the user with the username, compared case insensitively like the unique index does
 func (dbObj *PostgresDB) ReadUserByUsername(ctx context.Context, username string) (models.User, error) {
 	var user models.User
-	err := dbObj.db.QueryRowContext(ctx, "SELECT user_id, name, password, pasteNum, dev_key, email FROM Users WHERE name = $1", username).
-		Scan(&user.UserID, &user.Name, &user.Password, &user.PasteNum, &user.DevKey, &user.Email)
+	err := scanUser(dbObj.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM Users WHERE lower(name) = lower($1)", username), &user)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (dbObj *PostgresDB) ReadUserByDevKey(ctx context.Context, devKey string) (models.User, error) {
+	var user models.User
+	err := scanUser(dbObj.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM Users WHERE dev_key = $1", devKey), &user)
 	if err != nil {
 		return models.User{}, err
 	}
 	return user, nil
 }
 
+// READ users with the email, compared case insensitively
+func (dbObj *PostgresDB) ReadUsersByEmail(ctx context.Context, email string) ([]models.User, error) {
+	rows, err := dbObj.db.QueryContext(ctx, "SELECT "+userColumns+" FROM Users WHERE lower(email) = lower($1)", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UPDATE gives the user a new devkey and moves everything owned by the old one to it
+func (dbObj *PostgresDB) ChangeDevKey(ctx context.Context, userID uuid.UUID, oldDevKey, newDevKey string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE Users SET dev_key = $1 WHERE user_id = $2 AND dev_key = $3", newDevKey, userID, oldDevKey)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"UPDATE Object SET dev_key = $1 WHERE dev_key = $2",
+		"UPDATE Folder SET dev_key = $1 WHERE dev_key = $2",
+	} {
+		if _, err := tx.ExecContext(ctx, query, newDevKey, oldDevKey); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Println("User devkey changed successfully")
+	return nil
+}
+
 // UPDATE
 func (dbObj *PostgresDB) UpdateUser(ctx context.Context, userID uuid.UUID, updatedUser models.User) error {
 	_, err := dbObj.db.ExecContext(ctx, "UPDATE Users SET name=$1, password=$2, pasteNum=$3, dev_key=$4, email=$5 WHERE user_id=$6",
@@ -61,6 +135,47 @@ func (dbObj *PostgresDB) UpdateUser(ctx context.Context, userID uuid.UUID, updat
 	return nil
 }
 
+// UPDATE marks the email of the user as verified, only if the user still has that email
+func (dbObj *PostgresDB) VerifyUserEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE Users SET email_verified = true WHERE user_id = $1 AND email = $2", userID, email)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UPDATE sets a new email that has to be verified again, links sent to the old email stop working
+func (dbObj *PostgresDB) ChangeUserEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE Users SET email = $1, email_verified = false WHERE user_id = $2", email, userID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM UserToken WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UPDATE
+func (dbObj *PostgresDB) UpdateUserPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	result, err := dbObj.db.ExecContext(ctx, "UPDATE Users SET password = $1 WHERE user_id = $2", password, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
 // DELETE
 func (dbObj *PostgresDB) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM Users WHERE user_id=$1", userID)
@@ -70,3 +185,91 @@ func (dbObj *PostgresDB) DeleteUser(ctx context.Context, userID uuid.UUID) error
 	fmt.Println("User deleted successfully")
 	return nil
 }
+
+// DELETE removes the user with everything it owns. Every deleted paste gets a pending outbox delete entry
+// in the same transaction, their messages have to be deleted from MongoDB and the entries committed.
+// With keepPublicPastes public pastes stay without owner.
+// Comments of the user on other pastes are deleted like DeleteComment does, so threads stay intact.
+func (dbObj *PostgresDB) DeleteAccount(ctx context.Context, userID uuid.UUID, devKey string, keepPublicPastes bool) ([]models.OutboxEntry, error) {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM Users WHERE user_id = $1 AND dev_key = $2", userID, devKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectAffected(result); err != nil {
+		return nil, err
+	}
+
+	if keepPublicPastes {
+		query := "UPDATE Object SET dev_key = '' WHERE dev_key = $1 AND visibility = '" + models.VisibilityPublic + "'"
+		if _, err := tx.ExecContext(ctx, query, devKey); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, "DELETE FROM Object WHERE dev_key = $1 RETURNING paste_key, COALESCE(message_id, '')", devKey)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.OutboxEntry
+	for rows.Next() {
+		entry := models.OutboxEntry{Operation: models.OutboxDelete}
+		if err := rows.Scan(&entry.PasteKey, &entry.MessageID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	outboxQuery := `
+		INSERT INTO PasteOutbox (operation, paste_key, message_id)
+		VALUES ($1, $2, $3)
+		RETURNING outbox_id, state, created_at
+	`
+	for i := range entries {
+		entry := &entries[i]
+		err := tx.QueryRowContext(ctx, outboxQuery, entry.Operation, entry.PasteKey, entry.MessageID).
+			Scan(&entry.OutboxID, &entry.State, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, query := range []string{
+		"UPDATE Object SET stars = stars - 1 WHERE paste_key IN (SELECT paste_key FROM Star WHERE user_id = $1)",
+		"DELETE FROM Star WHERE user_id = $1",
+		"UPDATE Comment SET body = '', deleted = true, updated_at = now() WHERE author_id = $1 AND NOT deleted",
+		"DELETE FROM ApiToken WHERE user_id = $1",
+		"DELETE FROM RefreshToken WHERE user_id = $1",
+		"DELETE FROM UserToken WHERE user_id = $1",
+		"DELETE FROM RecoveryCode WHERE user_id = $1",
+		"DELETE FROM UserTotp WHERE user_id = $1",
+		"DELETE FROM UserIdentity WHERE user_id = $1",
+		"DELETE FROM OrgMember WHERE user_id = $1",
+		"DELETE FROM OrgInvitation WHERE user_id = $1",
+		"DELETE FROM PasteGrant WHERE grantee_type = 'user' AND grantee_id = $1",
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM Folder WHERE dev_key = $1", devKey); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	fmt.Println("User account deleted successfully")
+	return entries, nil
+}
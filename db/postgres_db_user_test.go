@@ -3,15 +3,22 @@ package db
 import (
 	"context"
 	"crypto/md5"
+	"database/sql"
 	"encoding/hex"
 	"log"
+	"pastebin/config"
 	"pastebin/models"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
+// testPostgres is the Postgres of docker-compose the integration tests run against
+var testPostgres = config.Postgres{Host: "db", Port: 5432, User: "postgres", Password: "pass1234", SSLMode: "disable"}
+
 func prepareUserTable(t *testing.T, testDB *PostgresDB) {
 	// Drop the Users table if it exists
 	dropScript := `
@@ -32,9 +39,15 @@ func prepareUserTable(t *testing.T, testDB *PostgresDB) {
 			password VARCHAR(32) NOT NULL,
 			pasteNum INT NOT NULL,
 			dev_key VARCHAR(32) NOT NULL,
-			email VARCHAR(32) NOT NULL,
+			email VARCHAR(254) NOT NULL,
+			email_verified BOOLEAN NOT NULL DEFAULT false,
+			role VARCHAR(16) NOT NULL DEFAULT 'user',
+			suspended_at TIMESTAMPTZ,
 			PRIMARY KEY (user_id)
 		);
+		CREATE UNIQUE INDEX users_name_lower_idx ON Users (lower(name));
+		CREATE UNIQUE INDEX users_email_lower_idx ON Users (lower(email)) WHERE email <> '';
+		CREATE UNIQUE INDEX users_dev_key_key ON Users (dev_key);
 	`
 
 	_, err = testDB.db.ExecContext(context.Background(), createScript)
@@ -46,7 +59,7 @@ func prepareUserTable(t *testing.T, testDB *PostgresDB) {
 }
 
 func TestCreateUser(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,7 +88,7 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestReadUserById(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,7 +132,7 @@ func TestReadUserById(t *testing.T) {
 }
 
 func TestReadUserByUsername(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,8 +173,48 @@ func TestReadUserByUsername(t *testing.T) {
 	assert.Equal(t, models.User{}, nonExistentUser, "Expected an empty user for a non-existent username")
 }
 
+func TestCreateUserConflicts(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+
+	testUser := models.User{Name: "Alice", Password: "test_password", DevKey: "alice_dev_key", Email: "alice@example.com"}
+	if _, err := testDB.CreateUser(context.Background(), &testUser); err != nil {
+		t.Fatal(err)
+	}
+
+	// usernames and emails are compared ignoring case
+	conflicts := map[string]models.User{
+		"users_name_lower_idx":  {Name: "alice", Password: "test_password", DevKey: "dev_key_1", Email: "other@example.com"},
+		"users_email_lower_idx": {Name: "bob", Password: "test_password", DevKey: "dev_key_2", Email: "ALICE@example.com"},
+		"users_dev_key_key":     {Name: "carol", Password: "test_password", DevKey: "alice_dev_key", Email: "carol@example.com"},
+	}
+	for constraint, user := range conflicts {
+		_, err := testDB.CreateUser(context.Background(), &user)
+		var pqErr *pq.Error
+		if assert.ErrorAs(t, err, &pqErr) {
+			assert.Equal(t, constraint, pqErr.Constraint)
+		}
+	}
+
+	// any number of users can have no email
+	for _, name := range []string{"sso1", "sso2"} {
+		_, err := testDB.CreateUser(context.Background(), &models.User{Name: name, Password: "test_password", DevKey: name, Email: ""})
+		assert.NoError(t, err, "Expected no error")
+	}
+
+	user, err := testDB.ReadUserByUsername(context.Background(), "ALICE")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, testUser.UserID, user.UserID)
+}
+
 func TestUpdateUser(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -205,7 +258,7 @@ func TestUpdateUser(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
-	postgresClient, err := ConnectToPostgresDb("test_db", "postgres", "pass1234")
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -238,3 +291,196 @@ func TestDeleteUser(t *testing.T) {
 	assert.Error(t, err, "Expected an error as the user should be deleted")
 	assert.Equal(t, models.User{}, deletedUser, "Expected an empty user for a deleted user")
 }
+
+func TestChangeDevKey(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareFolderTables(t, testDB)
+
+	testUser := models.User{
+		Name:     "test_username",
+		Password: "test_password",
+		PasteNum: 0,
+		DevKey:   "old_dev_key",
+		Email:    "test@example.com",
+	}
+	if _, err := testDB.CreateUser(context.Background(), &testUser); err != nil {
+		t.Fatal(err)
+	}
+	createTestObjects(t, testDB, "old_dev_key", "paste1", "paste2")
+	createTestObjects(t, testDB, "other_dev_key", "paste3")
+	if err := testDB.CreateFolder(context.Background(), &models.Folder{DevKey: "old_dev_key", Name: "work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = testDB.ChangeDevKey(context.Background(), testUser.UserID, "old_dev_key", "new_dev_key")
+	assert.NoError(t, err, "Expected no error")
+
+	user, err := testDB.ReadUserByDevKey(context.Background(), "new_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, testUser.UserID, user.UserID)
+
+	_, err = testDB.ReadUserByDevKey(context.Background(), "old_dev_key")
+	assert.Equal(t, sql.ErrNoRows, err, "Expected the old devkey to stop working")
+
+	objects, err := testDB.ReadObjectsByDevKey(context.Background(), "new_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, objects, 2, "Expected pastes to move to the new devkey")
+
+	folders, err := testDB.ReadFoldersByDevKey(context.Background(), "new_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Len(t, folders, 1, "Expected folders to move to the new devkey")
+
+	// changing from a devkey the user no longer has fails
+	err = testDB.ChangeDevKey(context.Background(), testUser.UserID, "old_dev_key", "another_dev_key")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestChangeUserEmail(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareUserTokenTable(t, testDB)
+
+	testUser := models.User{
+		Name:     "test_username",
+		Password: "test_password",
+		DevKey:   "test_dev_key",
+		Email:    "old@example.com",
+	}
+	if _, err := testDB.CreateUser(context.Background(), &testUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.VerifyUserEmail(context.Background(), testUser.UserID, "old@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := models.UserToken{TokenHash: "reset", UserID: testUser.UserID, Purpose: models.TokenPurposeResetPassword, Email: "old@example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := testDB.CreateUserToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+
+	err = testDB.ChangeUserEmail(context.Background(), testUser.UserID, "new@example.com")
+	assert.NoError(t, err, "Expected no error")
+
+	user, err := testDB.ReadUserById(context.Background(), testUser.UserID)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.False(t, user.EmailVerified, "Expected the new email to need verification")
+
+	// links sent to the old email stop working
+	_, err = testDB.UseUserToken(context.Background(), "reset", models.TokenPurposeResetPassword, time.Now())
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	err = testDB.ChangeUserEmail(context.Background(), uuid.New(), "new@example.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTable(t, testDB)
+	prepareObjectTable(t, testDB)
+	prepareFolderTables(t, testDB)
+	prepareStarTable(t, testDB)
+	prepareCommentTable(t, testDB)
+	prepareTokenTables(t, testDB)
+	prepareApiTokenTable(t, testDB)
+	prepareUserTokenTable(t, testDB)
+	prepareTotpTables(t, testDB)
+	prepareSsoTables(t, testDB)
+	prepareOrgTables(t, testDB)
+	prepareShareTables(t, testDB)
+	prepareOutboxTable(t, testDB)
+
+	testUser := models.User{Name: "leaving", Password: "test_password", DevKey: "gone_dev_key", Email: "a@example.com"}
+	otherUser := models.User{Name: "staying", Password: "test_password", DevKey: "other_dev_key", Email: "b@example.com"}
+	for _, user := range []*models.User{&testUser, &otherUser} {
+		if _, err := testDB.CreateUser(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, object := range []models.Object{
+		{PasteKey: "private", DevKey: "gone_dev_key", MessageID: "private_message", Visibility: models.VisibilityPrivate},
+		{PasteKey: "public", DevKey: "gone_dev_key", MessageID: "public_message", Visibility: models.VisibilityPublic},
+		{PasteKey: "other", DevKey: "other_dev_key", MessageID: "other_message"},
+	} {
+		if err := testDB.CreateObject(context.Background(), &object); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.CreateFolder(context.Background(), &models.Folder{DevKey: "gone_dev_key", Name: "work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.StarPaste(context.Background(), testUser.UserID, "other"); err != nil {
+		t.Fatal(err)
+	}
+	comment := models.Comment{PasteKey: "other", AuthorID: testUser.UserID, Body: "nice"}
+	if err := testDB.CreateComment(context.Background(), &comment); err != nil {
+		t.Fatal(err)
+	}
+	identity := models.UserIdentity{Provider: "corp", Subject: "1", UserID: testUser.UserID}
+	if err := testDB.CreateUserIdentity(context.Background(), &identity); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := testDB.DeleteAccount(context.Background(), testUser.UserID, "gone_dev_key", true)
+	assert.NoError(t, err, "Expected no error")
+	if assert.Len(t, entries, 1, "Expected only the private paste to be deleted") {
+		assert.Equal(t, models.OutboxDelete, entries[0].Operation)
+		assert.Equal(t, "private", entries[0].PasteKey)
+		assert.Equal(t, "private_message", entries[0].MessageID)
+	}
+
+	pending, err := testDB.ReadPendingOutboxEntries(context.Background())
+	assert.NoError(t, err, "Expected no error")
+	if assert.Len(t, pending, 1, "Expected the delete to be recorded in the outbox") && len(entries) == 1 {
+		assert.Equal(t, entries[0].OutboxID, pending[0].OutboxID)
+	}
+
+	_, err = testDB.ReadUserById(context.Background(), testUser.UserID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	kept, err := testDB.ReadObjectWithoutDevKey(context.Background(), "public")
+	assert.NoError(t, err, "Expected the public paste to stay")
+	assert.Equal(t, "", kept.DevKey, "Expected the public paste to have no owner")
+
+	other, err := testDB.ReadObjectWithoutDevKey(context.Background(), "other")
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, int64(0), other.Stars, "Expected the star of the user to be removed")
+
+	readComment, err := testDB.ReadComment(context.Background(), comment.CommentID)
+	assert.NoError(t, err, "Expected no error")
+	assert.True(t, readComment.Deleted, "Expected the comment of the user to be deleted")
+
+	folders, err := testDB.ReadFoldersByDevKey(context.Background(), "gone_dev_key")
+	assert.NoError(t, err, "Expected no error")
+	assert.Empty(t, folders)
+
+	_, err = testDB.ReadUserIdentity(context.Background(), "corp", "1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	_, err = testDB.ReadUserById(context.Background(), otherUser.UserID)
+	assert.NoError(t, err, "Expected other users to stay")
+
+	// deleting again fails
+	_, err = testDB.DeleteAccount(context.Background(), testUser.UserID, "gone_dev_key", false)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
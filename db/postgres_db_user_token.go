@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"time"
+)
+
+// CREATE a token sent by email, unused tokens of the user with the same purpose stop working
+// so only the link from the latest email can be used
+func (dbObj *PostgresDB) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	tx, err := dbObj.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE UserToken
+		SET used_at = now()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	if _, err := tx.ExecContext(ctx, query, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO UserToken (token_hash, user_id, purpose, email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err = tx.QueryRowContext(ctx, query, token.TokenHash, token.UserID, token.Purpose, token.Email, token.ExpiresAt).
+		Scan(&token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UPDATE marks the token as used and returns it, sql.ErrNoRows means the token is unknown,
+// for another purpose, expired or already used
+func (dbObj *PostgresDB) UseUserToken(ctx context.Context, tokenHash, purpose string, now time.Time) (*models.UserToken, error) {
+	var token models.UserToken
+	query := `
+		UPDATE UserToken
+		SET used_at = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING token_hash, user_id, purpose, email, created_at, expires_at, used_at
+	`
+
+	err := dbObj.db.QueryRowContext(ctx, query, tokenHash, purpose, now).
+		Scan(&token.TokenHash, &token.UserID, &token.Purpose, &token.Email, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DELETE tokens that expired
+func (dbObj *PostgresDB) DeleteExpiredUserTokens(ctx context.Context, now time.Time) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM UserToken WHERE expires_at < $1", now)
+	return err
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareUserTokenTable(t *testing.T, testDB *PostgresDB) {
+	// Drop the UserToken table if it exists
+	dropScript := `
+		DROP TABLE IF EXISTS UserToken;
+	`
+
+	_, err := testDB.db.ExecContext(context.Background(), dropScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create the UserToken table with your specified schema
+	createScript := `
+		CREATE TABLE UserToken (
+			token_hash     varchar(64) NOT NULL,
+			user_id        uuid NOT NULL,
+			purpose        varchar(32) NOT NULL,
+			email          varchar(254) NOT NULL,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			expires_at     timestamptz NOT NULL,
+			used_at        timestamptz,
+			PRIMARY KEY (token_hash)
+		);
+	`
+
+	_, err = testDB.db.ExecContext(context.Background(), createScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Println("UserToken table created successfully!")
+}
+
+func TestUseUserToken(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTokenTable(t, testDB)
+
+	now := time.Now()
+	token := models.UserToken{
+		TokenHash: "hash1",
+		UserID:    uuid.New(),
+		Purpose:   models.TokenPurposeResetPassword,
+		Email:     "test@example.com",
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := testDB.CreateUserToken(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+
+	// token works only for its purpose
+	_, err = testDB.UseUserToken(context.Background(), "hash1", models.TokenPurposeVerifyEmail, now)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	used, err := testDB.UseUserToken(context.Background(), "hash1", models.TokenPurposeResetPassword, now)
+	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, token.UserID, used.UserID)
+	assert.Equal(t, "test@example.com", used.Email)
+
+	// and only once
+	_, err = testDB.UseUserToken(context.Background(), "hash1", models.TokenPurposeResetPassword, now)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// expired tokens don't work
+	expired := token
+	expired.TokenHash = "hash2"
+	if err := testDB.CreateUserToken(context.Background(), &expired); err != nil {
+		t.Fatal(err)
+	}
+	_, err = testDB.UseUserToken(context.Background(), "hash2", models.TokenPurposeResetPassword, now.Add(2*time.Hour))
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestCreateUserTokenReplacesOlder(t *testing.T) {
+	postgresClient, err := ConnectToPostgresDb(testPostgres, "test_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectFromPostgresDb(postgresClient)
+	testDB := NewPostgresDB(postgresClient)
+
+	prepareUserTokenTable(t, testDB)
+
+	now := time.Now()
+	userID := uuid.New()
+	for _, hash := range []string{"old", "new"} {
+		token := models.UserToken{TokenHash: hash, UserID: userID, Purpose: models.TokenPurposeVerifyEmail, Email: "a@example.com", ExpiresAt: now.Add(time.Hour)}
+		if err := testDB.CreateUserToken(context.Background(), &token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = testDB.UseUserToken(context.Background(), "old", models.TokenPurposeVerifyEmail, now)
+	assert.Equal(t, sql.ErrNoRows, err, "Expected older token to stop working")
+
+	_, err = testDB.UseUserToken(context.Background(), "new", models.TokenPurposeVerifyEmail, now)
+	assert.NoError(t, err, "Expected newest token to work")
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The SQLite migrations are built into the binary, so the embedded mode needs nothing but the database file
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteTimeFormat is how times are written to SQLite, in UTC they sort as text like they sort as times
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// sqliteDriver is the driver registered by modernc.org/sqlite, the functions below are registered with it
+var sqliteDriver driver.Driver
+
+// Functions of Postgres used by the queries and the migrations, registered for every SQLite connection
+func init() {
+	conn, _ := sql.Open("sqlite", "")
+	sqliteDriver = conn.Driver()
+	conn.Close()
+
+	sqlite.MustRegisterScalarFunction("uuid_generate_v4", 0, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	sqlite.MustRegisterScalarFunction("now", 0, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeFormat), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("greatest", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		a, b, err := floatArgs(args)
+		return math.Max(a, b), err
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("least", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		a, b, err := floatArgs(args)
+		return math.Min(a, b), err
+	})
+}
+
+func floatArgs(args []driver.Value) (float64, float64, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case float64:
+			values[i] = v
+		case int64:
+			values[i] = float64(v)
+		default:
+			return 0, 0, fmt.Errorf("expected a number, got %T", arg)
+		}
+	}
+	return values[0], values[1], nil
+}
+
+// NewSQLiteDB returns a PostgresDB that runs its queries on SQLite. Most queries are understood by
+// both, the few that differ check sqlite.
+func NewSQLiteDB(db *sql.DB) (dbObj *PostgresDB) {
+	dbObj = NewPostgresDB(db)
+	dbObj.sqlite = true
+	return
+}
+
+// ConnectToSQLiteDb opens the database file, creating it when it doesn't exist, and migrates it
+func ConnectToSQLiteDb(path string) (*sql.DB, error) {
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Set("_time_format", "sqlite")
+	dbo := sql.OpenDB(sqliteConnector{dsn: "file:" + path + "?" + query.Encode()})
+
+	if err := dbo.Ping(); err != nil {
+		dbo.Close()
+		return nil, err
+	}
+	fmt.Println("Successfully connected to SQLite!->", path)
+
+	if err := migrateSQLite(dbo); err != nil {
+		dbo.Close()
+		return nil, err
+	}
+	fmt.Println("Success migration!")
+
+	return dbo, nil
+}
+
+func DisconnectFromSQLiteDb(client *sql.DB) error {
+	fmt.Print("Disconnected from SQLite!\n")
+	return client.Close()
+}
+
+func migrateSQLite(dbo *sql.DB) error {
+	source, err := iofs.New(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		return err
+	}
+	instance, err := migratesqlite.WithInstance(dbo, &migratesqlite.Config{})
+	if err != nil {
+		return err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite", instance)
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+// sqliteConnector opens connections that write times in UTC
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return utcConn{conn.(sqliteConn)}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver {
+	return sqliteDriver
+}
+
+// sqliteConn lists what database/sql uses of a connection of the SQLite driver
+type sqliteConn interface {
+	driver.Conn
+	driver.Pinger
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+}
+
+// utcConn converts times to UTC before they are written, SQLite compares them as text and
+// times of different zones wouldn't be in order
+type utcConn struct {
+	sqliteConn
+}
+
+func (c utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC()
+	}
+	nv.Value = value
+	return nil
+}
+
+// anyOf matches column against the values of a list, written as ANY of an array for Postgres and
+// as IN of a JSON array for SQLite. It returns the condition and the argument for the placeholder.
+func (dbObj *PostgresDB) anyOf(column, placeholder string, values []string) (string, any) {
+	if !dbObj.sqlite {
+		return column + " = ANY(" + placeholder + ")", pq.Array(values)
+	}
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return column + " IN (SELECT value FROM json_each(" + placeholder + "))", string(data)
+}
+
+// UniqueViolation reports if err is a write refused by a unique index, and names the index. SQLite
+// names indexes on expressions, for indexes on columns it names the columns, like "Users.dev_key".
+func UniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint, pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return "", false
+	}
+	_, failed, _ := strings.Cut(sqliteErr.Error(), "UNIQUE constraint failed: ")
+	if index, ok := strings.CutPrefix(failed, "index '"); ok {
+		failed = strings.TrimSuffix(index, "'")
+	}
+	return failed, true
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"pastebin/models"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SQLiteMessageDB keeps paste contents in the Message table of the SQLite file, it implements
+// MessageStore for the embedded mode
+type SQLiteMessageDB struct {
+	db *sql.DB
+}
+
+func NewSQLiteMessageDB(db *sql.DB) *SQLiteMessageDB {
+	return &SQLiteMessageDB{db: db}
+}
+
+// CREATE
+func (dbObj *SQLiteMessageDB) CreateMessage(ctx context.Context, messageBody string) (string, error) {
+	id := primitive.NewObjectID()
+	_, err := dbObj.db.ExecContext(ctx, "INSERT INTO Message (message_id, body) VALUES ($1, $2)", id.Hex(), messageBody)
+	if err != nil {
+		return primitive.NilObjectID.Hex(), err
+	}
+	return id.Hex(), nil
+}
+
+// CREATE or UPDATE the message with the id
+func (dbObj *SQLiteMessageDB) PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error {
+	query := `
+		INSERT INTO Message (message_id, body) VALUES ($1, $2)
+		ON CONFLICT (message_id) DO UPDATE SET body = EXCLUDED.body
+	`
+	_, err := dbObj.db.ExecContext(ctx, query, id.Hex(), messageBody)
+	return err
+}
+
+// READ returns mongo.ErrNoDocuments for missing messages, like MongoDB does
+func (dbObj *SQLiteMessageDB) ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
+	message := models.Message{ID: id}
+	err := dbObj.db.QueryRowContext(ctx, "SELECT body FROM Message WHERE message_id = $1", id.Hex()).Scan(&message.MessageBody)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// READ the messages that exist, in no particular order like Mongo does
+func (dbObj *SQLiteMessageDB) ReadMessages(ctx context.Context, ids []primitive.ObjectID) ([]models.Message, error) {
+	return dbObj.readMessages(ctx, "body", ids)
+}
+
+// READ only the first previewLength characters of every message body
+func (dbObj *SQLiteMessageDB) ReadMessagePreviews(ctx context.Context, ids []primitive.ObjectID, previewLength int) ([]models.Message, error) {
+	return dbObj.readMessages(ctx, "substr(body, 1, "+strconv.Itoa(previewLength)+")", ids)
+}
+
+func (dbObj *SQLiteMessageDB) readMessages(ctx context.Context, bodyColumn string, ids []primitive.ObjectID) ([]models.Message, error) {
+	messages := make([]models.Message, 0, len(ids))
+	if len(ids) == 0 {
+		return messages, nil
+	}
+
+	args := make([]any, len(ids))
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args[i] = id.Hex()
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+	query := "SELECT message_id, " + bodyColumn + " FROM Message WHERE message_id IN (" + strings.Join(placeholders, ", ") + ")"
+
+	rows, err := dbObj.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hex string
+		var message models.Message
+		if err := rows.Scan(&hex, &message.MessageBody); err != nil {
+			return nil, err
+		}
+		if message.ID, err = primitive.ObjectIDFromHex(hex); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// READ the id of every message, fn is called until it returns an error
+func (dbObj *SQLiteMessageDB) ReadMessageIDs(ctx context.Context, fn func(id primitive.ObjectID) error) error {
+	rows, err := dbObj.db.QueryContext(ctx, "SELECT message_id FROM Message ORDER BY message_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			return err
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// UPDATE
+func (dbObj *SQLiteMessageDB) UpdateMessage(ctx context.Context, id primitive.ObjectID, updatedMessage models.Message) error {
+	_, err := dbObj.db.ExecContext(ctx, "UPDATE Message SET body = $1 WHERE message_id = $2", updatedMessage.MessageBody, id.Hex())
+	return err
+}
+
+// DELETE
+func (dbObj *SQLiteMessageDB) DeleteMessage(ctx context.Context, id primitive.ObjectID) error {
+	_, err := dbObj.db.ExecContext(ctx, "DELETE FROM Message WHERE message_id = $1", id.Hex())
+	return err
+}
+
+func (dbObj *SQLiteMessageDB) DeleteMessages(ctx context.Context, ids []primitive.ObjectID) error {
+	for _, id := range ids {
+		if err := dbObj.DeleteMessage(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
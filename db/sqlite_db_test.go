@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"pastebin/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSQLiteDB opens a migrated SQLite file in a temporary directory
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	conn, err := ConnectToSQLiteDb(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSQLiteDBUsers(t *testing.T) {
+	testUserStore(t, NewSQLiteDB(newTestSQLiteDB(t)))
+}
+
+func TestSQLiteDBObjectsPage(t *testing.T) {
+	testObjectsPage(t, NewSQLiteDB(newTestSQLiteDB(t)))
+}
+
+func TestSQLiteMessageDB(t *testing.T) {
+	testMessageStore(t, NewSQLiteMessageDB(newTestSQLiteDB(t)))
+}
+
+func TestSQLiteMigrationsRunOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for i := 0; i < 2; i++ {
+		conn, err := ConnectToSQLiteDb(path)
+		assert.NoError(t, err)
+		conn.Close()
+	}
+}
+
+// TestSQLiteDBTimes checks that times written in any zone compare like times
+func TestSQLiteDBTimes(t *testing.T) {
+	conn := newTestSQLiteDB(t)
+	store := NewSQLiteDB(conn)
+	ctx := context.Background()
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	now := time.Now().Truncate(time.Microsecond)
+
+	// one hour ago in UTC+5 is later than now as text
+	for pasteKey, createdAt := range map[string]time.Time{"old": now.Add(-time.Hour).In(zone), "new": now.UTC()} {
+		assert.NoError(t, store.CreateObject(ctx, &models.Object{PasteKey: pasteKey, DevKey: "owner", MessageID: "msg"}))
+		_, err := conn.ExecContext(ctx, "UPDATE Object SET created_at = $1 WHERE paste_key = $2", createdAt, pasteKey)
+		assert.NoError(t, err)
+	}
+
+	object, err := store.ReadObjectWithoutDevKey(ctx, "old")
+	assert.NoError(t, err)
+	assert.True(t, object.CreatedAt.Equal(now.Add(-time.Hour)))
+
+	page, _, err := store.ReadObjectsPageOfDevKeys(ctx, []string{"owner"}, models.ObjectQuery{SortBy: models.SortByCreated, Desc: true, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new", "old"}, []string{page[0].PasteKey, page[1].PasteKey})
+
+	// the token expires in the future, whatever zone it is written in
+	jti := uuid.New()
+	assert.NoError(t, store.RevokeAccessToken(ctx, jti, now.Add(time.Minute).In(zone)))
+	assert.NoError(t, store.DeleteExpiredTokens(ctx, now.UTC()))
+	revoked, err := store.IsAccessTokenRevoked(ctx, jti)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+// TestSQLiteDBDialect runs the queries that are written differently for SQLite
+func TestSQLiteDBDialect(t *testing.T) {
+	store := NewSQLiteDB(newTestSQLiteDB(t))
+	ctx := context.Background()
+	now := time.Now()
+
+	// lists of keys
+	_, err := store.RecordLoginFailure(ctx, "user:a", now, now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, store.BlockLogin(ctx, "user:a", now.Add(time.Minute)))
+	until, err := store.ReadLoginBlockedUntil(ctx, []string{"user:a", "ip:b"}, now)
+	assert.NoError(t, err)
+	assert.True(t, until.Equal(now.Add(time.Minute)))
+	until, err = store.ReadLoginBlockedUntil(ctx, []string{"ip:b"}, now)
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	// scopes are stored as text
+	user := models.User{Name: "Alice", DevKey: "alice_dev_key", Email: "alice@example.com"}
+	user.UserID, err = store.CreateUser(ctx, &user)
+	assert.NoError(t, err)
+	apiToken := models.ApiToken{UserID: user.UserID, Name: "ci", TokenHash: "hash", Scopes: []string{models.ScopePasteRead, models.ScopePasteWrite}}
+	assert.NoError(t, store.CreateApiToken(ctx, &apiToken))
+	found, err := store.ReadActiveApiToken(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, apiToken.Scopes, found.Scopes)
+
+	// LIKE wildcards typed by users are matched literally, without regard to case
+	assert.NoError(t, store.CreateObject(ctx, &models.Object{PasteKey: "a", DevKey: user.DevKey, MessageID: "msg"}))
+	assert.NoError(t, store.SetPasteTags(ctx, "a", []string{"go_lang", "golang"}))
+	tags, err := store.ReadTagsByPrefix(ctx, user.DevKey, "go_", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.TagCount{{Tag: "go_lang", Count: 1}}, tags)
+	users, err := store.SearchUsers(ctx, models.UserQuery{Search: "ALI", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	users, err = store.SearchUsers(ctx, models.UserQuery{Search: "%", Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	// scores are added in log space with greatest and least
+	assert.NoError(t, store.RecordTrendingView(ctx, "a", now))
+	assert.NoError(t, store.RecordTrendingView(ctx, "a", now))
+	objects, scores, err := store.ReadTrendingObjects(ctx, now, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.InDelta(t, 2, scores[0], 0.01)
+
+	// the last owner can't leave the organisation
+	org := models.Organisation{Name: "Acme", DevKey: "acme_dev_key"}
+	assert.NoError(t, store.CreateOrganisation(ctx, &org, user.UserID))
+	assert.Error(t, store.RemoveOrgMember(ctx, org.OrgID, user.UserID))
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	testOutbox(t, NewSQLiteDB(newTestSQLiteDB(t)))
+}
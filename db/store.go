@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"pastebin/models"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserStore keeps users, what authenticates them and the organisations they belong to
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) (uuid.UUID, error)
+	ReadUserById(ctx context.Context, userID uuid.UUID) (models.User, error)
+	ReadUserByUsername(ctx context.Context, username string) (models.User, error)
+	ReadUserByDevKey(ctx context.Context, devKey string) (models.User, error)
+
+	IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+	ReadActiveApiToken(ctx context.Context, tokenHash string) (*models.ApiToken, error)
+	TouchApiToken(ctx context.Context, tokenID uuid.UUID) error
+
+	ReadOrganisation(ctx context.Context, orgID uuid.UUID) (*models.Organisation, error)
+	ReadOrganisationByDevKey(ctx context.Context, devKey string) (*models.Organisation, error)
+	ReadOrganisationsByUser(ctx context.Context, userID uuid.UUID) ([]models.Organisation, error)
+	ReadOrgMemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error)
+	ReadOrgRoleByDevKey(ctx context.Context, devKey string, userID uuid.UUID) (string, error)
+}
+
+// ObjectStore keeps the metadata of pastes, their content is in a MessageStore
+type ObjectStore interface {
+	CreateObject(ctx context.Context, obj *models.Object) error
+	ReadObjectWithoutDevKey(ctx context.Context, pasteKey string) (*models.Object, error)
+	ReadObjectsPageOfDevKeys(ctx context.Context, devKeys []string, q models.ObjectQuery) ([]models.Object, bool, error)
+	UpdateObject(ctx context.Context, obj *models.Object) error
+	IncrementObjectViews(ctx context.Context, pasteKey string) error
+	DeleteObject(ctx context.Context, pasteKey, devKey string) error
+
+	CreateOutboxEntry(ctx context.Context, entry *models.OutboxEntry) error
+	CommitOutboxEntry(ctx context.Context, outboxID uuid.UUID) error
+	DeleteOutboxEntry(ctx context.Context, outboxID uuid.UUID) error
+
+	SetPasteTags(ctx context.Context, pasteKey string, tags []string) error
+	ReadTagsForPastes(ctx context.Context, pasteKeys []string) (map[string][]string, error)
+	RecordTrendingView(ctx context.Context, pasteKey string, viewedAt time.Time) error
+	ReadGrantPermission(ctx context.Context, pasteKey string, userID uuid.UUID) (string, error)
+}
+
+// MessageStore keeps the content of pastes
+type MessageStore interface {
+	CreateMessage(ctx context.Context, messageBody string) (string, error)
+	PutMessage(ctx context.Context, id primitive.ObjectID, messageBody string) error
+	ReadMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error)
+	ReadMessages(ctx context.Context, ids []primitive.ObjectID) ([]models.Message, error)
+	ReadMessagePreviews(ctx context.Context, ids []primitive.ObjectID, previewLength int) ([]models.Message, error)
+	UpdateMessage(ctx context.Context, id primitive.ObjectID, updatedMessage models.Message) error
+	DeleteMessage(ctx context.Context, id primitive.ObjectID) error
+	DeleteMessages(ctx context.Context, ids []primitive.ObjectID) error
+	ReadMessageIDs(ctx context.Context, fn func(id primitive.ObjectID) error) error
+}
+
+// AccountStore keeps what users change of their account: email, password, devkey, the tokens
+// emailed to them and their API tokens
+type AccountStore interface {
+	ReadUsersByEmail(ctx context.Context, email string) ([]models.User, error)
+	UpdateUserPassword(ctx context.Context, userID uuid.UUID, password string) error
+	ChangeUserEmail(ctx context.Context, userID uuid.UUID, email string) error
+	VerifyUserEmail(ctx context.Context, userID uuid.UUID, email string) error
+	ChangeDevKey(ctx context.Context, userID uuid.UUID, oldDevKey, newDevKey string) error
+	DeleteAccount(ctx context.Context, userID uuid.UUID, devKey string, keepPublicPastes bool) ([]models.OutboxEntry, error)
+
+	CreateUserToken(ctx context.Context, token *models.UserToken) error
+	UseUserToken(ctx context.Context, tokenHash, purpose string, now time.Time) (*models.UserToken, error)
+	DeleteExpiredUserTokens(ctx context.Context, now time.Time) error
+
+	CreateApiToken(ctx context.Context, token *models.ApiToken) error
+	ReadApiTokensByUser(ctx context.Context, userID uuid.UUID) ([]models.ApiToken, error)
+	RevokeApiToken(ctx context.Context, tokenID, userID uuid.UUID) error
+	RevokeUserApiTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+// LoginStore keeps sessions and what logging in goes through: failed attempts, the second factor
+// and the identities of SSO providers
+type LoginStore interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	ReadRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, tokenHash string, now time.Time) (*models.RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	DeleteExpiredTokens(ctx context.Context, now time.Time) error
+
+	RecordLoginFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error)
+	ReadLoginBlockedUntil(ctx context.Context, keys []string, now time.Time) (time.Time, error)
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginFailures(ctx context.Context, key string) error
+	DeleteStaleLoginFailures(ctx context.Context, before time.Time) error
+
+	SaveTotpSecret(ctx context.Context, totp *models.UserTotp) error
+	ReadTotp(ctx context.Context, userID uuid.UUID) (*models.UserTotp, error)
+	EnableTotp(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	UseTotpStep(ctx context.Context, userID uuid.UUID, step int64) error
+	DeleteTotp(ctx context.Context, userID uuid.UUID) error
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+
+	CreateSsoLogin(ctx context.Context, login *models.SsoLogin) error
+	UseSsoLogin(ctx context.Context, stateHash string, now time.Time) (*models.SsoLogin, error)
+	DeleteExpiredSsoLogins(ctx context.Context, now time.Time) error
+	ReadUserIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, identity *models.UserIdentity) error
+}
+
+// OrgStore manages organisations, their members and invitations
+type OrgStore interface {
+	CreateOrganisation(ctx context.Context, org *models.Organisation, ownerID uuid.UUID) error
+	DeleteOrganisation(ctx context.Context, orgID uuid.UUID) error
+	CountSoleOwnedOrganisations(ctx context.Context, userID uuid.UUID) (int, error)
+	ReadOrgMembers(ctx context.Context, orgID uuid.UUID) ([]models.OrgMember, error)
+	SetOrgMemberRole(ctx context.Context, orgID, userID uuid.UUID, role string) error
+	RemoveOrgMember(ctx context.Context, orgID, userID uuid.UUID) error
+
+	CreateOrgInvitation(ctx context.Context, invitation *models.OrgInvitation) error
+	ReadOrgInvitations(ctx context.Context, orgID uuid.UUID, now time.Time) ([]models.OrgInvitation, error)
+	ReadInvitationsForUser(ctx context.Context, userID uuid.UUID, email string, now time.Time) ([]models.OrgInvitation, error)
+	AcceptOrgInvitation(ctx context.Context, invitationID, userID uuid.UUID, email string, now time.Time) (uuid.UUID, error)
+	DeclineOrgInvitation(ctx context.Context, invitationID, userID uuid.UUID, email string) error
+	RevokeOrgInvitation(ctx context.Context, orgID, invitationID uuid.UUID) error
+	DeleteExpiredOrgInvitations(ctx context.Context, now time.Time) error
+}
+
+// AdminStore is what moderators and admins use: searching and restricting users and the audit log
+type AdminStore interface {
+	SearchUsers(ctx context.Context, q models.UserQuery) ([]models.User, error)
+	SetUserRole(ctx context.Context, userID uuid.UUID, role string) error
+	SetUserSuspended(ctx context.Context, userID uuid.UUID, suspendedAt *time.Time) error
+	CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	ReadAuditEntries(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error)
+}
+
+// LibraryStore keeps how users sort the pastes: folders, tags and stars
+type LibraryStore interface {
+	CreateFolder(ctx context.Context, folder *models.Folder) error
+	ReadFolder(ctx context.Context, folderID uuid.UUID, devKey string) (*models.Folder, error)
+	ReadFoldersByDevKey(ctx context.Context, devKey string) ([]models.Folder, error)
+	RenameFolder(ctx context.Context, folderID uuid.UUID, devKey, name string) error
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, devKey string) error
+	MovePasteToFolder(ctx context.Context, pasteKey string, folderID uuid.UUID) error
+	RemovePasteFromFolder(ctx context.Context, pasteKey string) error
+
+	ReadTagsByPrefix(ctx context.Context, devKey, prefix string, limit int) ([]models.TagCount, error)
+
+	StarPaste(ctx context.Context, userID uuid.UUID, pasteKey string) error
+	UnstarPaste(ctx context.Context, userID uuid.UUID, pasteKey string) error
+	ReadStarredObjectsPage(ctx context.Context, userID uuid.UUID, devKey string, limit int, after *models.ObjectCursor) ([]models.Object, []time.Time, bool, error)
+}
+
+// CommentStore keeps the comments of pastes
+type CommentStore interface {
+	CreateComment(ctx context.Context, comment *models.Comment) error
+	ReadComment(ctx context.Context, commentID uuid.UUID) (*models.Comment, error)
+	ReadCommentsByPaste(ctx context.Context, pasteKey string) ([]models.Comment, error)
+	UpdateCommentBody(ctx context.Context, commentID, authorID uuid.UUID, body string) error
+	DeleteComment(ctx context.Context, commentID uuid.UUID) error
+	SetCommentHidden(ctx context.Context, commentID uuid.UUID, hidden bool) error
+	SetCommentsEnabled(ctx context.Context, pasteKey, devKey string, enabled bool) error
+}
+
+// ShareStore keeps who pastes are shared with, users and organisations by grant and anyone by link
+type ShareStore interface {
+	SetPasteGrant(ctx context.Context, grant *models.PasteGrant) error
+	ReadPasteGrants(ctx context.Context, pasteKey string) ([]models.PasteGrant, error)
+	DeletePasteGrant(ctx context.Context, pasteKey, granteeType string, granteeID uuid.UUID) error
+
+	CreateShareLink(ctx context.Context, link *models.ShareLink) error
+	ReadShareLinks(ctx context.Context, pasteKey string) ([]models.ShareLink, error)
+	UseShareLink(ctx context.Context, linkID uuid.UUID, now time.Time) (string, error)
+	RevokeShareLink(ctx context.Context, pasteKey string, linkID uuid.UUID, now time.Time) error
+	DeleteExpiredShareLinks(ctx context.Context, before time.Time) error
+}
+
+// ExploreStore lists the public pastes: the archive and the trending ones
+type ExploreStore interface {
+	ReadPublicObjectsPage(ctx context.Context, q models.ObjectQuery) ([]models.Object, bool, error)
+	ReadTrendingObjects(ctx context.Context, now time.Time, minScore float64, limit int) ([]models.Object, []float64, error)
+	PruneTrending(ctx context.Context, now time.Time, minScore float64) (int64, error)
+}
+
+var (
+	_ UserStore    = (*PostgresDB)(nil)
+	_ ObjectStore  = (*PostgresDB)(nil)
+	_ AccountStore = (*PostgresDB)(nil)
+	_ LoginStore   = (*PostgresDB)(nil)
+	_ OrgStore     = (*PostgresDB)(nil)
+	_ AdminStore   = (*PostgresDB)(nil)
+	_ LibraryStore = (*PostgresDB)(nil)
+	_ CommentStore = (*PostgresDB)(nil)
+	_ ShareStore   = (*PostgresDB)(nil)
+	_ ExploreStore = (*PostgresDB)(nil)
+	_ MessageStore = (*MongoDB)(nil)
+	_ UserStore    = (*MemoryDB)(nil)
+	_ ObjectStore  = (*MemoryDB)(nil)
+	_ MessageStore = (*MemoryMessageDB)(nil)
+	_ MessageStore = (*SQLiteMessageDB)(nil)
+)
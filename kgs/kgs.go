@@ -7,23 +7,33 @@ import (
 )
 
 
+// KGS hands out keys, ctx bounds the database work of a call
 type KGS interface {
-	Check(key string) (string, error)
+	Check(ctx context.Context, key string) (string, error)
+	// Release gives a key that is no longer used back to the pool
+	Release(ctx context.Context, key string) error
+	// Stats counts used and free keys of the pool
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// Stats shows how full a key pool is
+type Stats struct {
+	Used int `json:"used"`
+	Free int `json:"free"`
 }
 
 type kgs struct {
-	ctx context.Context
-	db  *db.PostgresDB
+	db *db.PostgresDB
 }
 
 
-func initKgs(db *db.PostgresDB) error {
-	doneMigration, err := db.CheckMigration(context.Background(), "FillKeysTable")
+func initKgs(ctx context.Context, db *db.PostgresDB) error {
+	doneMigration, err := db.CheckMigration(ctx, "FillKeysTable")
 	if err != nil {
 		return err
 	}
 	if !doneMigration {
-		err := db.FillKeysTable(context.Background())
+		err := db.FillKeysTable(ctx)
 		if err != nil {
 			return err
 		}
@@ -31,30 +41,41 @@ func initKgs(db *db.PostgresDB) error {
 	return nil
 }
 
-func GetInstance(conn *sql.DB) *kgs {
+// GetInstance hands out keys of the Keys table, ctx bounds filling the table on first use
+func GetInstance(ctx context.Context, conn *sql.DB) *kgs {
 	var instance *kgs
 	instance = new(kgs)
-	instance.ctx = context.Background()
 	instance.db = db.NewPostgresDB(conn)
-	initKgs(instance.db)
+	initKgs(ctx, instance.db)
 	
 	return instance
 }
 
-func (k *kgs) Check(key string) (string, error) {
+// GetSQLiteInstance hands out keys of the Keys table in the SQLite file of the embedded mode,
+// paste keys and devkeys come from the same pool there
+func GetSQLiteInstance(ctx context.Context, conn *sql.DB) *kgs {
+	var instance *kgs
+	instance = new(kgs)
+	instance.db = db.NewSQLiteDB(conn)
+	initKgs(ctx, instance.db)
+
+	return instance
+}
+
+func (k *kgs) Check(ctx context.Context, key string) (string, error) {
 	if key == "" {
-		res, err := k.db.GetAndMarkFirstUnusedKey(k.ctx)
+		res, err := k.db.GetAndMarkFirstUnusedKey(ctx)
 		if err != nil {
 			return "", err
 		}
 		return res, nil
 	} else {
-		isUsed, err := k.db.IsKeyUsed(k.ctx, key)
+		isUsed, err := k.db.IsKeyUsed(ctx, key)
 		if err != nil {
 			return "", err
 		}
 		if isUsed {
-			res, err := k.db.GetAndMarkFirstUnusedKey(k.ctx)
+			res, err := k.db.GetAndMarkFirstUnusedKey(ctx)
 			if err != nil {
 				return "", err
 			}
@@ -63,3 +84,15 @@ func (k *kgs) Check(key string) (string, error) {
 		return key, nil
 	}
 }
+
+func (k *kgs) Release(ctx context.Context, key string) error {
+	return k.db.MarkKeyAsUnused(ctx, key)
+}
+
+func (k *kgs) Stats(ctx context.Context) (Stats, error) {
+	used, free, err := k.db.CountKeys(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Used: used, Free: free}, nil
+}
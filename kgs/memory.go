@@ -0,0 +1,60 @@
+package kgs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryKeyLength is the length of keys handed out by the memory KGS, in base 36
+const memoryKeyLength = 6
+
+type memoryKgs struct {
+	mu   sync.Mutex
+	used map[string]bool
+	next int64
+}
+
+// NewMemory returns a KGS that keeps its keys in memory, for tests and for running without the key database
+func NewMemory() KGS {
+	return &memoryKgs{used: make(map[string]bool)}
+}
+
+// Check returns the requested key when it is free, otherwise the next free key
+func (k *memoryKgs) Check(ctx context.Context, key string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key == "" || k.used[key] {
+		for {
+			key = strconv.FormatInt(k.next, 36)
+			key = strings.Repeat("0", memoryKeyLength-len(key)) + key
+			k.next++
+			if !k.used[key] {
+				break
+			}
+		}
+	}
+	k.used[key] = true
+	return key, nil
+}
+
+func (k *memoryKgs) Release(ctx context.Context, key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.used, key)
+	return nil
+}
+
+func (k *memoryKgs) Stats(ctx context.Context) (Stats, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	total := 1
+	for i := 0; i < memoryKeyLength; i++ {
+		total *= 36
+	}
+	return Stats{Used: len(k.used), Free: total - len(k.used)}, nil
+}
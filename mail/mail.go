@@ -0,0 +1,62 @@
+// Package mail sends emails to users, through SMTP in production or into an outbox
+// in tests and local development.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"pastebin/config"
+	"strconv"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromConfig builds an SMTP mailer when cfg.SMTPHost is set, otherwise messages are written to
+// files in cfg.OutboxDir instead of being sent
+func FromConfig(cfg config.Mail) (Mailer, error) {
+	if cfg.SMTPHost == "" {
+		log.Println("Warning: mail.smtp_host is not set, emails are written to " + cfg.OutboxDir)
+		return NewFileOutbox(cfg.OutboxDir)
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("mail.from must be set when mail.smtp_host is set")
+	}
+
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		Host:     cfg.SMTPHost,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
+	}, nil
+}
+
+// format renders the message in RFC 5322 form, header values can't contain line breaks
+func format(from string, msg Message) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("mail header contains a line break")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	outbox := NewOutbox()
+	assert.NoError(t, outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "first"}))
+	assert.NoError(t, outbox.Send(context.Background(), Message{To: "b@example.com", Subject: "other"}))
+	assert.NoError(t, outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "second"}))
+
+	assert.Len(t, outbox.Messages(), 3)
+	last, ok := outbox.Last("a@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "second", last.Subject)
+
+	_, ok = outbox.Last("c@example.com")
+	assert.False(t, ok)
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	err = outbox.Send(context.Background(), Message{To: "a@example.com", Subject: "Hello", Body: "line1\nline2"})
+	assert.NoError(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+	data, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(data), "To: a@example.com\r\n")
+	assert.True(t, strings.HasSuffix(string(data), "line1\r\nline2"))
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	_, err := format("from@example.com", Message{To: "a@example.com\r\nBcc: evil@example.com", Subject: "Hi"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps sent messages in memory, tests read them back with Messages
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of all messages sent so far
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// Last returns the most recent message sent to the address
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// FileOutbox writes every message to its own .eml file, for local development without a mail server
+type FileOutbox struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{dir: dir}, nil
+}
+
+func (o *FileOutbox) Send(ctx context.Context, msg Message) error {
+	data, err := format("pastebin@localhost", msg)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	o.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().UTC().Format("20060102T150405"), o.seq)
+	o.mu.Unlock()
+
+	return os.WriteFile(filepath.Join(o.dir, name), data, 0o600)
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server, authenticating with PLAIN auth when
+// a username is set. net/smtp upgrades the connection with STARTTLS when the server offers it.
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, data)
+}
@@ -1,7 +1,35 @@
 package main
 
-import "pastebin/api"
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"pastebin/api"
+	"pastebin/config"
+	"syscall"
+)
 
 func main() {
-	api.StartApiServerAndPrepareDbConnection()
+	printConfig := flag.Bool("print-config", false, "print the configuration with the secrets redacted and exit")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// docker stop sends SIGTERM, Ctrl+C sends SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := api.NewApp(cfg).Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Server stopped")
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -10,6 +12,78 @@ import (
 type UserLogin struct {  // for communication between frontend and servers
 	Username 	string `json:"username"`
 	Password 	string `json:"password"`
+	Device		string `json:"device"`
+}
+
+type RefreshRequest struct { // for communication between frontend and servers
+	RefreshToken	string `json:"refreshToken"`
+}
+
+type LogoutRequest struct { // All logs out from every device
+	RefreshToken	string `json:"refreshToken"`
+	All		bool   `json:"all"`
+}
+
+type VerifyEmailRequest struct { // token from the verification email
+	Token	string `json:"token"`
+}
+
+type PasswordResetRequest struct { // reset link is sent to the email if an account has it
+	Email	string `json:"email"`
+}
+
+type PasswordResetConfirm struct { // token from the reset email
+	Token		string `json:"token"`
+	Password	string `json:"password"`
+}
+
+type EmailChangeRequest struct { // new email, the current password confirms the change
+	Email		string `json:"email"`
+	Password	string `json:"password"`
+}
+
+type PasswordChangeRequest struct { // for communication between frontend and servers
+	CurrentPassword	string `json:"currentPassword"`
+	NewPassword		string `json:"newPassword"`
+}
+
+type AccountDeleteRequest struct { // public pastes can stay without owner instead of being deleted
+	Password			string `json:"password"`
+	KeepPublicPastes	bool   `json:"keepPublicPastes"`
+}
+
+type RoleRequest struct { // new role of a user, set by an admin, or of an organisation member
+	Role	string `json:"role"`
+}
+
+type OrganisationRequest struct {
+	Name	string `json:"name"`
+}
+
+type InvitationRequest struct { // either username or email, role in the organisation
+	Username	string `json:"username"`
+	Email		string `json:"email"`
+	Role		string `json:"role"`
+}
+
+type SuspendRequest struct { // reason is kept in the audit trail
+	Reason	string `json:"reason"`
+}
+
+type TotpCodeRequest struct { // code from the authenticator app or a recovery code
+	Code	string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct { // second step of login for users with 2FA
+	ChallengeToken	string `json:"challengeToken"`
+	Code		string `json:"code"`
+	Device		string `json:"device"`
+}
+
+type SSOCallbackRequest struct { // code and state the identity provider redirected back with
+	Code	string `json:"code"`
+	State	string `json:"state"`
+	Device	string `json:"device"`
 }
 
 type UserRegistration struct { // for communication between frontend and servers
@@ -18,14 +92,80 @@ type UserRegistration struct { // for communication between frontend and servers
 	Email 	 	string `json:"email" binding:"required"`
 }
 
+// the owner of a paste is the authenticated user, so requests don't carry a devkey
 type Paste struct{
-	DevKey	 	string `json:"devkey"`
 	PasteKey	string `json:"pastekey"`
 	Message 	string `json:"message"`
+	Language	string `json:"language"`
+	Visibility	string `json:"visibility"`
+	Tags		[]string `json:"tags"`
+	OrgID		string `json:"orgId"`
+}
+
+// one entry of the paginated user paste list, Message or Preview is set depending on requested content
+type PasteSummary struct {
+	DevKey		string		`json:"devkey,omitempty"`
+	PasteKey	string		`json:"pastekey"`
+	Message		string		`json:"message,omitempty"`
+	Preview		string		`json:"preview,omitempty"`
+	Language	string		`json:"language"`
+	Visibility	string		`json:"visibility"`
+	Views		int64		`json:"views"`
+	Stars		int64		`json:"stars"`
+	CreatedAt	time.Time	`json:"createdAt"`
+	UpdatedAt	time.Time	`json:"updatedAt"`
+	Tags		[]string	`json:"tags"`
+	Score		float64		`json:"score,omitempty"`
+}
+
+type TagsRequest struct{
+	Tags	[]string	`json:"tags"`
+}
+
+type FolderRequest struct{
+	Name	string	`json:"name"`
+}
+
+type CommentRequest struct{ // ParentID and lines are used only when creating a comment
+	Body		string	`json:"body"`
+	ParentID	string	`json:"parentId"`
+	LineStart	*int	`json:"lineStart"`
+	LineEnd		*int	`json:"lineEnd"`
+}
+
+type CommentSettingsRequest struct{
+	Enabled	bool	`json:"enabled"`
+}
+
+type PasteUpdateRequest struct{ // new content of a paste
+	Message	string	`json:"message"`
+}
+
+type GrantRequest struct{ // either username or orgId
+	Username	string	`json:"username"`
+	OrgID		string	`json:"orgId"`
+	Permission	string	`json:"permission"`
+}
+
+type ShareLinkRequest struct{ // link lifetime in seconds, no maxUses means unlimited
+	ExpiresIn	int64	`json:"expiresIn"`
+	MaxUses		*int	`json:"maxUses"`
+}
+
+type ModerationRequest struct{
+	Hidden	bool	`json:"hidden"`
+}
+
+type ApiTokenRequest struct{
+	Name	string		`json:"name"`
+	Scopes	[]string	`json:"scopes"`
+}
+
+type MoveRequest struct{ // empty FolderID takes the paste out of its folder
+	FolderID	string	`json:"folderId"`
 }
 
 type DeleteRequest struct{
-	DevKey  string	`json:"devkey"`
 	PasteKey    string	`json:"pastekey"`
 }
 
@@ -38,13 +178,325 @@ type User struct { // for communication between api servers and database
 	PasteNum int
 	DevKey   string
 	Email    string
+	// EmailVerified is set once the user opened the link sent to Email
+	EmailVerified bool
+	// Role decides which admin endpoints the user can use
+	Role        string
+	// SuspendedAt is set while the account is suspended by an admin
+	SuspendedAt *time.Time
+}
+
+// roles of users, every role can do everything the roles before it can
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roles in an organisation, every role can do everything the roles before it can
+const (
+	OrgRoleViewer = "viewer"
+	OrgRoleEditor = "editor"
+	OrgRoleOwner  = "owner"
+)
+
+// organisation sharing pastes between its members, Role is the one of the requesting user
+type Organisation struct {
+	OrgID     uuid.UUID `json:"orgId"`
+	Name      string    `json:"name"`
+	DevKey    string    `json:"devkey"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrgMember struct {
+	UserID   uuid.UUID `json:"userId"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// invitation to an organisation, for a user or for whoever verified the email
+type OrgInvitation struct {
+	InvitationID uuid.UUID  `json:"invitationId"`
+	OrgID        uuid.UUID  `json:"orgId"`
+	OrgName      string     `json:"orgName"`
+	UserID       *uuid.UUID `json:"userId,omitempty"`
+	Email        string     `json:"email,omitempty"`
+	Role         string     `json:"role"`
+	InvitedBy    uuid.UUID  `json:"invitedBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+}
+
+// user as shown by the admin API, without password
+type AdminUser struct {
+	UserID        uuid.UUID  `json:"userId"`
+	Name          string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"emailVerified"`
+	PasteNum      int        `json:"pastenum"`
+	Role          string     `json:"role"`
+	SuspendedAt   *time.Time `json:"suspendedAt"`
+}
+
+// owner of a paste as shown by the admin API, a user or an organisation
+type PasteOwner struct {
+	Type string    `json:"type"`
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// filters of the admin user list, Search matches parts of username or email
+type UserQuery struct {
+	Search    string
+	Role      string
+	Suspended *bool
+	Limit     int
+	Offset    int
 }
 
 // communication with relational PostgreSQL database
 type Object struct { // for communication between api servers and database
+	PasteKey   string
+	DevKey     string
+	MessageID  string
+	Language   string
+	Visibility string
+	Views      int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	CommentsEnabled bool
+	Stars           int64
+}
+
+// communication with relational PostgreSQL database
+type Folder struct { // named collection of one user's pastes
+	FolderID  uuid.UUID `json:"folderId"`
+	DevKey    string    `json:"-"`
+	Name      string    `json:"name"`
+	PasteNum  int       `json:"pastenum"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// communication with relational PostgreSQL database
+type Comment struct { // comment on a paste, or on lines LineStart..LineEnd of it when they are set
+	CommentID  uuid.UUID  `json:"commentId"`
+	PasteKey   string     `json:"pastekey"`
+	ParentID   *uuid.UUID `json:"parentId,omitempty"`
+	AuthorID   uuid.UUID  `json:"-"`
+	AuthorName string     `json:"author"`
+	Body       string     `json:"body"`
+	LineStart  *int       `json:"lineStart,omitempty"`
+	LineEnd    *int       `json:"lineEnd,omitempty"`
+	Hidden     bool       `json:"hidden"`
+	Deleted    bool       `json:"deleted"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	Replies    []*Comment `json:"replies"`
+}
+
+// communication with relational PostgreSQL database
+type RefreshToken struct { // only the hash of the token is stored
+	TokenID   uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	Device    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// purposes of tokens sent to users by email
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// communication with relational PostgreSQL database
+type UserToken struct { // only the hash of the token is stored
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   string
+	// Email the token was sent to, verification applies only while the user still has it
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// communication with relational PostgreSQL database
+type UserTotp struct {
+	UserID    uuid.UUID
+	Secret    string
+	Enabled   bool
+	// LastStep is the time step of the last accepted code, codes can't be used twice
+	LastStep  int64
+	CreatedAt time.Time
+	EnabledAt *time.Time
+}
+
+// communication with relational PostgreSQL database
+type UserIdentity struct { // account at an identity provider, subject is its id there
+	Provider  string
+	Subject   string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+}
+
+// communication with relational PostgreSQL database
+type SsoLogin struct { // only the hash of the state is stored
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// communication with relational PostgreSQL database
+type ApiToken struct { // only the hash of the token is stored
+	TokenID    uuid.UUID  `json:"tokenId"`
+	UserID     uuid.UUID  `json:"-"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// communication with relational PostgreSQL database
+type PasteGrant struct { // right of a user or an organisation on a paste, GranteeName is its name
+	PasteKey    string    `json:"-"`
+	GranteeType string    `json:"granteeType"`
+	GranteeID   uuid.UUID `json:"granteeId"`
+	GranteeName string    `json:"granteeName"`
+	Permission  string    `json:"permission"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// grantees and permissions of paste grants
+const (
+	GranteeUser = "user"
+	GranteeOrg  = "org"
+
+	PermissionRead = "read"
+	PermissionEdit = "edit"
+)
+
+// communication with relational PostgreSQL database
+type ShareLink struct { // signed link reading a paste without account, the signature is not stored
+	LinkID    uuid.UUID  `json:"linkId"`
+	PasteKey  string     `json:"pastekey"`
+	CreatedBy uuid.UUID  `json:"createdBy"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	URL       string     `json:"url,omitempty"`
+}
+
+// communication with relational PostgreSQL database
+type OutboxEntry struct { // a paste being created or deleted in Postgres and in the message store
+	OutboxID  uuid.UUID
+	Operation string
 	PasteKey  string
-	DevKey    string
 	MessageID string
+	State     string
+	CreatedAt time.Time
+}
+
+// operations and states of outbox entries, entries are pending until both stores are written
+const (
+	OutboxCreate = "create"
+	OutboxDelete = "delete"
+
+	OutboxPending   = "pending"
+	OutboxCommitted = "committed"
+)
+
+// communication with relational PostgreSQL database
+type AuditEntry struct { // one action done through the admin API
+	AuditID    uuid.UUID `json:"auditId"`
+	ActorID    uuid.UUID `json:"actorId"`
+	ActorName  string    `json:"actorName"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetId"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// filters of the audit trail, Before pages to older entries
+type AuditQuery struct {
+	ActorID    uuid.UUID
+	TargetType string
+	TargetID   string
+	Before     *time.Time
+	Limit      int
+}
+
+// actions recorded in the audit trail
+const (
+	AuditListUsers     = "user.list"
+	AuditSetRole       = "user.role"
+	AuditSuspendUser   = "user.suspend"
+	AuditUnsuspendUser = "user.unsuspend"
+	AuditReadPaste     = "paste.read"
+	AuditDeletePaste   = "paste.delete"
+	AuditReadKgs       = "kgs.read"
+	AuditReadAudit     = "audit.read"
+)
+
+// scopes of API tokens and the devkey, sessions from login have all of them
+const (
+	ScopePasteRead  = "paste:read"
+	ScopePasteWrite = "paste:write"
+	ScopeAccount    = "account"
+)
+
+// tag with the number of user's pastes carrying it, used for autocomplete
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// paste visibility values stored in Object.visibility
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// sort fields accepted by ObjectQuery
+const (
+	SortByCreated = "created"
+	SortByUpdated = "updated"
+	SortByViews   = "views"
+)
+
+// position after the last row of a page, SortValue holds the value of the sorted column
+type ObjectCursor struct {
+	SortValue string `json:"v"`
+	PasteKey  string `json:"k"`
+}
+
+// filtering, sorting and keyset pagination of objects that belong to one devkey
+type ObjectQuery struct {
+	SortBy     string
+	Desc       bool
+	Language   string
+	Visibility string
+	Tag        string
+	FolderID   string
+	Limit      int
+	After      *ObjectCursor
 }
 
 // communication with non-relational Mongo database
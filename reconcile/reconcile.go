@@ -0,0 +1,247 @@
+// Package reconcile repairs pastes whose metadata in Postgres and content in the message store
+// disagree, because a create or delete was interrupted between writing the two.
+//
+// Creating and deleting a paste is recorded in the outbox first. Writing the Object row is the
+// point of no return: a create whose Object exists is committed, one without Object is undone by
+// deleting its message. A delete whose Object is gone is committed by deleting its message, one
+// whose Object still exists is given up and the paste stays. Messages no paste refers to and
+// pastes whose message is missing are found by comparing both stores.
+//
+// Pastes whose message is missing are only deleted when asked for with DeleteDanglingPastes, the
+// server runs the reconciler without it. A message store that is misconfigured or only partly
+// restored looks like many missing messages, so the run fails instead when too many are missing.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"pastebin/db"
+	"pastebin/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultGrace is how old outbox entries, messages and pastes have to be before they are repaired,
+// requests still writing them are left alone
+const DefaultGrace = 15 * time.Minute
+
+// DefaultMaxMissing is the fraction of pastes that may miss their message for them to be deleted
+const DefaultMaxMissing = 0.01
+
+// Objects is what the reconciler reads and repairs in Postgres
+type Objects interface {
+	ReadAllObjects(ctx context.Context, fn func(obj models.Object) error) error
+	DeleteObject(ctx context.Context, pasteKey, devKey string) error
+
+	ReadPendingOutboxEntries(ctx context.Context) ([]models.OutboxEntry, error)
+	CommitOutboxEntry(ctx context.Context, outboxID uuid.UUID) error
+	DeleteOutboxEntry(ctx context.Context, outboxID uuid.UUID) error
+	DeleteCommittedOutboxEntries(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ Objects = (*db.PostgresDB)(nil)
+var _ Objects = (*db.MemoryDB)(nil)
+
+// Report lists what was repaired, or what would be repaired in a dry run
+type Report struct {
+	DryRun bool
+	// paste keys of interrupted creates and deletes
+	CommittedCreates  []string
+	RolledBackCreates []string
+	CommittedDeletes  []string
+	RolledBackDeletes []string
+	// hex ids of messages no paste refers to, they are deleted
+	OrphanedMessages []string
+	// paste keys of pastes whose message is missing, they are only deleted with DeletesDangling
+	DanglingPastes  []string
+	DeletesDangling bool
+	// committed outbox entries that were cleaned up
+	PurgedEntries int64
+}
+
+func (r *Report) Repairs() int {
+	repairs := len(r.CommittedCreates) + len(r.RolledBackCreates) + len(r.CommittedDeletes) + len(r.RolledBackDeletes) +
+		len(r.OrphanedMessages)
+	if r.DeletesDangling {
+		repairs += len(r.DanglingPastes)
+	}
+	return repairs
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	if r.DryRun {
+		b.WriteString("Dry run, nothing was changed\n")
+	}
+	danglingTitle := "Pastes without message left, delete them with cmd/reconcile"
+	if r.DeletesDangling {
+		danglingTitle = "Pastes without message deleted"
+	}
+	for _, line := range []struct {
+		title string
+		items []string
+	}{
+		{"Interrupted creates committed", r.CommittedCreates},
+		{"Interrupted creates rolled back", r.RolledBackCreates},
+		{"Interrupted deletes committed", r.CommittedDeletes},
+		{"Interrupted deletes rolled back", r.RolledBackDeletes},
+		{"Orphaned messages deleted", r.OrphanedMessages},
+		{danglingTitle, r.DanglingPastes},
+	} {
+		fmt.Fprintf(&b, "%s: %d", line.title, len(line.items))
+		if len(line.items) > 0 {
+			b.WriteString(" (" + strings.Join(line.items, ", ") + ")")
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Committed outbox entries purged: %d\n", r.PurgedEntries)
+	return b.String()
+}
+
+type Reconciler struct {
+	objects  Objects
+	messages db.MessageStore
+	grace    time.Duration
+	now      func() time.Time
+	// set by DeleteDanglingPastes
+	deleteDangling bool
+	maxMissing     float64
+}
+
+func New(objects Objects, messages db.MessageStore, grace time.Duration) *Reconciler {
+	return &Reconciler{objects: objects, messages: messages, grace: grace, now: time.Now}
+}
+
+// DeleteDanglingPastes makes Run delete pastes whose message is missing, unless more than the
+// maxMissing fraction of all pastes miss their message
+func (rc *Reconciler) DeleteDanglingPastes(maxMissing float64) *Reconciler {
+	rc.deleteDangling, rc.maxMissing = true, maxMissing
+	return rc
+}
+
+// Run finds and repairs inconsistent pastes, with dryRun it only reports them
+func (rc *Reconciler) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, DeletesDangling: rc.deleteDangling}
+	cutoff := rc.now().Add(-rc.grace)
+
+	// the outbox is read first, so every paste written after it is seen in both stores below
+	entries, err := rc.objects.ReadPendingOutboxEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inFlight := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		inFlight[entry.MessageID] = true
+	}
+
+	// messages are read before objects, pastes are created message first
+	messages := make(map[string]bool)
+	err = rc.messages.ReadMessageIDs(ctx, func(id primitive.ObjectID) error {
+		messages[id.Hex()] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make(map[string]models.Object)
+	err = rc.objects.ReadAllObjects(ctx, func(obj models.Object) error {
+		objects[obj.MessageID] = obj
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// dangling pastes are counted before anything is changed, so a run that fails left everything as it was
+	var dangling []models.Object
+	for messageID, obj := range objects {
+		if messages[messageID] || inFlight[messageID] || obj.CreatedAt.After(cutoff) {
+			continue
+		}
+		dangling = append(dangling, obj)
+		report.DanglingPastes = append(report.DanglingPastes, obj.PasteKey)
+	}
+	sort.Strings(report.DanglingPastes)
+	if rc.deleteDangling && float64(len(dangling)) > rc.maxMissing*float64(len(objects)) {
+		return report, fmt.Errorf("%d of %d pastes have no message, more than the %g allowed to be deleted, is the message store complete?",
+			len(dangling), len(objects), rc.maxMissing)
+	}
+
+	for _, entry := range entries {
+		if entry.CreatedAt.After(cutoff) {
+			continue
+		}
+		if err := rc.resolve(ctx, entry, objects, report); err != nil {
+			return report, err
+		}
+	}
+
+	for hex := range messages {
+		id, _ := primitive.ObjectIDFromHex(hex)
+		if _, ok := objects[hex]; ok || inFlight[hex] || id.Timestamp().After(cutoff) {
+			continue
+		}
+		report.OrphanedMessages = append(report.OrphanedMessages, hex)
+		if !dryRun {
+			if err := rc.messages.DeleteMessage(ctx, id); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if rc.deleteDangling && !dryRun {
+		for _, obj := range dangling {
+			if err := rc.objects.DeleteObject(ctx, obj.PasteKey, obj.DevKey); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	sort.Strings(report.OrphanedMessages)
+
+	if !dryRun {
+		report.PurgedEntries, err = rc.objects.DeleteCommittedOutboxEntries(ctx, cutoff)
+	}
+	return report, err
+}
+
+// resolve finishes or undoes the operation of a pending outbox entry, depending on whether its
+// Object was written
+func (rc *Reconciler) resolve(ctx context.Context, entry models.OutboxEntry, objects map[string]models.Object, report *Report) error {
+	_, objectExists := objects[entry.MessageID]
+
+	var deleteMessage, commit bool
+	switch {
+	case entry.Operation == models.OutboxCreate && objectExists:
+		report.CommittedCreates = append(report.CommittedCreates, entry.PasteKey)
+		commit = true
+	case entry.Operation == models.OutboxCreate:
+		report.RolledBackCreates = append(report.RolledBackCreates, entry.PasteKey)
+		deleteMessage = true
+	case entry.Operation == models.OutboxDelete && objectExists:
+		report.RolledBackDeletes = append(report.RolledBackDeletes, entry.PasteKey)
+	default:
+		report.CommittedDeletes = append(report.CommittedDeletes, entry.PasteKey)
+		deleteMessage, commit = true, true
+	}
+	if report.DryRun {
+		return nil
+	}
+
+	if deleteMessage {
+		if id, err := primitive.ObjectIDFromHex(entry.MessageID); err == nil {
+			if err := rc.messages.DeleteMessage(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+	if commit {
+		return rc.objects.CommitOutboxEntry(ctx, entry.OutboxID)
+	}
+	return rc.objects.DeleteOutboxEntry(ctx, entry.OutboxID)
+}
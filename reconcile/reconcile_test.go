@@ -0,0 +1,146 @@
+package reconcile
+
+import (
+	"context"
+	"pastebin/db"
+	"pastebin/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fixture struct {
+	t        *testing.T
+	objects  *db.MemoryDB
+	messages *db.MemoryMessageDB
+}
+
+// paste writes the message and the Object of a paste, and an outbox entry for the operation if it is not empty
+func (f *fixture) paste(pasteKey string, withMessage, withObject bool, operation string) primitive.ObjectID {
+	ctx := context.Background()
+	id := primitive.NewObjectID()
+	if operation != "" {
+		entry := models.OutboxEntry{Operation: operation, PasteKey: pasteKey, MessageID: id.Hex()}
+		assert.NoError(f.t, f.objects.CreateOutboxEntry(ctx, &entry))
+	}
+	if withMessage {
+		assert.NoError(f.t, f.messages.PutMessage(ctx, id, "body of "+pasteKey))
+	}
+	if withObject {
+		assert.NoError(f.t, f.objects.CreateObject(ctx, &models.Object{PasteKey: pasteKey, DevKey: "owner", MessageID: id.Hex()}))
+	}
+	return id
+}
+
+func (f *fixture) hasMessage(id primitive.ObjectID) bool {
+	_, err := f.messages.ReadMessage(context.Background(), id)
+	if err != mongo.ErrNoDocuments {
+		assert.NoError(f.t, err)
+	}
+	return err == nil
+}
+
+func (f *fixture) hasObject(pasteKey string) bool {
+	_, err := f.objects.ReadObjectWithoutDevKey(context.Background(), pasteKey)
+	return err == nil
+}
+
+func TestRun(t *testing.T) {
+	f := &fixture{t: t, objects: db.NewMemoryDB(), messages: db.NewMemoryMessageDB()}
+	ctx := context.Background()
+
+	healthy := f.paste("healthy", true, true, "")
+	created := f.paste("created", true, true, models.OutboxCreate)
+	halfCreated := f.paste("half_created", true, false, models.OutboxCreate)
+	halfDeleted := f.paste("half_deleted", true, false, models.OutboxDelete)
+	notDeleted := f.paste("not_deleted", true, true, models.OutboxDelete)
+	orphaned := f.paste("orphaned", true, false, "")
+	f.paste("dangling", false, true, "")
+
+	// everything is younger than the grace period
+	report, err := New(f.objects, f.messages, DefaultGrace).Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Zero(t, report.Repairs())
+
+	later := New(f.objects, f.messages, DefaultGrace).DeleteDanglingPastes(0.5)
+	later.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	// a dry run reports the repairs without doing them
+	report, err = later.Run(ctx, true)
+	assert.NoError(t, err)
+	expected := &Report{
+		DryRun:            true,
+		CommittedCreates:  []string{"created"},
+		RolledBackCreates: []string{"half_created"},
+		CommittedDeletes:  []string{"half_deleted"},
+		RolledBackDeletes: []string{"not_deleted"},
+		OrphanedMessages:  []string{orphaned.Hex()},
+		DanglingPastes:    []string{"dangling"},
+		DeletesDangling:   true,
+	}
+	assert.Equal(t, expected, report)
+	assert.Contains(t, report.String(), "Interrupted creates rolled back: 1 (half_created)")
+	assert.True(t, f.hasMessage(orphaned))
+	assert.True(t, f.hasObject("dangling"))
+	entries, _ := f.objects.ReadPendingOutboxEntries(ctx)
+	assert.Len(t, entries, 4)
+
+	report, err = later.Run(ctx, false)
+	assert.NoError(t, err)
+	expected.DryRun = false
+	expected.PurgedEntries = 2
+	assert.Equal(t, expected, report)
+
+	assert.True(t, f.hasMessage(healthy) && f.hasObject("healthy"))
+	assert.True(t, f.hasMessage(created) && f.hasObject("created"))
+	assert.True(t, f.hasMessage(notDeleted) && f.hasObject("not_deleted"))
+	assert.False(t, f.hasMessage(halfCreated))
+	assert.False(t, f.hasMessage(halfDeleted))
+	assert.False(t, f.hasMessage(orphaned))
+	assert.False(t, f.hasObject("dangling"))
+	entries, _ = f.objects.ReadPendingOutboxEntries(ctx)
+	assert.Empty(t, entries)
+
+	// nothing is left to repair
+	report, err = later.Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Zero(t, report.Repairs())
+	assert.Zero(t, report.PurgedEntries)
+}
+
+func TestRunDanglingPastes(t *testing.T) {
+	f := &fixture{t: t, objects: db.NewMemoryDB(), messages: db.NewMemoryMessageDB()}
+	ctx := context.Background()
+	at := func(rc *Reconciler) *Reconciler {
+		rc.now = func() time.Time { return time.Now().Add(time.Hour) }
+		return rc
+	}
+
+	f.paste("healthy", true, true, "")
+	f.paste("dangling", false, true, "")
+	halfCreated := f.paste("half_created", true, false, models.OutboxCreate)
+
+	// without DeleteDanglingPastes, like the server runs it, they are only reported
+	report, err := at(New(f.objects, f.messages, DefaultGrace)).Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dangling"}, report.DanglingPastes)
+	assert.Equal(t, 1, report.Repairs())
+	assert.Contains(t, report.String(), "Pastes without message left, delete them with cmd/reconcile: 1 (dangling)")
+	assert.True(t, f.hasObject("dangling"))
+	assert.False(t, f.hasMessage(halfCreated))
+
+	// half of the pastes miss their message, nothing is changed
+	orphaned := f.paste("orphaned", true, false, "")
+	_, err = at(New(f.objects, f.messages, DefaultGrace).DeleteDanglingPastes(DefaultMaxMissing)).Run(ctx, false)
+	assert.ErrorContains(t, err, "1 of 2 pastes have no message")
+	assert.True(t, f.hasObject("dangling"))
+	assert.True(t, f.hasMessage(orphaned))
+
+	report, err = at(New(f.objects, f.messages, DefaultGrace).DeleteDanglingPastes(0.5)).Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dangling"}, report.DanglingPastes)
+	assert.False(t, f.hasObject("dangling"))
+}